@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/chlab/lunch-wankdorf/internal/app"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// archive copies the published menus into the archive and rebuilds its index.
+func archive(args []string) error {
+	flag := flag.NewFlagSet("lunch-app archive", flag.ExitOnError)
+	dryRun := flag.Bool("dryRun", false, "Only list the menus that would be archived")
+	storageBackend := flag.String("storage", "r2", "Where the menus are: r2, s3 or local")
+	storageDir := flag.String("storageDir", storage.DefaultDir, "Directory of the local storage")
+	flag.Parse(args)
+
+	return app.RunArchive(app.Config{
+		DryRun:     *dryRun,
+		Storage:    *storageBackend,
+		StorageDir: *storageDir,
+	})
+}
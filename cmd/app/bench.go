@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+
+	"github.com/chlab/lunch-wankdorf/internal/app"
+)
+
+// bench compares models on recorded days, for the table in the README's model notes.
+func bench(args []string) error {
+	flag := flag.NewFlagSet("lunch-app bench", flag.ExitOnError)
+	var fixtures []string
+	flag.Func("fixtures", "Recording made with -record, or JSON file of what a scraper returned, to take the days from (repeatable)", func(value string) error {
+		fixtures = append(fixtures, value)
+		return nil
+	})
+	models := flag.String("models", "", "Comma-separated models to compare (default: OPENAI_MODEL, or the provider's model)")
+	runs := flag.Int("runs", app.DefaultBenchRuns, "How often every day is parsed with each model")
+	markdownFile := flag.String("markdown", "", "Write the table to this file as well")
+	csvFile := flag.String("csv", "", "Write the results to this file as CSV")
+	pricesFile := flag.String("pricesFile", "", "YAML file with the models' prices per million tokens (default: the built-in prices, or PRICES_FILE)")
+	promptsDir := flag.String("promptsDir", "", "Directory of prompt templates, v1.tmpl and on (default: the built-in prompts, or PROMPTS_DIR)")
+	flag.Parse(args)
+
+	if len(fixtures) == 0 {
+		return errors.New("no fixtures to benchmark on, pass -fixtures")
+	}
+	if *runs < 1 {
+		return errors.New("-runs must be at least 1")
+	}
+
+	var modelList []string
+	for model := range strings.SplitSeq(*models, ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			modelList = append(modelList, model)
+		}
+	}
+
+	return app.RunBench(app.Config{
+		Fixtures:     fixtures,
+		Models:       modelList,
+		Runs:         *runs,
+		MarkdownFile: *markdownFile,
+		CSVFile:      *csvFile,
+		PricesFile:   *pricesFile,
+		PromptsDir:   *promptsDir,
+	})
+}
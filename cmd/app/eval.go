@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/chlab/lunch-wankdorf/internal/app"
+)
+
+// evaluate scores the model's parses of the golden menus.
+func evaluate(args []string) error {
+	flag := flag.NewFlagSet("lunch-app eval", flag.ExitOnError)
+	goldenDir := flag.String("golden", "", "Directory of golden menus to score against (default: the built-in ones)")
+	recordDir := flag.String("record", "", "Record the model's answers to this directory, to evaluate offline later")
+	replayDir := flag.String("replay", "", "Replay the model's answers from this directory instead of asking it")
+	out := flag.String("out", "", "Write the evaluation to this file as JSON, to compare a later one to")
+	baseline := flag.String("baseline", "", "Compare to an evaluation written with -out, e.g. the last prompt version's")
+	promptsDir := flag.String("promptsDir", "", "Directory of prompt templates, v1.tmpl and on, e.g. a new version to try (default: the built-in prompts, or PROMPTS_DIR)")
+	flag.Parse(args)
+
+	return app.RunEval(app.Config{
+		GoldenDir:    *goldenDir,
+		RecordDir:    *recordDir,
+		ReplayDir:    *replayDir,
+		EvalFile:     *out,
+		BaselineFile: *baseline,
+		PromptsDir:   *promptsDir,
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/chlab/lunch-wankdorf/internal/app"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// fetch scrapes, parses and publishes menus. It is what runs without a subcommand.
+func fetch(args []string) error {
+	flag := flag.NewFlagSet("lunch-app", flag.ExitOnError)
+	debugMode := flag.Bool("debug", false, "Enable debug mode with detailed output files")
+	dryRun := flag.Bool("dryRun", false, "When enabled, no API calls will be made")
+	restaurantID := flag.String("restaurant", "gira", "ID of the restaurant to fetch menu from, or a comma-separated list of IDs")
+	upload := flag.Bool("upload", false, "Publish the parsed menu to the storage -storage selects")
+	storageBackend := flag.String("storage", "r2", "Where menus are published and read back from: r2, s3 or local")
+	storageDir := flag.String("storageDir", storage.DefaultDir, "Directory of the local storage, e.g. a mirror for VITE_MENU_BASE_URL")
+	photosOnly := flag.Bool("photos", false, "Only add newly published dish photos to the menu, without re-parsing it")
+	all := flag.Bool("all", false, "Fetch every enabled restaurant in one run")
+	concurrency := flag.Int("concurrency", 2, "How many restaurants to fetch at once when fetching several")
+	failOn := flag.String("failOn", "any", "When fetching several restaurants, exit non-zero if any, all or never of them fail")
+	restaurantsFile := flag.String("restaurantsFile", "", "YAML or JSON file with the restaurants to fetch (default: the built-in list, or RESTAURANTS_FILE)")
+	recordDir := flag.String("record", "", "Record everything fetched (scrapes, model answers, dish pages) to this directory")
+	replayDir := flag.String("replay", "", "Replay a recording from this directory instead of fetching anything")
+	requireValid := flag.Bool("requireValid", false, "Don't upload a menu that still fails validation against the scraped page after the retries")
+	upcomingOnly := flag.Bool("upcomingOnly", false, "Only publish the weeks after the current one, e.g. next week's menu on a Friday")
+	historyFile := flag.String("history", "", "SQLite file to keep the dish history in (default: the -historyBucket's, when uploading)")
+	historyBucket := flag.String("historyBucket", "", "Private bucket of the -storage backend to keep the dish history in, never the menus' (or HISTORY_BUCKET); a directory for local storage")
+	parseCacheDir := flag.String("parseCache", "", "Directory to cache parsed days in (default: PARSE_CACHE_DIR, or the user's cache directory when uploading)")
+	refresh := flag.Bool("refresh", false, "Scrape the current week again and only parse and publish the days that changed since it was published")
+	reportFile := flag.String("report", "", "Write a JSON report of the run, with how long each restaurant's stages took, to this file")
+	pushgateway := flag.String("pushgateway", "", "Push the run's metrics to the Pushgateway at this URL when it is done (or PUSHGATEWAY_URL)")
+	pricesFile := flag.String("pricesFile", "", "YAML file with the models' prices per million tokens (default: the built-in prices, or PRICES_FILE)")
+	budget := flag.Float64("budget", 0, "Stop sending the model anything once the run spent this many US dollars on it (default: no budget)")
+	promptsDir := flag.String("promptsDir", "", "Directory of prompt templates, v1.tmpl and on (default: the built-in prompts, or PROMPTS_DIR)")
+	parser := flag.String("parser", "", "How menus are parsed: model, rules or rules+model (default: each restaurant's own setting)")
+	flag.Parse(args)
+
+	failurePolicy, err := app.ParseFailurePolicy(*failOn)
+	if err != nil {
+		return err
+	}
+	if *budget < 0 {
+		return fmt.Errorf("invalid -budget %v, want a number of US dollars", *budget)
+	}
+
+	// Create config for the application
+	config := app.Config{
+		DebugMode:       *debugMode,
+		DryRun:          *dryRun,
+		RestaurantID:    *restaurantID,
+		Upload:          *upload,
+		Storage:         *storageBackend,
+		StorageDir:      *storageDir,
+		RestaurantsFile: *restaurantsFile,
+		Parser:          *parser,
+		RecordDir:       *recordDir,
+		ReplayDir:       *replayDir,
+		RequireValid:    *requireValid,
+		UpcomingOnly:    *upcomingOnly,
+		Refresh:         *refresh,
+		HistoryFile:     *historyFile,
+		HistoryBucket:   *historyBucket,
+		ParseCacheDir:   *parseCacheDir,
+		ReportFile:      *reportFile,
+		Pushgateway:     *pushgateway,
+		PricesFile:      *pricesFile,
+		Budget:          *budget,
+		PromptsDir:      *promptsDir,
+		Concurrency:     *concurrency,
+		FailurePolicy:   failurePolicy,
+	}
+
+	run, err := chooseRun(&config, *photosOnly, *all, given(flag, "restaurant"))
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Starting Lunch Wankdorf application...")
+	return run(config)
+}
+
+// chooseRun picks what the fetch runs from the flags that pick it: -photos, -all
+// and a list of restaurants. They don't combine, and rather than have one of them
+// quietly win over the other, a run that asks for two is refused.
+func chooseRun(config *app.Config, photos, all, restaurantGiven bool) (func(app.Config) error, error) {
+	list := strings.Contains(config.RestaurantID, ",")
+	switch {
+	case photos && all:
+		return nil, errors.New("-photos updates one restaurant's photos, it can't be combined with -all")
+	case photos && list:
+		return nil, errors.New("-photos updates one restaurant's photos, not a list of them")
+	case all && restaurantGiven:
+		return nil, errors.New("-all fetches every enabled restaurant, it can't be combined with -restaurant")
+	case photos:
+		return app.RunPhotoUpdate, nil
+	case all:
+		return app.RunBatch, nil
+	case list:
+		config.Restaurants = strings.Split(config.RestaurantID, ",")
+		return app.RunBatch, nil
+	}
+	return app.Run, nil
+}
+
+// given says whether the flag was on the command line, rather than left at its
+// default.
+func given(flags *flag.FlagSet, name string) bool {
+	found := false
+	flags.Visit(func(f *flag.Flag) {
+		found = found || f.Name == name
+	})
+	return found
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chlab/lunch-wankdorf/internal/app"
+)
+
+// Flags that pick different runs are refused before anything runs.
+func TestFetchRefusesFlagsThatPickDifferentRuns(t *testing.T) {
+	for _, args := range [][]string{
+		{"-photos", "-all"},
+		{"-photos", "-restaurant", "espace,gira"},
+		{"-all", "-restaurant", "gira,luna"},
+		{"-all", "-restaurant", "gira"},
+	} {
+		if err := fetch(args); err == nil {
+			t.Errorf("fetch(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestChooseRun(t *testing.T) {
+	same := func(a, b func(app.Config) error) bool {
+		return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+	}
+
+	tests := []struct {
+		name                    string
+		restaurantID            string
+		photos, all, restaurant bool
+		want                    func(app.Config) error
+		restaurants             []string
+	}{
+		{"one restaurant", "gira", false, false, true, app.Run, nil},
+		{"the default restaurant", "gira", false, false, false, app.Run, nil},
+		{"a list", "gira,luna", false, false, true, app.RunBatch, []string{"gira", "luna"}},
+		{"every restaurant", "gira", false, true, false, app.RunBatch, nil},
+		{"photos", "espace", true, false, true, app.RunPhotoUpdate, nil},
+	}
+	for _, tt := range tests {
+		config := app.Config{RestaurantID: tt.restaurantID}
+		run, err := chooseRun(&config, tt.photos, tt.all, tt.restaurant)
+		if err != nil {
+			t.Errorf("%s: chooseRun() error = %v", tt.name, err)
+			continue
+		}
+		if !same(run, tt.want) || !reflect.DeepEqual(config.Restaurants, tt.restaurants) {
+			t.Errorf("%s: chose another run, or restaurants %v, want %v", tt.name, config.Restaurants, tt.restaurants)
+		}
+	}
+}
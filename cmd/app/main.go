@@ -1,37 +1,41 @@
 package main
 
 import (
-	"flag"
 	"log"
+	"log/slog"
+	"os"
 
-	"github.com/chlab/lunch-wankdorf/internal/app"
+	"github.com/chlab/lunch-wankdorf/pkg/logging"
 )
 
-func main() {
-	// Define command line flags
-	debugMode := flag.Bool("debug", false, "Enable debug mode with detailed output files")
-	dryRun := flag.Bool("dryRun", false, "When enabled, no API calls will be made")
-	restaurantID := flag.String("restaurant", "gira", "ID of the restaurant to fetch menu from")
-	uploadToR2 := flag.Bool("upload", false, "Upload parsed menu to Cloudflare R2 storage")
-	photosOnly := flag.Bool("photos", false, "Only add newly published dish photos to the menu, without re-parsing it")
-	flag.Parse()
+// commands are the subcommands, named by the first argument. Without one, the
+// menus are fetched (see fetch).
+var commands = map[string]func(args []string) error{
+	"archive": archive,
+	"bench":   bench,
+	"eval":    evaluate,
+	"notify":  notify,
+	"prune":   prune,
+	"serve":   serve,
+}
 
-	// Create config for the application
-	config := app.Config{
-		DebugMode:    *debugMode,
-		DryRun:       *dryRun,
-		RestaurantID: *restaurantID,
-		UploadToR2:   *uploadToR2,
+func main() {
+	// LOG_FORMAT=json for the CI logs, which are read by machines as well
+	logger, err := logging.New(os.Stderr, os.Getenv("LOG_FORMAT"))
+	if err != nil {
+		log.Fatalf("Error: %v", err)
 	}
+	slog.SetDefault(logger.With("run", logging.RunID()))
 
-	log.Println("Starting Lunch Wankdorf application...")
-
-	run := app.Run
-	if *photosOnly {
-		run = app.RunPhotoUpdate
+	run, args := fetch, os.Args[1:]
+	if len(args) > 0 {
+		if command, ok := commands[args[0]]; ok {
+			run, args = command, args[1:]
+		}
 	}
 
-	if err := run(config); err != nil {
-		log.Fatalf("Error: %v", err)
+	if err := run(args); err != nil {
+		slog.Error("Run failed", "error", err)
+		os.Exit(1)
 	}
 }
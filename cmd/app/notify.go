@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/chlab/lunch-wankdorf/internal/app"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// notify posts today's menus to chat webhooks.
+func notify(args []string) error {
+	flag := flag.NewFlagSet("lunch-app notify", flag.ExitOnError)
+	var webhooks []string
+	flag.Func("webhook", "Webhook to post to as format=url, format being slack, teams or markdown (repeatable; NOTIFY_WEBHOOKS adds more)", func(value string) error {
+		webhooks = append(webhooks, strings.TrimSpace(value))
+		return nil
+	})
+	dryRun := flag.Bool("dryRun", false, "Print the messages in every format instead of posting them")
+	force := flag.Bool("force", false, "Post even to the webhooks that already got today's menu")
+	storageBackend := flag.String("storage", "r2", "Where the menus are read from: r2, s3 or local")
+	storageDir := flag.String("storageDir", storage.DefaultDir, "Directory of the local storage")
+	restaurantsFile := flag.String("restaurantsFile", "", "YAML or JSON file with the restaurants (default: the built-in list, or RESTAURANTS_FILE)")
+	flag.Parse(args)
+
+	return app.RunNotify(app.Config{
+		DryRun:          *dryRun,
+		Storage:         *storageBackend,
+		StorageDir:      *storageDir,
+		RestaurantsFile: *restaurantsFile,
+		Webhooks:        webhooks,
+		Force:           *force,
+	})
+}
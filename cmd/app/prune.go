@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/chlab/lunch-wankdorf/internal/app"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// prune deletes the menus of past weeks from the storage, archiving them first.
+func prune(args []string) error {
+	flag := flag.NewFlagSet("lunch-app prune", flag.ExitOnError)
+	dryRun := flag.Bool("dryRun", false, "Only list the files that would be deleted")
+	retention := flag.Duration("retention", app.DefaultRetention, "How far back the weeks that are kept go: the week of now minus this, and the ones after it")
+	archive := flag.Bool("archive", true, "Copy the menus into the archive before deleting them")
+	storageBackend := flag.String("storage", "r2", "Where the menus are: r2, s3 or local")
+	storageDir := flag.String("storageDir", storage.DefaultDir, "Directory of the local storage")
+	flag.Parse(args)
+
+	return app.RunPrune(app.Config{
+		DryRun:     *dryRun,
+		Storage:    *storageBackend,
+		StorageDir: *storageDir,
+		Retention:  *retention,
+		Archive:    *archive,
+	})
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/chlab/lunch-wankdorf/internal/app"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// serve runs the JSON API over the published menus.
+func serve(args []string) error {
+	flag := flag.NewFlagSet("lunch-app serve", flag.ExitOnError)
+	addr := flag.String("addr", ":8080", "Address to listen on")
+	corsOrigin := flag.String("corsOrigin", "*", "Origins allowed to call the API from a browser, comma-separated, or * for any")
+	storageBackend := flag.String("storage", "r2", "Where the menus are read from: r2, s3 or local")
+	storageDir := flag.String("storageDir", storage.DefaultDir, "Directory of the local storage")
+	restaurantsFile := flag.String("restaurantsFile", "", "YAML or JSON file with the restaurants (default: the built-in list, or RESTAURANTS_FILE)")
+	flag.Parse(args)
+
+	return app.Serve(app.Config{
+		Storage:         *storageBackend,
+		StorageDir:      *storageDir,
+		RestaurantsFile: *restaurantsFile,
+		Addr:            *addr,
+		CORSOrigin:      *corsOrigin,
+	})
+}
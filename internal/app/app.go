@@ -1,96 +1,85 @@
 package app
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/chlab/lunch-wankdorf/pkg/ai"
 	"github.com/chlab/lunch-wankdorf/pkg/file"
+	"github.com/chlab/lunch-wankdorf/pkg/logging"
+	"github.com/chlab/lunch-wankdorf/pkg/metrics"
 	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
 	"github.com/joho/godotenv"
 )
 
-// RestaurantMenu defines a restaurant menu source
-type RestaurantMenu struct {
-	Name             string
-	URL              string
-	BaseURL          string
-	HasCustomScraper bool   // Indicates if a custom scraping function should be used
-	MenuType         string // Type of menu: "html" or "pdf"
-	MenuSelector     string // CSS selector to find the menu link (for PDF menus)
-	GroupDishesByDay bool   // food2050 pages: derive the day from the date in each dish link
-}
-
-// Available restaurant menus
-var restaurantMenus = map[string]RestaurantMenu{
-	"gira": {
-		Name:             "Gira",
-		URL:              "https://app.food2050.ch/de/v2/zfv/sbb/gira/mittagsverpflegung/menu/weekly",
-		BaseURL:          "https://app.food2050.ch",
-		HasCustomScraper: false,
-		MenuType:         "html",
-		GroupDishesByDay: true,
-	},
-	"luna": {
-		Name:             "Luna",
-		URL:              "https://app.food2050.ch/de/v2/zfv/sbb/restaurant-luna/mittagsverpflegung/menu/weekly",
-		BaseURL:          "https://app.food2050.ch",
-		HasCustomScraper: false,
-		MenuType:         "html",
-		GroupDishesByDay: true,
-	},
-	"sole": {
-		Name:             "Sole",
-		URL:              "https://app.food2050.ch/de/v2/zfv/sbb/sole/mittagsverpflegung/menu/weekly",
-		BaseURL:          "https://app.food2050.ch",
-		HasCustomScraper: false,
-		MenuType:         "html",
-		GroupDishesByDay: true,
-	},
-	"espace": {
-		Name:             "Espace",
-		URL:              "https://sv-gastronomie.ch/menu/Post,%20Restaurant%20Espace,%20Bern/Mittagsmen%C3%BC",
-		BaseURL:          "https://sv-gastronomie.ch/menu/Post,%20Restaurant%20Espace,%20Bern/Mittagsmen%C3%BC",
-		HasCustomScraper: true,
-		MenuType:         "html",
-	},
-	"turbolama": {
-		Name:             "Turbolama",
-		URL:              "https://www.turbolama.ch/",
-		BaseURL:          "https://www.turbolama.ch/",
-		HasCustomScraper: false,
-		MenuType:         "pdf",
-		MenuSelector:     "a[aria-label=\"FOOD MENU\"]",
-	},
-	"freibank": {
-		Name: "Freibank",
-		// would need selector: div[data-hook=\"app.container\
-		URL:              "https://www.freibank.ch/speisundtrankangebot",
-		BaseURL:          "https://www.freibank.ch/",
-		HasCustomScraper: false,
-		MenuType:         "html",
-	},
-}
-
 // Config holds application configuration settings
 type Config struct {
 	DebugMode    bool   // If true, debug files will be written
 	DryRun       bool   // If true, no API calls will be made
 	RestaurantID string // ID of the restaurant to fetch menu from (defaults to "gira")
-	UploadToR2   bool   // If true, upload parsed menu to R2 storage
+	Upload       bool   // If true, upload parsed menu to the storage
+
+	Storage    string // Where menus are published: r2 (the default), s3 or local
+	StorageDir string // The directory of the local storage
+
+	RestaurantsFile string // YAML or JSON file to read the restaurants from instead of the shipped default
+	Parser          string // If set, overrides every restaurant's parser (model, rules or rules+model)
+
+	RecordDir string // If set, everything fetched (scrapes, model answers, dish pages) is recorded here
+	ReplayDir string // If set, the run replays a recording from here and fetches nothing
+
+	RequireValid bool // If true, a menu that still fails validation after the retries is not uploaded
+	UpcomingOnly bool // If true, only weeks after the current one are published, e.g. next week's on a Friday
+	Refresh      bool // If true, only the current week's days that changed since it was published are parsed again
+
+	HistoryFile   string // If set, the dish history is kept in this SQLite file rather than in the history's bucket
+	HistoryBucket string // The private bucket the dish history is kept in (see openHistoryStore)
+	ParseCacheDir string // If set, parsed days are cached in this directory (see parseCacheDir)
+
+	ReportFile  string // If set, a JSON report of the run is written here (see runReport)
+	Pushgateway string // If set, the run's metrics are pushed to the Pushgateway at this URL when it is done
+
+	PricesFile string  // YAML file with the models' prices, instead of the shipped ones (see ai.LoadPrices)
+	Budget     float64 // If set, the model is sent nothing more once the run spent this many US dollars on it
+	PromptsDir string  // Directory of prompt templates to use instead of the shipped ones (see ai.LoadPrompts)
+
+	// Batch runs only (see RunBatch)
+	Restaurants   []string      // IDs to run; empty means every enabled restaurant
+	Concurrency   int           // How many restaurants run at once
+	FailurePolicy FailurePolicy // Which failures make the batch fail
+
+	// The API server only (see Serve)
+	Addr       string // Address to listen on, e.g. ":8080"
+	CORSOrigin string // Origins browsers may call the API from: "*", or a comma-separated list
+
+	// Chat notifications only (see RunNotify)
+	Webhooks []string // Webhooks to post to, each as format=url
+	Force    bool     // If true, post even to the webhooks that already got today's menu
+
+	// Pruning only (see RunPrune)
+	Retention time.Duration // How far back the weeks at the top of the storage go
+	Archive   bool          // If true, menus are copied into the archive before they are deleted
+
+	// Benchmarking only (see RunBench)
+	Fixtures     []string // Recordings, or JSON files of what a scraper returned, to take the days from
+	Models       []string // Models to compare; empty means the one the environment names
+	Runs         int      // How often every day is parsed with each model
+	MarkdownFile string   // If set, the table is written here as well
+	CSVFile      string   // If set, the results are written here as CSV
+
+	// Evaluation only (see RunEval); it records and replays with RecordDir and ReplayDir
+	GoldenDir    string // Directory of golden menus to score against instead of the shipped ones
+	EvalFile     string // If set, the evaluation is written here as JSON
+	BaselineFile string // If set, an earlier evaluation to compare this one to
 }
 
 // Run starts the application
@@ -98,116 +87,191 @@ func Run(config Config) error {
 	// Load environment variables from .env file
 	loadEnv()
 
-	restaurantID := config.RestaurantID
-	if restaurantID == "" {
-		return fmt.Errorf("restaurant not defined")
+	restaurants, err := loadRegistry(restaurantsFile(config))
+	if err != nil {
+		return err
 	}
 
 	// Get restaurant menu configuration
-	restaurant, exists := restaurantMenus[restaurantID]
-	if !exists {
-		return fmt.Errorf("restaurant with ID '%s' not found", restaurantID)
+	restaurant, err := restaurants.lookup(config.RestaurantID)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("Processing menu for %s from %s", restaurant.Name, restaurant.URL)
-
-	// Handle different menu types (HTML or PDF)
-	switch restaurant.MenuType {
-	case "html":
-		return processHTMLMenu(restaurant, config)
-	case "pdf":
-		return processPDFMenu(restaurant, config)
-	default:
-		return fmt.Errorf("unsupported menu type: %s", restaurant.MenuType)
+	sess, err := newSession(config)
+	if err != nil {
+		return err
 	}
+	defer sess.close()
+
+	started := time.Now()
+	result := runRestaurant(restaurant, config, sess)
+	writeReport(started, []batchResult{result}, config)
+	pushMetrics([]batchResult{result}, config)
+	return result.err
 }
 
-// processHTMLMenu handles HTML-based menus
-func processHTMLMenu(restaurant RestaurantMenu, config Config) error {
-	// Fetch the restaurant menu content
-	log.Printf("Scraping HTML menu data for %s", restaurant.Name)
-	var htmlContent *scraper.MenuData
-	var err error
-
-	if restaurant.HasCustomScraper {
-		// Use custom scraper based on restaurant name
-		switch strings.ToLower(restaurant.Name) {
-		case "espace":
-			htmlContent, err = scraper.ScrapeEspaceWebsite(restaurant.URL, config.DebugMode)
-		default:
-			err = fmt.Errorf("no custom scraper found for restaurant %s", restaurant.Name)
-		}
-	} else {
-		// Use standard scraper
-		htmlContent, err = scraper.ScrapeMenuContent(restaurant.URL, config.DebugMode)
+// processRestaurant fetches, parses and publishes one restaurant's menu. It
+// returns the validation problems the published menu still has, if any.
+func processRestaurant(ctx context.Context, restaurant scraper.RestaurantMenu, config Config, sess *session) ([]string, error) {
+	slog.InfoContext(ctx, "Processing menu", "name", restaurant.Name, "url", restaurant.URL)
+
+	s, err := sess.scraper(restaurant, config.DebugMode)
+	if err != nil {
+		return nil, err
 	}
 
+	// Fetch the restaurant menu content
+	scrapeCtx, done := startStage(ctx, stageScrape)
+	slog.InfoContext(scrapeCtx, "Scraping menu data", "scraper", restaurant.Scraper)
+	menuData, err := s.Scrape(scrapeCtx, restaurant)
+	done()
 	if err != nil {
-		return fmt.Errorf("error scraping menu data: %w", err)
+		return nil, fmt.Errorf("error scraping menu data: %w", err)
 	}
 
+	// A PDF covers the week as a whole; everything else comes in days
+	if menuData.PDFURL != "" {
+		return nil, processPDFMenu(ctx, restaurant, menuData, config, sess)
+	}
+	return processHTMLMenu(ctx, restaurant, menuData, config, sess)
+}
+
+// processHTMLMenu handles HTML-based menus. Each ISO week the page covers is
+// published as a file of its own (see splitByWeek).
+//
+// It returns what validation still found wrong with the parsed menu after the
+// retries; with config.RequireValid that is an error instead, and that week is not
+// uploaded.
+func processHTMLMenu(ctx context.Context, restaurant scraper.RestaurantMenu, htmlContent *scraper.MenuData, config Config, sess *session) ([]string, error) {
 	// Save debug files if debug mode is enabled
 	if config.DebugMode {
-		htmlDebugFile, err := file.WriteToDebugFile([]byte(htmlContent.Content), "raw_html", restaurant.Name, "html")
-		if err != nil {
-			log.Printf("Warning: Could not write raw HTML to debug file: %v", err)
-		} else {
-			log.Printf("Saved raw HTML to %s", htmlDebugFile)
-		}
+		writeDebugFile(ctx, []byte(htmlContent.Content), "raw_html", restaurant.Name, "html")
 	}
 
-	// Split the week into one section per day. Espace's scraper already does this;
-	// the food2050 pages have to be grouped by the date in each dish link.
+	// The scraper has split the week into one section per day, if the site lets it
 	days := htmlContent.Days
-	if restaurant.GroupDishesByDay {
-		grouped, err := scraper.GroupMenuByDay(scraper.OptimizeHTML(htmlContent.Content))
-		if err != nil {
-			return fmt.Errorf("error grouping menu by day: %w", err)
-		}
-
-		// Without the dates we can't tell which day a dish belongs to, and neither can
-		// the model - that is the bug the grouping exists to prevent. Better to fail
-		// loudly than to upload a menu with days silently missing.
-		if len(grouped) == 0 {
-			return fmt.Errorf("found no dated dish links for %s, the page markup has probably changed", restaurant.Name)
-		}
-		days = grouped
-	}
-
 	if len(days) == 0 {
-		return fmt.Errorf("no menu content found on the page")
+		return nil, fmt.Errorf("no menu content found on the page")
 	}
 
+	cleanCtx, done := startStage(ctx, stageClean)
 	for i := range days {
-		days[i].HTML = scraper.OptimizeHTML(days[i].HTML)
+		days[i].HTML = scraper.OptimizeHTML(cleanCtx, days[i].HTML)
 	}
+	done()
 
-	log.Printf("Dishes found per day: %s", formatCounts(dishCounts(days)))
+	slog.InfoContext(ctx, "Dishes found per day", "dishes", formatCounts(dishCounts(days)))
 
 	// Save debug files if debug mode is enabled
 	if config.DebugMode {
-		menuContentDebugFile, err := file.WriteToDebugFile([]byte(joinDays(days)), "menu_content", restaurant.Name, "html")
-		if err != nil {
-			log.Printf("Warning: Could not write menu content to debug file: %v", err)
-		} else {
-			log.Printf("Saved menu content to %s", menuContentDebugFile)
-		}
+		writeDebugFile(ctx, []byte(joinDays(days)), "menu_content", restaurant.Name, "html")
 	}
 
 	// Print a sample of the content
-	logPreview(days[0].HTML)
+	logPreview(ctx, days[0].HTML)
 
 	// Abort menu parsing if dry run is enabled
 	if config.DryRun {
-		log.Println("Dry Run, aborting parsing menu...")
-		return nil
+		slog.InfoContext(ctx, "Dry Run, aborting parsing menu...")
+		return nil, nil
+	}
+
+	weeks, err := splitByWeek(days, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if config.UpcomingOnly {
+		weeks = upcomingWeeks(weeks, weekOf(time.Now()))
+		if len(weeks) == 0 {
+			slog.InfoContext(ctx, "Next week's menu is not online yet, nothing to do")
+			return nil, nil
+		}
+	}
+	if config.Refresh {
+		weeks = currentWeek(weeks, weekOf(time.Now()))
+		if len(weeks) == 0 {
+			slog.InfoContext(ctx, "The page has nothing for this week, nothing to refresh")
+			return nil, nil
+		}
+	}
+
+	mode, err := parseModeFor(restaurant, config)
+	if err != nil {
+		return nil, err
+	}
+	if mode != parseModel && !listsDishes(days) {
+		return nil, fmt.Errorf("the %s scraper doesn't list dishes one by one, so the %s parser can't be used", restaurant.Scraper, mode)
+	}
+
+	var parser *ai.Parser
+	if mode != parseRules {
+		parser, err = sess.getParser()
+		switch {
+		case err != nil && mode == parseModel:
+			return nil, err
+		case err != nil:
+			// The model only enriches these menus, so they don't need one
+			slog.WarnContext(ctx, "No model to enrich the menu with, using the page's own dish list", "error", err)
+			mode = parseRules
+		default:
+			if parser, err = parser.ForRestaurant(restaurant.Prompt); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var problems []string
+	var errs []error
+	for _, week := range weeks {
+		weekProblems, err := publishWeek(ctx, restaurant, week, parser, mode, config, sess)
+		if len(weeks) > 1 {
+			for i, problem := range weekProblems {
+				weekProblems[i] = fmt.Sprintf("week %d, %s", week.week.week, problem)
+			}
+			if err != nil {
+				err = fmt.Errorf("%s: %w", week.week, err)
+			}
+		}
+		problems = append(problems, weekProblems...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return problems, errors.Join(errs...)
+}
+
+// publishWeek parses, completes and publishes one week of a restaurant's menu.
+func publishWeek(ctx context.Context, restaurant scraper.RestaurantMenu, week weekMenu, parser *ai.Parser, mode parseMode, config Config, sess *session) ([]string, error) {
+	ctx = logging.With(ctx, "week", week.week.String())
+	days := week.days
+
+	// A refresh only parses the days that changed since the week was published
+	var published *ai.DailyMenu
+	var gone []string
+	if config.Refresh {
+		var err error
+		published, days, gone, err = changedDays(ctx, restaurant, week, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare the page to the published menu: %w", err)
+		}
+		if published != nil && len(days) == 0 && len(gone) == 0 {
+			slog.InfoContext(ctx, "The menu hasn't changed, nothing to do")
+			return nil, nil
+		}
 	}
 
-	// Parse menu using OpenAI
-	log.Println("Parsing menu data with OpenAI...")
-	menu, err := parseWeek(days)
+	parseCtx, done := startStage(ctx, stageParse)
+	if mode == parseRules {
+		slog.InfoContext(parseCtx, "Building the menu from the page's own dish list...")
+	} else {
+		slog.InfoContext(parseCtx, "Parsing menu data...", "model", parser.Model(), "parser", mode)
+	}
+	menu, problems, err := parseWeek(parseCtx, parser, days, mode, sess.cache)
+	done()
 	if err != nil {
-		return fmt.Errorf("error parsing menu data: %w", err)
+		return nil, fmt.Errorf("error parsing menu data: %w", err)
 	}
 
 	// Add base URL to relative links
@@ -217,74 +281,146 @@ func processHTMLMenu(restaurant RestaurantMenu, config Config) error {
 	// find its URL. Whatever it could not open falls back to the day's menu page.
 	addDishLinks(menu, days)
 
+	// The dishes that stay keep the photos they were published with
+	if published != nil {
+		keepPhotos(menu, published)
+	}
+
 	// Dish photos, where the restaurant has them. Espace only publishes a day's
 	// photos on the morning of that day, so the rest of its week is filled in later
 	// by the photo job (see RunPhotoUpdate).
-	addPhotos(menu, days)
+	photosCtx, done := startStage(ctx, stagePhotos)
+	addPhotos(photosCtx, menu, days, sess.httpClient(photoFetchTimeout))
+	done()
+
+	spent := menu.Days
+	menu.MenuMeta = menuMeta(restaurant, week.week, parser, mode)
+	menu.Days = make(map[string]ai.DayMeta, len(days))
+	for _, day := range days {
+		meta := dayMeta(day)
+		meta.Usage = spent[capitalize(day.Day)].Usage
+		menu.Days[capitalize(day.Day)] = meta
+	}
+	if published != nil {
+		menu = mergeDays(published, menu, gone)
+	}
+	menu.Usage = daysUsage(menu.Days)
+
+	if len(problems) > 0 {
+		slog.WarnContext(ctx, "The menu failed validation", "problems", problems)
+		if config.RequireValid {
+			// Still printed (and written to debug/), so it can be looked at
+			config.Upload = false
+			if err := outputAndUpload(ctx, menu, config); err != nil {
+				return problems, err
+			}
+			return problems, fmt.Errorf("the menu failed validation with %d problems and was not uploaded", len(problems))
+		}
+	}
 
-	return outputAndUpload(menu, restaurant.Name, config)
+	return problems, outputAndUpload(ctx, menu, config)
 }
 
 // parseWeek parses every day on its own, in parallel. Days are independent, so a
 // day that comes back short can be retried without redoing the rest of the week.
-func parseWeek(days []scraper.DayMenu) (*ai.DailyMenu, error) {
+// Besides the menu, whose Days only have what each day took from the model so far,
+// it returns the validation problems that are left, each prefixed with its day.
+func parseWeek(ctx context.Context, parser *ai.Parser, days []scraper.DayMenu, mode parseMode, cache *parseCache) (*ai.DailyMenu, []string, error) {
 	menu := &ai.DailyMenu{
-		Type: "daily",
-		Menu: make(map[string][]ai.MenuItem, len(days)),
+		Type:     "daily",
+		MenuMeta: ai.MenuMeta{Days: make(map[string]ai.DayMeta, len(days))},
+		Menu:     make(map[string][]ai.MenuItem, len(days)),
 	}
 
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 	errs := make([]error, len(days))
+	problems := make([][]string, len(days))
 
 	for i, day := range days {
 		wg.Add(1)
 		go func(i int, day scraper.DayMenu) {
 			defer wg.Done()
 
-			items, err := parseDayWithRetry(day)
+			ctx, tally := ai.WithTally(logging.With(ctx, "day", day.Day))
+			start := time.Now()
+			items, invalid, err := parseDay(ctx, parser, day, mode, cache)
+			slog.InfoContext(ctx, "Parsed day", "duration", time.Since(start), "dishes", len(items), "problems", len(invalid))
 			if err != nil {
 				errs[i] = err
 				return
 			}
+			for _, problem := range invalid {
+				problems[i] = append(problems[i], day.Day+": "+problem)
+			}
 
 			mu.Lock()
 			defer mu.Unlock()
 			menu.Menu[capitalize(day.Day)] = items
+			menu.Days[capitalize(day.Day)] = ai.DayMeta{Usage: tally.Spend()}
 		}(i, day)
 	}
 	wg.Wait()
 
-	return menu, errors.Join(errs...)
+	var remaining []string
+	for _, dayProblems := range problems {
+		remaining = append(remaining, dayProblems...)
+	}
+	return menu, remaining, errors.Join(errs...)
 }
 
-// parseDayWithRetry parses one day and checks the result against the dishes the
-// page actually offered, retrying once if the model left something behind.
-func parseDayWithRetry(day scraper.DayMenu) ([]ai.MenuItem, error) {
+// parseDayWithRetry parses one day and validates the result against what the page
+// actually offered (see validateDay). If the model left something behind or made
+// something up, the day is retried once, with the problems spelled out for it. It
+// returns the problems that are left after the last attempt.
+//
+// A day the cache has is taken from there, and a day that passes is put there
+// (see parseCache).
+func parseDayWithRetry(ctx context.Context, parser *ai.Parser, day scraper.DayMenu, cache *parseCache) ([]ai.MenuItem, []string, error) {
 	const attempts = 2
 
+	if items, ok := cache.get(ctx, parser, day); ok {
+		slog.InfoContext(ctx, "The day hasn't changed since it was parsed last, using that")
+		return items, nil, nil
+	}
+
 	var items []ai.MenuItem
+	var problems []string
 	for attempt := 1; attempt <= attempts; attempt++ {
-		parsed, err := ai.ParseDayMenu(day.Day, day.HTML)
+		parsed, err := parser.ParseDayMenu(ctx, day.Day, day.HTML, problems...)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		items = parsed
 
-		if len(items) >= day.Dishes {
-			return items, nil
+		problems = validateDay(day, items)
+		if len(problems) == 0 {
+			cache.put(ctx, parser, day, items)
+			countParsedDishes(ctx, day, items)
+			return items, nil, nil
 		}
 
 		if attempt < attempts {
-			log.Printf("Warning: %s came back with %d of %d dishes, retrying...",
-				day.Day, len(items), day.Dishes)
+			metrics.ParseRetries.WithLabelValues(restaurantOf(ctx)).Inc()
+			slog.WarnContext(ctx, "The day failed validation, retrying", "problems", problems)
 		} else {
-			log.Printf("Warning: %s still has %d of %d dishes after %d attempts, using it anyway",
-				day.Day, len(items), day.Dishes, attempts)
+			slog.WarnContext(ctx, "The day still fails validation, using it anyway", "attempts", attempts)
 		}
 	}
 
-	return items, nil
+	countParsedDishes(ctx, day, items)
+	return items, problems, nil
+}
+
+// countParsedDishes adds a day the model parsed to the metrics: the dishes the page
+// listed, and the dishes the model returned.
+func countParsedDishes(ctx context.Context, day scraper.DayMenu, items []ai.MenuItem) {
+	restaurant := restaurantOf(ctx)
+	metrics.DishesOnPage.WithLabelValues(restaurant).Add(float64(day.Dishes))
+	metrics.DishesParsed.WithLabelValues(restaurant).Add(float64(len(items)))
+	if len(items) < day.Dishes {
+		metrics.ShortDays.WithLabelValues(restaurant).Inc()
+	}
 }
 
 func dishCounts(days []scraper.DayMenu) map[string]int {
@@ -322,77 +458,48 @@ func formatCounts(counts map[string]int) string {
 }
 
 // processPDFMenu handles PDF-based menus
-func processPDFMenu(restaurant RestaurantMenu, config Config) error {
-	if restaurant.MenuSelector == "" {
-		return fmt.Errorf("MenuSelector is required for PDF menu restaurants but not configured for %s", restaurant.Name)
-	}
-
-	log.Printf("Fetching PDF menu for %s", restaurant.Name)
-	log.Printf("Looking for menu link with selector: %s", restaurant.MenuSelector)
-
-	// Fetch the PDF menu URL using the selector
-	pdfURL, err := scraper.FetchPDFMenuURL(restaurant.URL, restaurant.MenuSelector)
-	if err != nil {
-		return fmt.Errorf("error fetching PDF URL: %w", err)
-	}
-
-	var pdfFilePath string
+func processPDFMenu(ctx context.Context, restaurant scraper.RestaurantMenu, menuData *scraper.MenuData, config Config, sess *session) error {
+	pdfText, pdfURL := menuData.Content, menuData.PDFURL
 
+	// Save extracted text to debug file if debug mode is enabled
 	if config.DebugMode {
-		// In debug mode, save the PDF to the debug directory
-		pdfFilePath = filepath.Join("debug", fmt.Sprintf("%s_menu.pdf",
-			strings.ToLower(restaurant.Name)))
-		log.Printf("Debug mode: Saving PDF to %s", pdfFilePath)
-	} else {
-		// In production mode, save to a temporary directory
-		tempDir, err := os.MkdirTemp("", "menu-pdf")
-		if err != nil {
-			return fmt.Errorf("error creating temporary directory: %w", err)
-		}
-		defer os.RemoveAll(tempDir)
-
-		pdfFilePath = filepath.Join(tempDir, fmt.Sprintf("%s_menu.pdf",
-			strings.ToLower(restaurant.Name)))
+		writeDebugFile(ctx, []byte(pdfText), "extracted_text", restaurant.Name, "txt")
 	}
 
-	// Download the PDF file
-	if err := scraper.DownloadPDF(pdfURL, pdfFilePath); err != nil {
-		return fmt.Errorf("error downloading PDF: %w", err)
-	}
-
-	log.Printf("Successfully downloaded PDF menu for %s", restaurant.Name)
-
 	// Abort menu parsing if dry run is enabled
 	if config.DryRun {
-		log.Println("Dry Run, aborting parsing menu...")
+		slog.InfoContext(ctx, "Dry Run, aborting parsing menu...")
 		return nil
 	}
 
-	// Extract text from PDF
-	log.Println("Extracting text from PDF...")
-	pdfText, err := scraper.ExtractTextFromPDF(pdfFilePath, 1) // Extract only first page
-	if err != nil {
-		return fmt.Errorf("error extracting text from PDF: %w", err)
+	// A PDF is the week as a whole, with no days to refresh on their own
+	if config.Refresh {
+		slog.InfoContext(ctx, "The menu is a PDF for the whole week, nothing to refresh")
+		return nil
 	}
 
-	// Save extracted text to debug file if debug mode is enabled
-	if config.DebugMode {
-		textDebugFile, err := file.WriteToDebugFile([]byte(pdfText), "extracted_text", restaurant.Name, "txt")
-		if err != nil {
-			log.Printf("Warning: Could not write extracted PDF text to debug file: %v", err)
-		} else {
-			log.Printf("Saved extracted PDF text to %s", textDebugFile)
-		}
+	parser, err := sess.getParser()
+	if err != nil {
+		return err
+	}
+	if parser, err = parser.ForRestaurant(restaurant.Prompt); err != nil {
+		return err
 	}
 
-	// Parse PDF menu using OpenAI
-	log.Println("Parsing PDF menu data with OpenAI...")
-	menu, err := ai.ParseRestaurantPdfMenu(pdfText, restaurant.Name, pdfURL)
+	// Parse PDF menu using the model
+	parseCtx, done := startStage(ctx, stageParse)
+	parseCtx, tally := ai.WithTally(parseCtx)
+	slog.InfoContext(parseCtx, "Parsing PDF menu data...", "model", parser.Model())
+	menu, err := parser.ParseRestaurantPdfMenu(parseCtx, pdfText, restaurant.Name, pdfURL)
+	done()
 	if err != nil {
 		return fmt.Errorf("error parsing PDF menu data: %w", err)
 	}
 
-	return outputAndUpload(menu, restaurant.Name, config)
+	// A PDF carries no dates we could read the week from
+	menu.MenuMeta = menuMeta(restaurant, weekOf(time.Now()), parser, parseModel)
+	menu.Usage = tally.Spend()
+	return outputAndUpload(ctx, menu, config)
 }
 
 // processMenuLinks adds the restaurant's base URL to relative links in the menu
@@ -406,40 +513,82 @@ func processMenuLinks(menu *ai.DailyMenu, baseURL string) {
 	}
 }
 
-func logPreview(content string) {
+func logPreview(ctx context.Context, content string) {
 	if len(content) > 500 {
 		content = content[:500] + "..."
 	}
-	log.Println("Menu Content Sample:")
-	log.Println("=============")
-	log.Println(content)
-	log.Println("=============")
+	slog.InfoContext(ctx, "Menu content sample", "sample", content)
+}
+
+// writeDebugFile writes one of the intermediate results to debug/. It is there to
+// be looked at, so failing to write it is only a warning.
+func writeDebugFile(ctx context.Context, data []byte, label, restaurantName, extension string) {
+	path, err := file.WriteToDebugFile(data, label, restaurantName, extension)
+	if err != nil {
+		slog.WarnContext(ctx, "Could not write the debug file", "label", label, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "Saved the debug file", "label", label, "file", path)
 }
 
-// outputAndUpload marshals the menu once, then writes debug files, prints output,
-// and uploads to R2 as needed.
-func outputAndUpload(menu any, restaurantName string, config Config) error {
+// publishedMenu is a daily or weekly menu, which carry their metadata the same way.
+type publishedMenu interface {
+	Metadata() *ai.MenuMeta
+}
+
+// menuMeta describes a menu about to be published. The time it was generated at
+// is filled in when it is written out (see outputAndUpload).
+func menuMeta(restaurant scraper.RestaurantMenu, week isoWeek, parser *ai.Parser, mode parseMode) ai.MenuMeta {
+	meta := ai.MenuMeta{
+		RestaurantID:   restaurant.ID,
+		RestaurantName: restaurant.Name,
+		Year:           week.year,
+		Week:           week.week,
+		Parser:         string(mode),
+		SourceURL:      restaurant.URL,
+	}
+	if mode != parseRules {
+		meta.Model = parser.Model()
+		meta.PromptVersion = parser.PromptVersion()
+	}
+	return meta
+}
+
+// outputAndUpload writes the menu out, stamped with the schema version and the
+// time, to stdout, debug/ and, if asked to, the storage - under the week in its
+// metadata.
+func outputAndUpload(ctx context.Context, menu publishedMenu, config Config) error {
+	ctx, done := startStage(ctx, stageUpload)
+	defer done()
+
+	meta := menu.Metadata()
+	meta.SchemaVersion = ai.MenuSchemaVersion
+	meta.GeneratedAt = time.Now().UTC().Truncate(time.Second)
+	restaurantName := meta.RestaurantName
+	week := isoWeek{year: meta.Year, week: meta.Week}
+
+	// Which dishes are new, and how often the others were served before
+	if config.Upload || config.HistoryFile != "" {
+		if err := addDishHistory(ctx, menu, week, config); err != nil {
+			slog.WarnContext(ctx, "Failed to update the dish history", "error", err)
+		}
+	}
+
 	menuJSON, err := json.MarshalIndent(menu, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal menu: %w", err)
 	}
 
 	if config.DebugMode {
-		parsedMenuDebugFile, err := file.WriteToDebugFile(menuJSON, "parsed_menu", restaurantName, "json")
-		if err != nil {
-			log.Printf("Warning: Could not write parsed menu to debug file: %v", err)
-		} else {
-			log.Printf("Saved parsed menu to %s", parsedMenuDebugFile)
-		}
+		label := fmt.Sprintf("parsed_menu_%d_%d", week.week, week.year)
+		writeDebugFile(ctx, menuJSON, label, restaurantName, "json")
 	}
 
 	fmt.Println(string(menuJSON))
 
-	if config.UploadToR2 {
-		if err := uploadMenuToR2(menuJSON, restaurantName); err != nil {
-			log.Printf("Warning: Failed to upload menu to R2: %v", err)
-		} else {
-			log.Println("Successfully uploaded menu to R2 storage")
+	if config.Upload {
+		if err := uploadMenu(ctx, menuJSON, restaurantName, week, config); err != nil {
+			slog.WarnContext(ctx, "Failed to upload menu", "error", err)
 		}
 	}
 
@@ -451,7 +600,7 @@ func loadEnv() {
 	// Try to find .env file in current directory or parent directories
 	dir, err := os.Getwd()
 	if err != nil {
-		log.Println("Warning: Could not determine current directory:", err)
+		slog.Warn("Could not determine current directory", "error", err)
 		return
 	}
 
@@ -461,9 +610,9 @@ func loadEnv() {
 		if _, err := os.Stat(envFile); err == nil {
 			err = godotenv.Load(envFile)
 			if err != nil {
-				log.Println("Warning: Error loading .env file:", err)
+				slog.Warn("Error loading .env file", "error", err)
 			} else {
-				log.Println("Loaded environment from", envFile)
+				slog.Info("Loaded environment", "file", envFile)
 			}
 			return
 		}
@@ -475,81 +624,55 @@ func loadEnv() {
 		dir = parentDir
 	}
 
-	log.Println("No .env file found, using environment variables if set")
-}
-
-// menuBucket talks to the R2 bucket the menus are published to.
-type menuBucket struct {
-	client *s3.Client
-	name   string
+	slog.Info("No .env file found, using environment variables if set")
 }
 
-func openMenuBucket() (*menuBucket, error) {
-	accountID := os.Getenv("CLOUDFLARE_ACCOUNT_ID")
-	accessKeyID := os.Getenv("CLOUDFLARE_ACCESS_KEY_ID")
-	secretAccessKey := os.Getenv("CLOUDFLARE_SECRET_ACCESS_KEY")
-	bucketName := os.Getenv("CLOUDFLARE_BUCKET_NAME")
-
-	if accountID == "" || accessKeyID == "" || secretAccessKey == "" || bucketName == "" {
-		return nil, fmt.Errorf("missing required Cloudflare R2 credentials in environment variables")
-	}
-
-	endpoint := fmt.Sprintf("https://%s.eu.r2.cloudflarestorage.com", accountID)
-	client := s3.New(s3.Options{
-		BaseEndpoint: aws.String(endpoint),
-		Region:       "auto",
-		Credentials:  credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, ""),
-		UsePathStyle: true,
-	})
-
-	return &menuBucket{client: client, name: bucketName}, nil
+// openStore opens the storage the menus are published to, as -storage says.
+func openStore(config Config) (storage.Store, error) {
+	return storage.Open(config.Storage, config.StorageDir)
 }
 
-// menuFilename is <restaurantname>_<weeknumber>_<year>.json, for the current ISO
-// week. The frontend builds the same name to fetch it.
-func menuFilename(restaurantName string) string {
-	year, week := time.Now().ISOWeek()
-	return fmt.Sprintf("%s_%d_%d.json", strings.ToLower(restaurantName), week, year)
+// menuFilename is <restaurantname>_<weeknumber>_<year>.json, for the ISO week the
+// menu is served in. The frontend builds the same name to fetch it.
+func menuFilename(restaurantName string, week isoWeek) string {
+	return fmt.Sprintf("%s_%d_%d.json", strings.ToLower(restaurantName), week.week, week.year)
 }
 
-func (b *menuBucket) get(restaurantName string) ([]byte, error) {
-	filename := menuFilename(restaurantName)
-	out, err := b.client.GetObject(context.Background(), &s3.GetObjectInput{
-		Bucket: aws.String(b.name),
-		Key:    aws.String(filename),
-	})
+// uploadMenu publishes the menu JSON to the storage, with a copy in the archive and
+// its calendars and feed entries next to it
+func uploadMenu(ctx context.Context, menuJSON []byte, restaurantName string, week isoWeek, config Config) error {
+	store, err := openStore(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download %s from R2: %w", filename, err)
+		return err
 	}
-	defer out.Body.Close()
 
-	menuJSON, err := io.ReadAll(out.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	filename := menuFilename(restaurantName, week)
+	if err := store.Put(ctx, filename, menuJSON); err != nil {
+		return err
 	}
-	return menuJSON, nil
-}
+	slog.InfoContext(ctx, "Published the menu", "file", filename, "storage", store.String())
 
-func (b *menuBucket) put(restaurantName string, menuJSON []byte) error {
-	filename := menuFilename(restaurantName)
-	contentType := "application/json"
-	_, err := b.client.PutObject(context.Background(), &s3.PutObjectInput{
-		Bucket:      aws.String(b.name),
-		Key:         aws.String(filename),
-		Body:        bytes.NewReader(menuJSON),
-		ContentType: &contentType,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to upload %s to R2: %w", filename, err)
+	if err := archiveMenu(ctx, store, restaurantName, week, menuJSON); err != nil {
+		slog.WarnContext(ctx, "Failed to archive the menu", "error", err)
 	}
-	return nil
-}
 
-// uploadMenuToR2 uploads the menu JSON to Cloudflare R2 storage
-func uploadMenuToR2(menuJSON []byte, restaurantName string) error {
-	bucket, err := openMenuBucket()
+	// The same menu for calendar apps (see publishCalendars)
+	if err := publishCalendars(ctx, store, menuJSON); err != nil {
+		slog.WarnContext(ctx, "Failed to publish the calendar", "error", err)
+	}
+
+	// And for feed readers
+	var meta ai.MenuMeta
+	if err := json.Unmarshal(menuJSON, &meta); err != nil {
+		return fmt.Errorf("failed to read the menu back: %w", err)
+	}
+	restaurants, err := loadRegistry(restaurantsFile(config))
 	if err != nil {
 		return err
 	}
-	return bucket.put(restaurantName, menuJSON)
+	restaurant := scraper.RestaurantMenu{ID: meta.RestaurantID, Name: restaurantName, URL: meta.SourceURL}
+	if err := publishFeed(ctx, store, restaurants, restaurant, week, menuJSON, time.Now()); err != nil {
+		slog.WarnContext(ctx, "Failed to publish the feed", "error", err)
+	}
+	return nil
 }
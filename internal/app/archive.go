@@ -0,0 +1,252 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// The archive keeps every week's menus after the top of the storage, which the
+// frontend reads, has moved on: archive/<year>/<week>/<restaurantname>.json, with
+// archive/index.json listing the weeks there are for each restaurant.
+const (
+	archivePrefix        = "archive/"
+	archiveIndexFilename = archivePrefix + "index.json"
+)
+
+func archiveFilename(restaurantName string, week isoWeek) string {
+	return fmt.Sprintf("%s%d/%d/%s.json", archivePrefix, week.year, week.week, strings.ToLower(restaurantName))
+}
+
+var (
+	menuFilenamePattern    = regexp.MustCompile(`^([^/]+)_(\d{1,2})_(\d{4})\.json$`)
+	archiveFilenamePattern = regexp.MustCompile(`^archive/(\d{4})/(\d{1,2})/([^/]+)\.json$`)
+)
+
+// parseMenuFilename reads the restaurant and week back out of a menu's name (see
+// menuFilename). It reports false for anything else, including weeks the year
+// doesn't have.
+func parseMenuFilename(name string) (string, isoWeek, bool) {
+	match := menuFilenamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return "", isoWeek{}, false
+	}
+	week, err := parseISOWeek(match[3] + "-W" + match[2])
+	if err != nil {
+		return "", isoWeek{}, false
+	}
+	return match[1], week, true
+}
+
+// parseArchiveFilename is parseMenuFilename for the archive.
+func parseArchiveFilename(name string) (string, isoWeek, bool) {
+	match := archiveFilenamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return "", isoWeek{}, false
+	}
+	week, err := parseISOWeek(match[1] + "-W" + match[2])
+	if err != nil {
+		return "", isoWeek{}, false
+	}
+	return match[3], week, true
+}
+
+// archiveMenu keeps a copy of a menu that was just published in the archive. The
+// copy is updated along with the menu, e.g. when photos are added to it, so the
+// archive always has the week as it was last published.
+//
+// The index is only rewritten for a week it doesn't list yet, which is once a
+// week per restaurant: a menu published again that week, e.g. with its photos,
+// is already in it.
+func archiveMenu(ctx context.Context, store storage.Store, restaurantName string, week isoWeek, menuJSON []byte) error {
+	filename := archiveFilename(restaurantName, week)
+	if err := store.Put(ctx, filename, menuJSON); err != nil {
+		return err
+	}
+	indexed, err := archiveIndexLists(ctx, store, filename)
+	if err != nil || indexed {
+		return err
+	}
+	return writeArchiveIndex(ctx, store)
+}
+
+// archiveIndex lists the archived weeks by restaurant, as the restaurant is named
+// in the file names ("gira"), newest first.
+type archiveIndex struct {
+	Updated     time.Time                 `json:"updated"`
+	Restaurants map[string][]archivedWeek `json:"restaurants"`
+}
+
+type archivedWeek struct {
+	Year int    `json:"year"`
+	Week int    `json:"week"`
+	File string `json:"file"`
+}
+
+// archiveIndexLists reports whether the archive index has the archived file.
+func archiveIndexLists(ctx context.Context, store storage.Store, filename string) (bool, error) {
+	data, err := store.Get(ctx, archiveIndexFilename)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var index archiveIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		// Rewritten from the archive, like one that isn't there
+		return false, nil
+	}
+	for _, weeks := range index.Restaurants {
+		for _, week := range weeks {
+			if week.File == filename {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// writeArchiveIndex lists the archive and writes what is there as its index.
+// Listing it every time, rather than adding to the index that is there, keeps
+// runs that archive at the same time from dropping each other's weeks: the last
+// one to write has seen them all.
+func writeArchiveIndex(ctx context.Context, store storage.Store) error {
+	objects, err := store.List(ctx, archivePrefix)
+	if err != nil {
+		return err
+	}
+
+	index := archiveIndex{
+		Updated:     time.Now().UTC().Truncate(time.Second),
+		Restaurants: make(map[string][]archivedWeek),
+	}
+	for _, object := range objects {
+		restaurant, week, ok := parseArchiveFilename(object.Name)
+		if !ok {
+			continue
+		}
+		index.Restaurants[restaurant] = append(index.Restaurants[restaurant], archivedWeek{Year: week.year, Week: week.week, File: object.Name})
+	}
+	for _, weeks := range index.Restaurants {
+		sort.Slice(weeks, func(i, j int) bool {
+			return isoWeek{weeks[j].Year, weeks[j].Week}.before(isoWeek{weeks[i].Year, weeks[i].Week})
+		})
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to write the archive index: %w", err)
+	}
+	return store.Put(ctx, archiveIndexFilename, data)
+}
+
+// RunArchive copies every published menu the archive doesn't have yet, or has an
+// older version of, into the archive and rebuilds its index. Menus are archived
+// as they are published, so this is for the ones from before that, and for an
+// index that needs rebuilding.
+func RunArchive(config Config) error {
+	// Load environment variables from .env file
+	loadEnv()
+
+	restaurants, err := loadRegistry(restaurantsFile(config))
+	if err != nil {
+		return err
+	}
+	store, err := openStore(config)
+	if err != nil {
+		return err
+	}
+	_, err = archiveAll(context.Background(), store, restaurants, config.DryRun)
+	return err
+}
+
+// listMenus lists the published menus of the restaurants in the registry, by
+// their names, rather than everything in the storage.
+func listMenus(ctx context.Context, store storage.Store, restaurants registry) ([]storage.Object, error) {
+	var menus []storage.Object
+	for _, restaurant := range restaurants {
+		name := strings.ToLower(restaurant.Name)
+		objects, err := store.List(ctx, name+"_")
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			if isMenuOf(restaurant.Name, object.Name) {
+				menus = append(menus, object)
+			}
+		}
+	}
+	sort.Slice(menus, func(i, j int) bool { return menus[i].Name < menus[j].Name })
+	return menus, nil
+}
+
+// isMenuOf reports whether filename is one of the menus of the restaurant named
+// restaurantName.
+func isMenuOf(restaurantName, filename string) bool {
+	name, _, ok := parseMenuFilename(filename)
+	return ok && name == strings.ToLower(restaurantName)
+}
+
+// archiveAll archives the menus of the restaurants in the registry (see
+// listMenus) and returns how many it archived.
+func archiveAll(ctx context.Context, store storage.Store, restaurants registry, dryRun bool) (int, error) {
+	objects, err := listMenus(ctx, store, restaurants)
+	if err != nil {
+		return 0, err
+	}
+
+	archived := 0
+	var errs []error
+	for _, object := range objects {
+		restaurant, week, ok := parseMenuFilename(object.Name)
+		if !ok {
+			continue
+		}
+		target := archiveFilename(restaurant, week)
+
+		menuJSON, err := store.Get(ctx, object.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		existing, err := store.Get(ctx, target)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			errs = append(errs, err)
+			continue
+		}
+		if bytes.Equal(existing, menuJSON) {
+			continue
+		}
+
+		if dryRun {
+			slog.InfoContext(ctx, "Would archive the menu", "file", object.Name, "archive", target)
+		} else {
+			if err := store.Put(ctx, target, menuJSON); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			slog.InfoContext(ctx, "Archived the menu", "file", object.Name, "archive", target)
+		}
+		archived++
+	}
+
+	if dryRun {
+		slog.InfoContext(ctx, "Would archive menus (dry run, nothing was written)", "menus", archived)
+		return archived, errors.Join(errs...)
+	}
+	if err := writeArchiveIndex(ctx, store); err != nil {
+		errs = append(errs, err)
+	}
+	slog.InfoContext(ctx, "Archived menus", "menus", archived, "storage", store.String())
+	return archived, errors.Join(errs...)
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+func TestParseMenuFilename(t *testing.T) {
+	tests := []struct {
+		name       string
+		restaurant string
+		week       isoWeek
+		ok         bool
+	}{
+		{"gira_29_2026.json", "gira", isoWeek{2026, 29}, true},
+		{"espace_1_2027.json", "espace", isoWeek{2027, 1}, true},
+		{"luna_53_2026.json", "luna", isoWeek{2026, 53}, true},
+		{"luna_53_2025.json", "", isoWeek{}, false}, // 2025 has 52 weeks
+		{"gira_0_2026.json", "", isoWeek{}, false},
+		{"gira_29_2026.ics", "", isoWeek{}, false},
+		{"gira.json", "", isoWeek{}, false},
+		{"notified_2026-07-17.json", "", isoWeek{}, false},
+		{"archive/2026/29/gira.json", "", isoWeek{}, false},
+	}
+	for _, tt := range tests {
+		restaurant, week, ok := parseMenuFilename(tt.name)
+		if restaurant != tt.restaurant || week != tt.week || ok != tt.ok {
+			t.Errorf("parseMenuFilename(%q) = %q, %v, %v, want %q, %v, %v", tt.name, restaurant, week, ok, tt.restaurant, tt.week, tt.ok)
+		}
+	}
+
+	if restaurant, week, ok := parseArchiveFilename(archiveFilename("Gira", isoWeek{2026, 29})); restaurant != "gira" || week != (isoWeek{2026, 29}) || !ok {
+		t.Errorf("parseArchiveFilename(archiveFilename()) = %q, %v, %v", restaurant, week, ok)
+	}
+}
+
+func TestArchiveAll(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"gira_52_2025.json":   `{"type":"daily"}`,
+		"gira_1_2026.json":    `{"type":"daily"}`,
+		"gira_29_2026.json":   `{"type":"daily"}`,
+		"luna_29_2026.json":   `{"type":"weekly"}`,
+		"gira_29_2026.ics":    "BEGIN:VCALENDAR",
+		"restaurants.json":    `[]`,
+		"menus.atom":          "<feed/>",
+		"gira_60_2026.json":   `{}`,
+		"notified_2026.json":  `{}`,
+		"closed_29_2026.json": `{"type":"daily"}`,
+	} {
+		if err := store.Put(ctx, name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the menus of the restaurants in the registry are looked at
+	restaurants := registry{"gira": {Name: "Gira"}, "luna": {Name: "Luna"}}
+	archive := func(dryRun bool) (int, error) {
+		return archiveAll(ctx, store, restaurants, dryRun)
+	}
+
+	if archived, err := archive(true); archived != 4 || err != nil {
+		t.Fatalf("archiveAll(dry run) = %d, %v, want 4", archived, err)
+	}
+	if objects, _ := store.List(ctx, archivePrefix); len(objects) != 0 {
+		t.Fatalf("the dry run wrote %v", objects)
+	}
+
+	if archived, err := archive(false); archived != 4 || err != nil {
+		t.Fatalf("archiveAll() = %d, %v, want 4", archived, err)
+	}
+	data, err := store.Get(ctx, archiveIndexFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index archiveIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]archivedWeek{
+		"gira": {
+			{Year: 2026, Week: 29, File: "archive/2026/29/gira.json"},
+			{Year: 2026, Week: 1, File: "archive/2026/1/gira.json"},
+			{Year: 2025, Week: 52, File: "archive/2025/52/gira.json"},
+		},
+		"luna": {{Year: 2026, Week: 29, File: "archive/2026/29/luna.json"}},
+	}
+	if !reflect.DeepEqual(index.Restaurants, want) {
+		t.Errorf("index = %+v, want %+v", index.Restaurants, want)
+	}
+
+	// Only what changed since is archived again
+	if archived, err := archive(false); archived != 0 || err != nil {
+		t.Errorf("archiveAll() again = %d, %v, want 0", archived, err)
+	}
+	if err := store.Put(ctx, "gira_29_2026.json", []byte(`{"type":"daily","menu":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if archived, err := archive(false); archived != 1 || err != nil {
+		t.Errorf("archiveAll() after an update = %d, %v, want 1", archived, err)
+	}
+	if data, _ := store.Get(ctx, "archive/2026/29/gira.json"); string(data) != `{"type":"daily","menu":{}}` {
+		t.Errorf("archived %s, want the updated menu", data)
+	}
+}
+
+func TestArchiveMenuOnlyRewritesTheIndexForANewWeek(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	week := isoWeek{2026, 29}
+	if err := archiveMenu(ctx, store, "Gira", week, []byte(`{"type":"daily"}`)); err != nil {
+		t.Fatal(err)
+	}
+	index, err := store.Get(ctx, archiveIndexFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same week with its photos is archived, but the index already has it
+	if err := store.Put(ctx, archiveIndexFilename, []byte(`{"restaurants":{"gira":[{"year":2026,"week":29,"file":"archive/2026/29/gira.json"}]}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := archiveMenu(ctx, store, "Gira", week, []byte(`{"type":"daily","menu":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := store.Get(ctx, archiveIndexFilename); !strings.HasPrefix(string(data), `{"restaurants"`) {
+		t.Errorf("the index was rewritten for a week it had:\n%s", data)
+	}
+	if data, _ := store.Get(ctx, "archive/2026/29/gira.json"); string(data) != `{"type":"daily","menu":{}}` {
+		t.Errorf("archived %s, want the menu with its photos", data)
+	}
+
+	// The next week is added to it
+	if err := archiveMenu(ctx, store, "Gira", isoWeek{2026, 30}, []byte(`{"type":"daily"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := store.Get(ctx, archiveIndexFilename); bytes.Equal(data, index) || !strings.Contains(string(data), "archive/2026/30/gira.json") {
+		t.Errorf("the index doesn't have the new week:\n%s", data)
+	}
+}
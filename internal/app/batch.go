@@ -0,0 +1,208 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+)
+
+// FailurePolicy decides which failed restaurants make a batch run fail. Whatever
+// the policy, the summary at the end lists every failure.
+type FailurePolicy string
+
+const (
+	FailOnAny   FailurePolicy = "any"   // one failed restaurant fails the run
+	FailOnAll   FailurePolicy = "all"   // the run only fails if no restaurant made it
+	FailOnNever FailurePolicy = "never" // the run never fails, e.g. for a local look at the week
+)
+
+// ParseFailurePolicy reads a policy as given on the command line.
+func ParseFailurePolicy(policy string) (FailurePolicy, error) {
+	switch p := FailurePolicy(strings.ToLower(policy)); p {
+	case FailOnAny, FailOnAll, FailOnNever:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown failure policy %q, want any, all or never", policy)
+	}
+}
+
+// batchResult is how one restaurant's run went.
+type batchResult struct {
+	id       string
+	duration time.Duration
+	finished time.Time
+	err      error
+	problems []string           // what validation still found wrong with the menu
+	stages   map[string]float64 // seconds per stage (see startStage)
+	usage    ai.Spend           // what the restaurant took from the model
+}
+
+// status is ok, invalid (published, but with validation problems) or failed.
+func (r batchResult) status() string {
+	switch {
+	case r.err != nil:
+		return "failed"
+	case len(r.problems) > 0:
+		return "invalid"
+	default:
+		return "ok"
+	}
+}
+
+// RunBatch fetches several restaurants in one go: the ones in config.Restaurants,
+// or every enabled restaurant if that is empty. Restaurants run concurrently, up
+// to config.Concurrency at a time, and share one Chrome. One restaurant failing
+// does not stop the others; config.FailurePolicy decides whether it fails the run.
+func RunBatch(config Config) error {
+	loadEnv()
+
+	restaurants, err := loadRegistry(restaurantsFile(config))
+	if err != nil {
+		return err
+	}
+
+	ids, err := selectRestaurants(restaurants, config.Restaurants)
+	if err != nil {
+		return err
+	}
+
+	concurrency := config.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	slog.Info("Processing restaurants", "count", len(ids), "concurrency", concurrency, "restaurants", ids)
+
+	sess, err := newSession(config)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+
+	started := time.Now()
+	results := make([]batchResult, len(ids))
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			results[i] = runRestaurant(restaurants[id], config, sess)
+		}(i, id)
+	}
+	wg.Wait()
+
+	logSummary(results)
+	writeReport(started, results, config)
+	pushMetrics(results, config)
+
+	return checkResults(results, config.FailurePolicy)
+}
+
+// selectRestaurants resolves the IDs a batch runs. Asking for a disabled
+// restaurant by ID runs it; it is only left out of "all".
+func selectRestaurants(restaurants registry, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		var ids []string
+		for id, restaurant := range restaurants {
+			if !restaurant.Disabled {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		return ids, nil
+	}
+
+	var ids, unknown []string
+	seen := make(map[string]bool, len(requested))
+	for _, id := range requested {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if _, exists := restaurants[id]; !exists {
+			unknown = append(unknown, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	// Checked up front: a typo should not cost a whole batch of scrapes first
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("restaurants not found: %s", strings.Join(unknown, ", "))
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no restaurants given")
+	}
+	return ids, nil
+}
+
+func logSummary(results []batchResult) {
+	var succeeded int
+	for _, result := range results {
+		args := []any{"restaurant", result.id, "status", result.status(), "duration", result.duration.Round(time.Second)}
+		if result.err != nil {
+			slog.Error("Summary", append(args, "error", result.err)...)
+			continue
+		}
+		succeeded++
+		if len(result.problems) > 0 {
+			args = append(args, "problems", result.problems)
+		}
+		if result.usage.Calls > 0 {
+			args = append(args, result.usage.Attrs()...)
+		}
+		slog.Info("Summary", args...)
+	}
+	slog.Info("Restaurants succeeded", "succeeded", succeeded, "total", len(results))
+	slog.Info("Model usage", totalUsage(results).Attrs()...)
+}
+
+// totalUsage adds up what the restaurants took from the model.
+func totalUsage(results []batchResult) ai.Spend {
+	var usage ai.Spend
+	for _, result := range results {
+		usage = usage.Add(result.usage)
+	}
+	return usage
+}
+
+// checkResults applies the failure policy to the finished batch.
+func checkResults(results []batchResult, policy FailurePolicy) error {
+	var failed []string
+	for _, result := range results {
+		if result.err != nil {
+			failed = append(failed, result.id)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("%d of %d restaurants failed: %s",
+		len(failed), len(results), strings.Join(failed, ", "))
+
+	switch policy {
+	case FailOnNever:
+		return nil
+	case FailOnAll:
+		if len(failed) < len(results) {
+			return nil
+		}
+		return err
+	default:
+		return err
+	}
+}
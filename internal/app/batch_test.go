@@ -0,0 +1,66 @@
+package app
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSelectRestaurantsDefaultsToTheEnabledOnes(t *testing.T) {
+	ids, err := selectRestaurants(defaultRestaurants(t), nil)
+	if err != nil {
+		t.Fatalf("selectRestaurants() error = %v", err)
+	}
+
+	if want := []string{"espace", "gira", "luna", "sole"}; !slices.Equal(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+}
+
+func TestSelectRestaurantsRunsWhatItIsGiven(t *testing.T) {
+	// A disabled restaurant asked for by name is run; duplicates are not
+	ids, err := selectRestaurants(defaultRestaurants(t), []string{"sole", " Turbolama", "sole", ""})
+	if err != nil {
+		t.Fatalf("selectRestaurants() error = %v", err)
+	}
+
+	if want := []string{"sole", "turbolama"}; !slices.Equal(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+}
+
+func TestSelectRestaurantsRejectsUnknownIDs(t *testing.T) {
+	if _, err := selectRestaurants(defaultRestaurants(t), []string{"gira", "mensa"}); err == nil {
+		t.Error("want an error for an unknown restaurant, before anything is scraped")
+	}
+}
+
+func TestCheckResults(t *testing.T) {
+	failed := errors.New("scrape failed")
+	someFailed := []batchResult{{id: "gira"}, {id: "espace", err: failed}}
+	allFailed := []batchResult{{id: "gira", err: failed}, {id: "espace", err: failed}}
+
+	tests := []struct {
+		name    string
+		results []batchResult
+		policy  FailurePolicy
+		wantErr bool
+	}{
+		{"any, one failed", someFailed, FailOnAny, true},
+		{"all, one failed", someFailed, FailOnAll, false},
+		{"all, all failed", allFailed, FailOnAll, true},
+		{"never, all failed", allFailed, FailOnNever, false},
+		{"any, none failed", []batchResult{{id: "gira"}}, FailOnAny, false},
+		// The zero value is the strictest policy
+		{"unset, one failed", someFailed, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkResults(test.results, test.policy)
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkResults() error = %v, want error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
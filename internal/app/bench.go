@@ -0,0 +1,277 @@
+package app
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/logging"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+)
+
+// DefaultBenchRuns is how often the benchmark parses every day with each model.
+const DefaultBenchRuns = 3
+
+// benchDay is a day the benchmark parses, from one of its fixtures.
+type benchDay struct {
+	fixture string // the restaurant's recording, e.g. "gira"
+	day     scraper.DayMenu
+}
+
+// benchResult is how one model did on every day, over every run.
+type benchResult struct {
+	model    string
+	runs     int
+	days     int // days parsed, over every run
+	complete int // days with every dish the page listed
+	dishes   int // dishes the pages listed, over every run
+	lost     int // dishes the model didn't return
+	errors   int // days the model didn't answer for; their dishes are lost
+	elapsed  time.Duration
+	usage    ai.Spend
+}
+
+// RunBench parses recorded days with each of config.Models, config.Runs times, and
+// writes up how many dishes each lost and how long it took: the table in the
+// README's model notes. The days are the ones recorded with -record, or JSON files
+// holding what a scraper returned, in config.Fixtures.
+func RunBench(config Config) error {
+	loadEnv()
+
+	days, err := loadBenchDays(config.Fixtures)
+	if err != nil {
+		return err
+	}
+	if len(days) == 0 {
+		return errors.New("no days with dishes to compare against in the fixtures")
+	}
+	prices, err := ai.LoadPrices(pricesFile(config))
+	if err != nil {
+		return err
+	}
+	prompts, err := ai.LoadPrompts(promptsDir(config))
+	if err != nil {
+		return err
+	}
+
+	models := config.Models
+	if len(models) == 0 {
+		models = []string{""} // the environment's
+	}
+	var results []benchResult
+	for _, model := range models {
+		provider, err := ai.ProviderForModel(model)
+		if err != nil {
+			return err
+		}
+		parser := ai.NewParser(provider, ai.NewMeter(prices, 0)).WithPrompts(prompts)
+		results = append(results, benchmark(context.Background(), parser, days, config.Runs))
+	}
+
+	table := benchMarkdown(results)
+	fmt.Print(table)
+	if config.MarkdownFile != "" {
+		if err := os.WriteFile(config.MarkdownFile, []byte(table), 0o644); err != nil {
+			return fmt.Errorf("failed to write the table: %w", err)
+		}
+	}
+	if config.CSVFile != "" {
+		f, err := os.Create(config.CSVFile)
+		if err != nil {
+			return fmt.Errorf("failed to write the CSV: %w", err)
+		}
+		defer f.Close()
+		if err := writeBenchCSV(f, results); err != nil {
+			return fmt.Errorf("failed to write the CSV: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadBenchDays reads the days of every fixture, cleaned up as a run would before
+// the model sees them. A fixture is a recording made with -record, whose scrapes
+// are in its scrape/ directory, or a single JSON file of what a scraper returned
+// (scraper.MenuData). Days the page listed no dishes for are left out: there would
+// be nothing to compare the model's answer to.
+func loadBenchDays(fixtures []string) ([]benchDay, error) {
+	var files []string
+	for _, fixture := range fixtures {
+		info, err := os.Stat(fixture)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the fixture: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, fixture)
+			continue
+		}
+		scrapes, err := filepath.Glob(filepath.Join(fixture, "scrape", "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		if len(scrapes) == 0 {
+			return nil, fmt.Errorf("%s is not a recording, it has no scrapes", fixture)
+		}
+		files = append(files, scrapes...)
+	}
+
+	var days []benchDay
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the fixture: %w", err)
+		}
+		var menuData scraper.MenuData
+		if err := json.Unmarshal(data, &menuData); err != nil {
+			return nil, fmt.Errorf("invalid fixture %s: %w", file, err)
+		}
+		fixture := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		for _, day := range menuData.Days {
+			if day.Dishes == 0 {
+				continue
+			}
+			day.HTML = scraper.OptimizeHTML(context.Background(), day.HTML)
+			days = append(days, benchDay{fixture: fixture, day: day})
+		}
+	}
+	return days, nil
+}
+
+// benchmark parses every day with parser, runs times over. The days of a run are
+// parsed in parallel, as a run parses a week, and each only once: it is the model
+// that is measured, not the retries that make up for it.
+func benchmark(ctx context.Context, parser *ai.Parser, days []benchDay, runs int) benchResult {
+	result := benchResult{model: parser.Model(), runs: runs}
+	ctx, tally := ai.WithTally(logging.With(ctx, "model", parser.Model()))
+
+	for pass := 1; pass <= runs; pass++ {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		start := time.Now()
+		for _, day := range days {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				ctx := logging.With(ctx, "pass", pass, "fixture", day.fixture, "day", day.day.Day)
+				items, err := parser.ParseDayMenu(ctx, day.day.Day, day.day.HTML)
+				lost := day.day.Dishes
+				if err == nil {
+					lost = lostDishes(day.day, items)
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				result.days++
+				result.dishes += day.day.Dishes
+				result.lost += lost
+				switch {
+				case err != nil:
+					result.errors++
+				case lost == 0:
+					result.complete++
+				}
+			}()
+		}
+		wg.Wait()
+		elapsed := time.Since(start)
+		result.elapsed += elapsed
+		slog.InfoContext(ctx, "Benchmarked a pass", "pass", pass, "duration", elapsed)
+	}
+
+	result.usage = tally.Spend()
+	return result
+}
+
+// lostDishes is how many of the dishes the page listed for day the model didn't
+// return. For the pages that list their dishes one by one (day.Items) they are
+// counted by category, which the model copies verbatim: two dishes returned under
+// one category don't make up for the one missing under another.
+func lostDishes(day scraper.DayMenu, items []ai.MenuItem) int {
+	lost := max(day.Dishes-len(items), 0)
+	if len(day.Items) == 0 {
+		return lost
+	}
+
+	returned := make(map[string]int, len(items))
+	for _, item := range items {
+		returned[normalizeCategory(item.Category)]++
+	}
+	var missing int
+	for _, dish := range day.Items {
+		category := normalizeCategory(dish.Category)
+		if returned[category] > 0 {
+			returned[category]--
+		} else {
+			missing++
+		}
+	}
+	return max(lost, missing)
+}
+
+func normalizeCategory(category string) string {
+	return strings.ToLower(strings.Join(strings.Fields(category), " "))
+}
+
+// benchMarkdown is the results as the README's table, with the shipped default
+// model in bold.
+func benchMarkdown(results []benchResult) string {
+	var b strings.Builder
+	b.WriteString("| Model | Days complete | Dishes lost | Time |\n")
+	b.WriteString("|---|---|---|---|\n")
+	for _, result := range results {
+		cells := []string{
+			result.model,
+			fmt.Sprintf("%d/%d", result.complete, result.days),
+			"0",
+			fmt.Sprintf("%ds", int(result.elapsed.Round(time.Second).Seconds())),
+		}
+		if result.lost > 0 {
+			cells[2] = fmt.Sprintf("%d of %d", result.lost, result.dishes)
+		}
+		if result.model == ai.DefaultModel {
+			for i, cell := range cells {
+				cells[i] = "**" + cell + "**"
+			}
+			cells[0] = "**" + result.model + "** (default)"
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	return b.String()
+}
+
+// writeBenchCSV writes the results one model a row, with the counts behind the
+// table and what the model took.
+func writeBenchCSV(w io.Writer, results []benchResult) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"model", "runs", "days", "days_complete", "dishes", "dishes_lost", "errors", "seconds",
+		"input_tokens", "output_tokens", "reasoning_tokens", "cost_usd"})
+	for _, result := range results {
+		out.Write([]string{
+			result.model,
+			strconv.Itoa(result.runs),
+			strconv.Itoa(result.days),
+			strconv.Itoa(result.complete),
+			strconv.Itoa(result.dishes),
+			strconv.Itoa(result.lost),
+			strconv.Itoa(result.errors),
+			strconv.FormatFloat(roundSeconds(result.elapsed), 'f', -1, 64),
+			strconv.Itoa(result.usage.InputTokens),
+			strconv.Itoa(result.usage.OutputTokens),
+			strconv.Itoa(result.usage.ReasoningTokens),
+			strconv.FormatFloat(result.usage.CostUSD, 'f', 4, 64),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+)
+
+// listedDay is validatedDay as a page that lists its dishes one by one.
+var listedDay = func() scraper.DayMenu {
+	day := validatedDay
+	day.Items = []ai.Dish{
+		{Category: "Pasta Del Giorno", Description: "PASTA PESTO, Basilikum"},
+		{Category: "Pizza Del Giorno", Description: "PIZZA SICILIANA, Kapern"},
+	}
+	return day
+}()
+
+func TestLostDishes(t *testing.T) {
+	pasta := ai.MenuItem{Name: "Pasta Pesto", Category: "Pasta Del Giorno"}
+	pizza := ai.MenuItem{Name: "Pizza Siciliana", Category: "pizza del  giorno"}
+
+	tests := []struct {
+		name  string
+		day   scraper.DayMenu
+		items []ai.MenuItem
+		want  int
+	}{
+		{"every dish", listedDay, []ai.MenuItem{pasta, pizza}, 0},
+		{"one short", listedDay, []ai.MenuItem{pasta}, 1},
+		{"one under the wrong category", listedDay, []ai.MenuItem{pasta, pasta}, 1},
+		{"none", listedDay, nil, 2},
+		{"counted only, as the page doesn't list them", validatedDay, []ai.MenuItem{pasta, pasta}, 0},
+		{"counted only, one short", validatedDay, []ai.MenuItem{pizza}, 1},
+	}
+	for _, tt := range tests {
+		if got := lostDishes(tt.day, tt.items); got != tt.want {
+			t.Errorf("%s: lostDishes() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	// The first pass loses the pizza, the second has both
+	provider := &scriptedProvider{answers: []string{duplicatedAnswer, correctAnswer}, usage: ai.Usage{InputTokens: 900, OutputTokens: 400}}
+	parser := ai.NewParser(provider, ai.NewMeter(ai.Prices{"scripted": {Input: 1, Output: 5}}, 0))
+
+	result := benchmark(context.Background(), parser, []benchDay{{fixture: "gira", day: listedDay}}, 2)
+	if result.days != 2 || result.complete != 1 || result.dishes != 4 || result.lost != 1 || result.errors != 0 {
+		t.Errorf("result = %+v, want 1 of 2 days complete and 1 of 4 dishes lost", result)
+	}
+	if result.usage.Calls != 2 || result.usage.InputTokens != 1800 {
+		t.Errorf("result.usage = %+v, want the two calls", result.usage)
+	}
+
+	if table := benchMarkdown([]benchResult{result}); !strings.Contains(table, "| scripted | 1/2 | 1 of 4 | 0s |") {
+		t.Errorf("the table has no row for the result:\n%s", table)
+	}
+
+	var csv strings.Builder
+	if err := writeBenchCSV(&csv, []benchResult{result}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "scripted,2,2,1,4,1,0,") || !strings.HasSuffix(lines[1], ",1800,800,0,0.0058") {
+		t.Errorf("CSV =\n%s\nwant a header and the result's row", csv.String())
+	}
+}
+
+func TestLoadBenchDays(t *testing.T) {
+	// A recording, as -record leaves it
+	recording := t.TempDir()
+	menuData := scraper.MenuData{Days: []scraper.DayMenu{
+		listedDay,
+		{Day: "saturday", HTML: "<p>Closed</p>"},
+	}}
+	data, _ := json.Marshal(menuData)
+	os.MkdirAll(filepath.Join(recording, "scrape"), 0o755)
+	os.WriteFile(filepath.Join(recording, "scrape", "gira.json"), data, 0o644)
+
+	// And a scrape on its own
+	file := filepath.Join(t.TempDir(), "luna.json")
+	os.WriteFile(file, data, 0o644)
+
+	days, err := loadBenchDays([]string{recording, file})
+	if err != nil {
+		t.Fatalf("loadBenchDays() error = %v", err)
+	}
+	if len(days) != 2 || days[0].fixture != "gira" || days[1].fixture != "luna" || days[0].day.Day != "friday" {
+		t.Errorf("days = %+v, want friday from gira and luna, without the closed saturday", days)
+	}
+
+	if _, err := loadBenchDays([]string{t.TempDir()}); err == nil {
+		t.Error("loadBenchDays(a directory without scrapes) succeeded, want an error")
+	}
+}
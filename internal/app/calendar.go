@@ -0,0 +1,206 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// calendarFilename is <restaurantname>.ics, the feed a calendar app subscribes
+// to. Its name doesn't change from week to week, which a subscription needs.
+func calendarFilename(restaurantName string) string {
+	return strings.ToLower(restaurantName) + ".ics"
+}
+
+// weekCalendarFilename is the week's calendar next to its menu file:
+// <restaurantname>_<weeknumber>_<year>.ics.
+func weekCalendarFilename(restaurantName string, week isoWeek) string {
+	return strings.TrimSuffix(menuFilename(restaurantName, week), ".json") + ".ics"
+}
+
+// publishCalendars writes the menu just published as a calendar next to it, and
+// rebuilds the restaurant's feed from that week, the current one and the next,
+// whichever of them are published.
+func publishCalendars(ctx context.Context, store storage.Store, menuJSON []byte) error {
+	published := &menuFile{}
+	if err := json.Unmarshal(menuJSON, published); err != nil {
+		return fmt.Errorf("failed to read the menu back: %w", err)
+	}
+	meta := published.MenuMeta
+	week := isoWeek{year: meta.Year, week: meta.Week}
+	calendar := menuCalendar{
+		id:      meta.RestaurantID,
+		name:    meta.RestaurantName,
+		url:     meta.SourceURL,
+		updated: meta.GeneratedAt,
+	}
+
+	events := calendarEvents(published, week)
+	if err := store.Put(ctx, weekCalendarFilename(meta.RestaurantName, week), calendar.render(events)); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	feed := events
+	for _, other := range []isoWeek{weekOf(now), weekOf(now.AddDate(0, 0, 7))} {
+		if other == week {
+			continue
+		}
+		data, err := store.Get(ctx, menuFilename(meta.RestaurantName, other))
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		menu := &menuFile{}
+		if err := json.Unmarshal(data, menu); err != nil {
+			return fmt.Errorf("failed to read the menu for %s: %w", other, err)
+		}
+		feed = append(feed, calendarEvents(menu, other)...)
+	}
+
+	return store.Put(ctx, calendarFilename(meta.RestaurantName), calendar.render(feed))
+}
+
+// calendarEvent is a day's lunch at a restaurant.
+type calendarEvent struct {
+	date   string // ISO date
+	dishes []ai.MenuItem
+}
+
+// calendarEvents makes an event of every day of the menu that has dishes. A
+// weekly menu is on every weekday.
+func calendarEvents(menu *menuFile, week isoWeek) []calendarEvent {
+	var events []calendarEvent
+	for _, day := range menu.days(week) {
+		if len(day.dishes) == 0 {
+			continue
+		}
+		if day.name != "" {
+			events = append(events, calendarEvent{date: day.date, dishes: day.dishes})
+			continue
+		}
+		for _, weekday := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday} {
+			events = append(events, calendarEvent{date: week.date(weekday), dishes: day.dishes})
+		}
+	}
+	return events
+}
+
+// menuCalendar is a restaurant's menu as an iCalendar (RFC 5545).
+type menuCalendar struct {
+	id      string
+	name    string
+	url     string
+	updated time.Time
+}
+
+// render writes an all-day event per day. All-day rather than at lunchtime: the
+// menu is something to look at, and an event from 11:30 to 13:30 would show
+// everyone who subscribes as busy.
+//
+// An event's UID is the restaurant and the date, so a menu that is published
+// again replaces the day's event in the calendar rather than adding a second one.
+func (c menuCalendar) render(events []calendarEvent) []byte {
+	var ics icsWriter
+	ics.property("BEGIN", "VCALENDAR")
+	ics.property("VERSION", "2.0")
+	ics.property("PRODID", "-//lunch-wankdorf//menus//EN")
+	ics.property("CALSCALE", "GREGORIAN")
+	ics.property("METHOD", "PUBLISH")
+	ics.property("X-WR-CALNAME", icsText("Lunch at "+c.name))
+	// How often a subscribed calendar looks for changes, e.g. photos added later
+	ics.property("REFRESH-INTERVAL;VALUE=DURATION", "PT6H")
+	ics.property("X-PUBLISHED-TTL", "PT6H")
+
+	stamp := c.updated
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+	for _, event := range events {
+		date, err := time.Parse(time.DateOnly, event.date)
+		if err != nil {
+			continue
+		}
+
+		ics.property("BEGIN", "VEVENT")
+		ics.property("UID", fmt.Sprintf("%s-%s@lunch-wankdorf", c.id, event.date))
+		ics.property("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+		ics.property("DTSTART;VALUE=DATE", date.Format("20060102"))
+		ics.property("DTEND;VALUE=DATE", date.AddDate(0, 0, 1).Format("20060102"))
+		ics.property("SUMMARY", icsText(fmt.Sprintf("Lunch at %s: %s", c.name, dishNames(event.dishes))))
+		ics.property("DESCRIPTION", icsText(describeDishes(event.dishes)))
+		if c.url != "" {
+			ics.property("URL", c.url)
+		}
+		ics.property("TRANSP", "TRANSPARENT")
+		ics.property("END", "VEVENT")
+	}
+
+	ics.property("END", "VCALENDAR")
+	return []byte(ics.String())
+}
+
+func dishNames(dishes []ai.MenuItem) string {
+	names := make([]string, len(dishes))
+	for i, dish := range dishes {
+		names[i] = dish.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// describeDishes lists each dish with its type, description and link, a
+// paragraph each.
+func describeDishes(dishes []ai.MenuItem) string {
+	paragraphs := make([]string, len(dishes))
+	for i, dish := range dishes {
+		lines := []string{dish.Name}
+		if dish.Type != "" {
+			lines[0] += " (" + dish.Type + ")"
+		}
+		if dish.Description != "" {
+			lines = append(lines, dish.Description)
+		}
+		if dish.Link != "" {
+			lines = append(lines, dish.Link)
+		}
+		paragraphs[i] = strings.Join(lines, "\n")
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// icsText escapes a TEXT value: backslashes, the separators and newlines.
+func icsText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// icsWriter writes content lines, ended with CRLF and folded so that none is
+// longer than 75 octets, as calendar apps expect.
+type icsWriter struct {
+	strings.Builder
+}
+
+func (w *icsWriter) property(name, value string) {
+	line := name + ":" + value
+	limit := 75
+	for len(line) > limit {
+		// Never in the middle of a UTF-8 sequence
+		cut := limit
+		for !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// The space a continuation starts with counts towards its length
+		limit = 74
+	}
+	w.WriteString(line + "\r\n")
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// unfold undoes the line folding, for comparing a calendar's lines.
+func unfold(ics string) []string {
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(ics, "\r\n ", ""), "\r\n"), "\r\n")
+}
+
+func TestMenuCalendar(t *testing.T) {
+	long := strings.Repeat("Ofengemüse mit Kräutern, ", 8)
+	calendar := menuCalendar{id: "gira", name: "Gira", url: "https://gira.example/menu", updated: serveNow}
+	ics := string(calendar.render([]calendarEvent{
+		{date: "2026-07-17", dishes: []ai.MenuItem{
+			{Name: "Poulet Cordon Bleu", Type: "meat", Description: "Pommes frites; Salat", Link: "https://gira.example/dish/1"},
+			{Name: "Dal", Type: "vegan", Description: long},
+		}},
+	}))
+
+	for _, line := range strings.Split(ics, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+	}
+	if !strings.HasSuffix(ics, "END:VCALENDAR\r\n") || strings.Contains(strings.ReplaceAll(ics, "\r\n", ""), "\n") {
+		t.Errorf("lines don't end with CRLF:\n%s", ics)
+	}
+
+	lines := unfold(ics)
+	for _, want := range []string{
+		"UID:gira-2026-07-17@lunch-wankdorf",
+		"DTSTAMP:20260717T113000Z",
+		"DTSTART;VALUE=DATE:20260717",
+		"DTEND;VALUE=DATE:20260718",
+		`SUMMARY:Lunch at Gira: Poulet Cordon Bleu\, Dal`,
+		`DESCRIPTION:Poulet Cordon Bleu (meat)\nPommes frites\; Salat\nhttps://gira.example/dish/1\n\nDal (vegan)\n` + icsText(long),
+		"TRANSP:TRANSPARENT",
+	} {
+		found := false
+		for _, line := range lines {
+			found = found || line == want
+		}
+		if !found {
+			t.Errorf("no line %q in:\n%s", want, ics)
+		}
+	}
+}
+
+func TestPublishCalendars(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// This week's menu is published already, from before the metadata
+	thisWeek := weekOf(time.Now())
+	if err := store.Put(ctx, menuFilename("Gira", thisWeek), []byte(`{"type":"daily","menu":{"Tuesday":[{"name":"Risotto"}]}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	published, _ := json.Marshal(&ai.DailyMenu{
+		Type: "daily",
+		MenuMeta: ai.MenuMeta{
+			RestaurantID: "gira", RestaurantName: "Gira", Year: 2026, Week: 29,
+			Days: map[string]ai.DayMeta{"Friday": {Date: "2026-07-17"}},
+		},
+		Menu: map[string][]ai.MenuItem{"Friday": {{Name: "Dal"}}, "Saturday": {}},
+	})
+	if err := publishCalendars(ctx, store, published); err != nil {
+		t.Fatalf("publishCalendars() error = %v", err)
+	}
+
+	week, err := store.Get(ctx, "gira_29_2026.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(week), "BEGIN:VEVENT"); got != 1 {
+		t.Errorf("the week's calendar has %d events, want Friday's (Saturday has no dishes)", got)
+	}
+
+	feed, err := store.Get(ctx, "gira.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tuesday := "UID:gira-" + thisWeek.date(time.Tuesday) + "@lunch-wankdorf"
+	for _, want := range []string{"UID:gira-2026-07-17@lunch-wankdorf", tuesday} {
+		if !strings.Contains(string(feed), want) {
+			t.Errorf("the feed has no %q:\n%s", want, feed)
+		}
+	}
+}
+
+func TestCalendarEventsOfAWeeklyMenu(t *testing.T) {
+	menu := &menuFile{Type: "weekly", Menu: json.RawMessage(`[{"name": "Curry Bowl"}]`)}
+
+	events := calendarEvents(menu, isoWeek{2026, 29})
+	if len(events) != 5 || events[0].date != "2026-07-13" || events[4].date != "2026-07-17" {
+		t.Errorf("events = %+v, want Monday 2026-07-13 to Friday 2026-07-17", events)
+	}
+}
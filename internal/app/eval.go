@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/eval"
+)
+
+// RunEval scores the model's parses of the golden menus (see pkg/eval) and prints
+// the scores, compared to config.BaselineFile's if there is one. The goldens of a
+// restaurant are parsed with its prompt, as a run would. Like a fetch, it
+// talks to the model the environment configures, and records its answers to
+// config.RecordDir; with config.ReplayDir it replays them instead, offline.
+func RunEval(config Config) error {
+	loadEnv()
+
+	goldens, err := eval.Load(config.GoldenDir)
+	if err != nil {
+		return err
+	}
+	restaurants, err := loadRegistry(restaurantsFile(config))
+	if err != nil {
+		return err
+	}
+	for _, golden := range goldens {
+		if _, err := restaurants.lookup(golden.Restaurant); golden.Restaurant != "" && err != nil {
+			return fmt.Errorf("golden %s: %w", golden.Name, err)
+		}
+	}
+	prompts := make(map[string]ai.Prompt, len(restaurants))
+	for id, restaurant := range restaurants {
+		prompts[id] = restaurant.Prompt
+	}
+	var baseline *eval.Report
+	if config.BaselineFile != "" {
+		baseline, err = readEvalReport(config.BaselineFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	sess, err := newSession(config)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+	parser, err := sess.getParser()
+	if err != nil {
+		return err
+	}
+
+	report := eval.Run(context.Background(), parser, goldens, prompts)
+	fmt.Print(report.Markdown())
+	if baseline != nil {
+		fmt.Print("\n" + eval.Compare(*baseline, report))
+	}
+
+	if config.EvalFile != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(config.EvalFile, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write the evaluation: %w", err)
+		}
+	}
+	return nil
+}
+
+func readEvalReport(path string) (*eval.Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the baseline: %w", err)
+	}
+	report := &eval.Report{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s: %w", path, err)
+	}
+	return report, nil
+}
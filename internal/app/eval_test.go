@@ -0,0 +1,93 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/eval"
+)
+
+// An evaluation recorded against the model replays offline to the same scores,
+// and compares to the one before.
+func TestEvalReplaysARecordedEvaluation(t *testing.T) {
+	goldens, err := eval.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A model that reads every golden the way its labeller did, but for a pizza
+	// it takes for a sandwich
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct{ Content string } `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var prompt string
+		for _, message := range req.Messages {
+			prompt += message.Content
+		}
+
+		items := []ai.MenuItem{}
+		for _, golden := range goldens {
+			if !strings.Contains(prompt, golden.Input) {
+				continue
+			}
+			for _, dish := range golden.Dishes {
+				icon := dish.Icon
+				if icon == "pizza" {
+					icon = "sandwich"
+				}
+				items = append(items, ai.MenuItem{Name: dish.Name, Type: dish.Type, Icon: icon, Category: dish.Category})
+			}
+		}
+		content, _ := json.Marshal(map[string]any{"items": items})
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]any{"role": "assistant", "content": string(content)}}},
+		})
+	}))
+
+	dir := t.TempDir()
+	baseline := filepath.Join(t.TempDir(), "baseline.json")
+	t.Setenv("AI_PROVIDER", "")
+	t.Setenv("OPENAI_BASE_URL", server.URL+"/v1")
+	recorded := captureStdout(t, func() error { return RunEval(Config{RecordDir: dir, EvalFile: baseline}) })
+	if !strings.Contains(recorded, "| pizza | sandwich |") {
+		t.Errorf("the evaluation shows no mixed-up pizza:\n%s", recorded)
+	}
+
+	server.Close()
+	t.Setenv("OPENAI_BASE_URL", "")
+	t.Setenv("OPENAI_API_KEY", "")
+	current := filepath.Join(t.TempDir(), "eval.json")
+	replayed := captureStdout(t, func() error {
+		return RunEval(Config{ReplayDir: dir, EvalFile: current, BaselineFile: baseline})
+	})
+	// Only the model differs, as a replay doesn't know which answered
+	_, recordedTables, _ := strings.Cut(recorded, "\n")
+	if _, replayedTables, _ := strings.Cut(replayed, "\n"); !strings.HasPrefix(replayedTables, recordedTables) {
+		t.Errorf("replay differs from the recording:\nrecorded: %s\nreplayed: %s", recorded, replayed)
+	}
+	if !strings.Contains(replayed, "| **all** | name | 100% | 100% | +0 |") {
+		t.Errorf("the replay isn't compared to the recording:\n%s", replayed)
+	}
+
+	report, err := readEvalReport(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.PromptVersion != ai.DefaultPrompts().Latest() || len(report.Goldens) != len(goldens) || len(report.Formats) != 3 {
+		t.Errorf("report = %+v, want every golden in the three formats", report)
+	}
+	if total := report.Total; total.Found != total.Dishes || total.Extra != 0 || total.Fields[eval.FieldIcon].Correct == total.Dishes {
+		t.Errorf("total = %+v, want every dish found, some with the wrong icon", total)
+	}
+
+	if err := RunEval(Config{ReplayDir: dir, BaselineFile: filepath.Join(dir, "missing.json")}); err == nil {
+		t.Error("RunEval(a baseline that isn't there) succeeded, want an error")
+	}
+}
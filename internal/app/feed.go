@@ -0,0 +1,250 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// feedRetention is how far back the feeds go.
+const feedRetention = 28 * 24 * time.Hour
+
+// combinedFeedFilename is the feed of every restaurant at once.
+const combinedFeedFilename = "menus.atom"
+
+// feedFilename is <restaurantname>.atom.
+func feedFilename(restaurantName string) string {
+	return strings.ToLower(restaurantName) + ".atom"
+}
+
+// Entry IDs are tag URIs (RFC 4151), which need a date the name was ours on.
+const feedTag = "tag:lunch-wankdorf,2025:"
+
+// feedMu keeps the restaurants of a batch run from rebuilding the combined feed
+// at the same time.
+var feedMu sync.Mutex
+
+// publishFeed puts the days of a menu that was just uploaded into the
+// restaurant's Atom feed, and rebuilds the combined one from those of the
+// restaurants in the registry.
+// An entry is a restaurant's day; a day that is published again only shows up as
+// updated if its dishes changed, e.g. when their photos were added.
+//
+// Each restaurant keeps a feed of its own because the restaurants are published
+// by runs of their own, at the same time: one feed that each of them read,
+// changed and wrote back would lose whatever the others wrote in between.
+func publishFeed(ctx context.Context, store storage.Store, restaurants registry, restaurant scraper.RestaurantMenu, week isoWeek, menuJSON []byte, now time.Time) error {
+	menu := &menuFile{}
+	if err := json.Unmarshal(menuJSON, menu); err != nil {
+		return fmt.Errorf("failed to read the menu back: %w", err)
+	}
+	menu.restaurantName = restaurant.Name
+
+	filename := feedFilename(restaurant.Name)
+	feed, err := readFeed(ctx, store, filename)
+	if err != nil {
+		return err
+	}
+	if feed == nil {
+		feed = newFeed(restaurant.ID, "Lunch at "+restaurant.Name, restaurant.URL)
+	}
+
+	changed := false
+	for _, event := range calendarEvents(menu, week) {
+		changed = feed.upsert(dayEntry(restaurant, event), now) || changed
+	}
+	changed = feed.prune(now) || changed
+	if !changed {
+		return nil
+	}
+	if err := writeFeed(ctx, store, filename, feed, now); err != nil {
+		return err
+	}
+
+	feedMu.Lock()
+	defer feedMu.Unlock()
+	return publishCombinedFeed(ctx, store, restaurants, now)
+}
+
+// publishCombinedFeed merges the feeds of the restaurants in the registry into
+// menus.atom. It reads those feeds by name rather than looking for them in the
+// store, which would list everything ever published.
+func publishCombinedFeed(ctx context.Context, store storage.Store, restaurants registry, now time.Time) error {
+	combined := newFeed("menus", "Lunch Wankdorf", "https://chlab.github.io/lunch-wankdorf/")
+	for _, filename := range restaurants.feedFilenames() {
+		feed, err := readFeed(ctx, store, filename)
+		if err != nil {
+			return err
+		}
+		if feed != nil {
+			combined.Entries = append(combined.Entries, feed.Entries...)
+		}
+	}
+	combined.prune(now)
+	return writeFeed(ctx, store, combinedFeedFilename, combined, now)
+}
+
+// atomFeed is an Atom feed (RFC 4287), as much of it as the menus need.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published,omitempty"`
+	Updated   string      `xml:"updated"`
+	Link      *atomLink   `xml:"link,omitempty"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func newFeed(id, title, link string) *atomFeed {
+	return &atomFeed{
+		ID:     feedTag + id,
+		Title:  title,
+		Link:   atomLink{Href: link},
+		Author: atomAuthor{Name: "Lunch Wankdorf"},
+	}
+}
+
+// dayEntry is a restaurant's dishes on a day, with their photos.
+func dayEntry(restaurant scraper.RestaurantMenu, event calendarEvent) atomEntry {
+	title := restaurant.Name
+	if date, err := time.Parse(time.DateOnly, event.date); err == nil {
+		title += ", " + date.Format("Monday 2 January 2006")
+	}
+
+	var content strings.Builder
+	content.WriteString("<ul>")
+	for _, dish := range event.dishes {
+		content.WriteString("<li>")
+		if dish.Photo != "" {
+			fmt.Fprintf(&content, `<img src="%s" alt="%s" width="120"><br>`, html.EscapeString(dish.Photo), html.EscapeString(dish.Name))
+		}
+		name := html.EscapeString(dish.Name)
+		if dish.Link != "" {
+			name = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(dish.Link), name)
+		}
+		fmt.Fprintf(&content, "<strong>%s</strong>", name)
+		if dish.Type != "" {
+			fmt.Fprintf(&content, " <em>%s</em>", html.EscapeString(dish.Type))
+		}
+		if dish.Description != "" {
+			fmt.Fprintf(&content, "<br>%s", html.EscapeString(dish.Description))
+		}
+		content.WriteString("</li>")
+	}
+	content.WriteString("</ul>")
+
+	entry := atomEntry{
+		ID:      feedTag + restaurant.ID + "/" + event.date,
+		Title:   title,
+		Content: atomContent{Type: "html", Body: content.String()},
+	}
+	if restaurant.URL != "" {
+		entry.Link = &atomLink{Href: restaurant.URL}
+	}
+	return entry
+}
+
+// upsert adds the entry, or replaces the one with its ID if the entry is
+// different. It reports whether the feed changed.
+func (f *atomFeed) upsert(entry atomEntry, now time.Time) bool {
+	stamp := now.UTC().Format(time.RFC3339)
+	for i, existing := range f.Entries {
+		if existing.ID != entry.ID {
+			continue
+		}
+		if existing.Title == entry.Title && existing.Content == entry.Content {
+			return false
+		}
+		entry.Published, entry.Updated = existing.Published, stamp
+		f.Entries[i] = entry
+		return true
+	}
+
+	entry.Published, entry.Updated = stamp, stamp
+	f.Entries = append(f.Entries, entry)
+	return true
+}
+
+// prune drops the days older than feedRetention, and reports whether there were
+// any.
+func (f *atomFeed) prune(now time.Time) bool {
+	cutoff := now.Add(-feedRetention).Format(time.DateOnly)
+	kept := f.Entries[:0]
+	for _, entry := range f.Entries {
+		// The ID ends in the day's date
+		if entry.ID[strings.LastIndex(entry.ID, "/")+1:] >= cutoff {
+			kept = append(kept, entry)
+		}
+	}
+	pruned := len(kept) < len(f.Entries)
+	f.Entries = kept
+	return pruned
+}
+
+func readFeed(ctx context.Context, store storage.Store, filename string) (*atomFeed, error) {
+	data, err := store.Get(ctx, filename)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &atomFeed{}
+	if err := xml.Unmarshal(data, feed); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	return feed, nil
+}
+
+// writeFeed puts the feed's entries newest first, the order readers expect.
+func writeFeed(ctx context.Context, store storage.Store, filename string, feed *atomFeed, now time.Time) error {
+	sort.SliceStable(feed.Entries, func(i, j int) bool {
+		if feed.Entries[i].Updated != feed.Entries[j].Updated {
+			return feed.Entries[i].Updated > feed.Entries[j].Updated
+		}
+		return feed.Entries[i].ID < feed.Entries[j].ID
+	})
+	feed.Updated = now.UTC().Format(time.RFC3339)
+	if len(feed.Entries) > 0 {
+		feed.Updated = feed.Entries[0].Updated
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return store.Put(ctx, filename, append([]byte(xml.Header), data...))
+}
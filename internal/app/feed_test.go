@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+func readTestFeed(t *testing.T, store storage.Store, name string) *atomFeed {
+	t.Helper()
+	feed, err := readFeed(context.Background(), store, name)
+	if err != nil || feed == nil {
+		t.Fatalf("readFeed(%s) = %v, %v", name, feed, err)
+	}
+	return feed
+}
+
+func TestPublishFeed(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gira := scraper.RestaurantMenu{ID: "gira", Name: "Gira", URL: "https://gira.example/menu"}
+	luna := scraper.RestaurantMenu{ID: "luna", Name: "Luna"}
+	restaurants := registry{"gira": gira, "luna": luna}
+	week := isoWeek{2026, 29}
+	menu := &ai.DailyMenu{
+		Type: "daily",
+		Menu: map[string][]ai.MenuItem{
+			"Thursday": {{Name: "Dal", Type: "vegan"}},
+			"Friday":   {{Name: "Poulet Cordon Bleu", Category: "Postino"}},
+		},
+	}
+	publish := func(restaurant scraper.RestaurantMenu, menu *ai.DailyMenu, now time.Time) {
+		t.Helper()
+		data, _ := json.Marshal(menu)
+		if err := publishFeed(ctx, store, restaurants, restaurant, week, data, now); err != nil {
+			t.Fatalf("publishFeed() error = %v", err)
+		}
+	}
+
+	monday := time.Date(2026, 7, 13, 4, 37, 0, 0, time.UTC)
+	publish(gira, menu, monday)
+	feed := readTestFeed(t, store, "gira.atom")
+	if len(feed.Entries) != 2 || feed.Updated != "2026-07-13T04:37:00Z" {
+		t.Fatalf("feed = %+v, want Thursday and Friday, updated on Monday", feed)
+	}
+
+	// The same menu again changes nothing
+	publish(gira, menu, monday.Add(time.Hour))
+	if feed := readTestFeed(t, store, "gira.atom"); feed.Updated != "2026-07-13T04:37:00Z" {
+		t.Errorf("feed updated at %s by a menu that didn't change", feed.Updated)
+	}
+
+	// Friday's photo makes Friday's entry an update, and the newest
+	friday := time.Date(2026, 7, 17, 7, 13, 0, 0, time.UTC)
+	menu.Menu["Friday"][0].Photo = "https://example.test/postino.jpg?w=120&h=120"
+	publish(gira, menu, friday)
+	feed = readTestFeed(t, store, "gira.atom")
+	first := feed.Entries[0]
+	if first.ID != "tag:lunch-wankdorf,2025:gira/2026-07-17" || first.Title != "Gira, Friday 17 July 2026" {
+		t.Errorf("newest entry = %s %q, want Friday's", first.ID, first.Title)
+	}
+	if first.Published != "2026-07-13T04:37:00Z" || first.Updated != "2026-07-17T07:13:00Z" {
+		t.Errorf("Friday published %s, updated %s, want Monday and Friday", first.Published, first.Updated)
+	}
+	if !strings.Contains(first.Content.Body, `<img src="https://example.test/postino.jpg?w=120&amp;h=120"`) {
+		t.Errorf("Friday's content has no photo: %s", first.Content.Body)
+	}
+
+	// Another restaurant's days end up in the combined feed too, but not those of
+	// a feed the registry doesn't know, and four weeks on the old days are gone
+	closed := newFeed("closed", "Lunch at Closed", "")
+	closed.upsert(atomEntry{ID: feedTag + "closed/2026-07-17", Title: "Closed"}, friday)
+	if err := writeFeed(ctx, store, "closed.atom", closed, friday); err != nil {
+		t.Fatal(err)
+	}
+	publish(luna, menu, friday.Add(time.Minute))
+	if combined := readTestFeed(t, store, "menus.atom"); len(combined.Entries) != 4 {
+		t.Errorf("the combined feed has %d entries, want Gira's and Luna's two each", len(combined.Entries))
+	}
+	data, _ := json.Marshal(&ai.DailyMenu{Type: "daily", Menu: map[string][]ai.MenuItem{}})
+	if err := publishFeed(ctx, store, restaurants, gira, isoWeek{2026, 34}, data, friday.AddDate(0, 0, 28)); err != nil {
+		t.Fatal(err)
+	}
+	if feed := readTestFeed(t, store, "gira.atom"); len(feed.Entries) != 1 {
+		t.Errorf("gira.atom has %d entries four weeks on, want Friday's alone", len(feed.Entries))
+	}
+
+	raw, _ := store.Get(ctx, "menus.atom")
+	if !strings.HasPrefix(string(raw), xml.Header) || !strings.Contains(string(raw), `<feed xmlns="http://www.w3.org/2005/Atom">`) {
+		t.Errorf("menus.atom is not an Atom feed:\n%s", raw)
+	}
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/history"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// historyFilename is where a restaurant's dish history is kept in the history's
+// storage (see openHistoryStore): history/<restaurantname>.sqlite. Each restaurant
+// has a history of its own for the reason it has a feed of its own (see
+// publishFeed).
+func historyFilename(restaurantName string) string {
+	return "history/" + strings.ToLower(restaurantName) + ".sqlite"
+}
+
+// openHistoryStore opens the storage the dish histories are kept in. It is not the
+// one the menus are published to, which is public, but a private bucket of the
+// same backend: -historyBucket, else HISTORY_BUCKET. For local storage it is a
+// directory.
+func openHistoryStore(config Config) (storage.Store, error) {
+	name := config.HistoryBucket
+	if name == "" {
+		name = os.Getenv("HISTORY_BUCKET")
+	}
+	if name == "" {
+		return nil, errors.New("no private bucket to keep the dish history in, set -historyBucket or HISTORY_BUCKET")
+	}
+	return storage.OpenBucket(config.Storage, name)
+}
+
+// servedDish is a dish of a menu and the day it is served on.
+type servedDish struct {
+	date string // ISO date
+	item *ai.MenuItem
+}
+
+// servedDishes lists the dishes of a menu with their days. A weekly menu's dishes
+// are served for the week, which counts as once, on its Monday.
+func servedDishes(menu publishedMenu, week isoWeek) []servedDish {
+	var dishes []servedDish
+	switch menu := menu.(type) {
+	case *ai.DailyMenu:
+		for _, weekday := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+			name := weekday.String()
+			date := menu.Days[name].Date
+			if date == "" {
+				date = week.date(weekday)
+			}
+			items := menu.Menu[name]
+			for i := range items {
+				dishes = append(dishes, servedDish{date: date, item: &items[i]})
+			}
+		}
+	case *ai.WeeklyMenu:
+		for i := range menu.Menu {
+			dishes = append(dishes, servedDish{date: week.date(time.Monday), item: &menu.Menu[i]})
+		}
+	}
+	return dishes
+}
+
+// addDishHistory records the menu's dishes in the restaurant's dish history, and
+// fills in from it when each of them was first and last served and how often.
+//
+// The history is config.HistoryFile if there is one. Otherwise it is the one in
+// the history's own storage (see openHistoryStore), which is read into a
+// temporary file and, when the menu is uploaded, written back - but only if
+// nothing was written to it in between. Two
+// runs of a restaurant that overlap would otherwise lose the dishes of whichever
+// wrote first; the second fails instead. The workflows keep a restaurant's runs
+// from overlapping (their concurrency group), so this is the backstop.
+func addDishHistory(ctx context.Context, menu publishedMenu, week isoWeek, config Config) error {
+	meta := menu.Metadata()
+	path := config.HistoryFile
+	var store storage.Store
+	var version string
+	if path == "" {
+		var err error
+		if store, err = openHistoryStore(config); err != nil {
+			return err
+		}
+		dir, err := os.MkdirTemp("", "history")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		path = filepath.Join(dir, "history.sqlite")
+
+		var data []byte
+		data, version, err = store.GetVersion(ctx, historyFilename(meta.RestaurantName))
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	db, err := history.Open(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	dishes := servedDishes(menu, week)
+	servings := make([]history.Serving, len(dishes))
+	for i, dish := range dishes {
+		servings[i] = history.Serving{
+			Restaurant:  meta.RestaurantID,
+			Date:        dish.date,
+			Name:        dish.item.Name,
+			Category:    dish.item.Category,
+			Description: dish.item.Description,
+			Photo:       dish.item.Photo,
+		}
+	}
+	if err := db.Record(ctx, servings); err != nil {
+		return fmt.Errorf("failed to record the dishes: %w", err)
+	}
+
+	newDishes := 0
+	for _, dish := range dishes {
+		seen, err := db.Seen(ctx, meta.RestaurantID, dish.date, dish.item.Name)
+		if err != nil {
+			return fmt.Errorf("failed to look up %q: %w", dish.item.Name, err)
+		}
+		dish.item.FirstSeen, dish.item.LastSeen, dish.item.TimesServed = seen.FirstSeen, seen.LastSeen, seen.TimesServed
+		if seen.FirstSeen == dish.date {
+			newDishes++
+		}
+	}
+	slog.InfoContext(ctx, "Recorded the dish history", "new", newDishes, "dishes", len(dishes))
+
+	if store == nil || !config.Upload {
+		return nil
+	}
+	if err := db.Close(); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = store.PutIfVersion(ctx, historyFilename(meta.RestaurantName), data, version)
+	if errors.Is(err, storage.ErrChanged) {
+		return fmt.Errorf("another run updated the dish history at the same time, so this one's dishes were left out of it: %w", err)
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+func TestAddDishHistory(t *testing.T) {
+	config := Config{HistoryFile: filepath.Join(t.TempDir(), "history.sqlite")}
+	add := func(menu publishedMenu, week isoWeek) {
+		t.Helper()
+		if err := addDishHistory(context.Background(), menu, week, config); err != nil {
+			t.Fatalf("addDishHistory() error = %v", err)
+		}
+	}
+	meta := ai.MenuMeta{RestaurantID: "gira", RestaurantName: "Gira"}
+
+	week28 := &ai.DailyMenu{
+		Type:     "daily",
+		MenuMeta: meta,
+		Menu: map[string][]ai.MenuItem{
+			"Monday": {{Name: "Pizza Siciliana"}},
+			// No date in Days: the week says which day it is
+			"Friday": {{Name: "Pizza Siciliana"}, {Name: "Dal"}},
+		},
+	}
+	week28.Days = map[string]ai.DayMeta{"Monday": {Date: "2026-07-06"}}
+	add(week28, isoWeek{2026, 28})
+	if got := week28.Menu["Friday"][0]; got.FirstSeen != "2026-07-06" || got.LastSeen != "2026-07-06" || got.TimesServed != 2 {
+		t.Errorf("Friday's pizza = %+v, want the second time since Monday", got)
+	}
+
+	week29 := &ai.DailyMenu{
+		Type:     "daily",
+		MenuMeta: meta,
+		Menu: map[string][]ai.MenuItem{
+			"Friday": {{Name: "PIZZA SICILIANA"}, {Name: "Poulet Cordon Bleu"}},
+		},
+	}
+	add(week29, isoWeek{2026, 29})
+	want := []ai.MenuItem{
+		{Name: "PIZZA SICILIANA", FirstSeen: "2026-07-06", LastSeen: "2026-07-10", TimesServed: 3},
+		{Name: "Poulet Cordon Bleu", FirstSeen: "2026-07-17", TimesServed: 1},
+	}
+	for i, got := range week29.Menu["Friday"] {
+		if got != want[i] {
+			t.Errorf("Friday[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	// A weekly menu is served once a week
+	weekly := &ai.WeeklyMenu{Type: "weekly", MenuMeta: ai.MenuMeta{RestaurantID: "luna", RestaurantName: "Luna"}, Menu: []ai.MenuItem{{Name: "Pad Thai"}}}
+	add(weekly, isoWeek{2026, 29})
+	if got := weekly.Menu[0]; got.FirstSeen != "2026-07-13" || got.TimesServed != 1 {
+		t.Errorf("weekly dish = %+v, want new on Monday", got)
+	}
+}
+
+// The history in its bucket is read and written back by each run, the first of
+// them creating it. It is never in the menus' storage, which is public.
+func TestAddDishHistoryInTheStorage(t *testing.T) {
+	t.Setenv("HISTORY_BUCKET", "")
+	menus := t.TempDir()
+	config := Config{Storage: storage.BackendLocal, StorageDir: menus, Upload: true}
+	if err := addDishHistory(context.Background(), &ai.DailyMenu{Type: "daily"}, isoWeek{2026, 28}, config); err == nil {
+		t.Fatal("addDishHistory() without a history bucket succeeded, want an error")
+	}
+
+	history := t.TempDir()
+	config.HistoryBucket = history
+	meta := ai.MenuMeta{RestaurantID: "gira", RestaurantName: "Gira"}
+	for _, week := range []isoWeek{{2026, 28}, {2026, 29}} {
+		menu := &ai.DailyMenu{Type: "daily", MenuMeta: meta, Menu: map[string][]ai.MenuItem{"Friday": {{Name: "Dal"}}}}
+		if err := addDishHistory(context.Background(), menu, week, config); err != nil {
+			t.Fatalf("addDishHistory(week %d) error = %v", week.week, err)
+		}
+		if got := menu.Menu["Friday"][0].TimesServed; got != week.week-27 {
+			t.Errorf("week %d: dal served %d times, want %d", week.week, got, week.week-27)
+		}
+	}
+	if entries, _ := os.ReadDir(menus); len(entries) != 0 {
+		t.Errorf("the menus' storage has %v, want nothing", entries)
+	}
+	if _, err := os.Stat(filepath.Join(history, "history", "gira.sqlite")); err != nil {
+		t.Errorf("the history isn't in its bucket: %v", err)
+	}
+}
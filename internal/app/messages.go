@@ -0,0 +1,224 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+)
+
+// messageFormat is the kind of message a chat's incoming webhook takes.
+type messageFormat string
+
+const (
+	formatSlack    messageFormat = "slack"    // Block Kit, with the photos as thumbnails
+	formatTeams    messageFormat = "teams"    // an Adaptive Card, as Teams workflows take them
+	formatMarkdown messageFormat = "markdown" // {"text": "..."}, for Mattermost and anything else
+)
+
+var messageFormats = []messageFormat{formatSlack, formatTeams, formatMarkdown}
+
+func parseMessageFormat(value string) (messageFormat, error) {
+	for _, format := range messageFormats {
+		if strings.EqualFold(value, string(format)) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown webhook format %q, want %s, %s or %s", value, formatSlack, formatTeams, formatMarkdown)
+}
+
+func (f messageFormat) render(day lunchDay) ([]byte, error) {
+	var message any
+	switch f {
+	case formatSlack:
+		message = slackMessage(day)
+	case formatTeams:
+		message = teamsMessage(day)
+	default:
+		message = map[string]string{"text": markdownMessage(day)}
+	}
+	return json.Marshal(message)
+}
+
+// iconEmoji stands in for the frontend's icons, by the same names (see
+// ai.IconsList).
+var iconEmoji = map[string]string{
+	"bento":            "🍱",
+	"curry":            "🍛",
+	"dumplings":        "🥟",
+	"french-fries":     "🍟",
+	"fried-chicken":    "🍗",
+	"hamburger":        "🍔",
+	"hot-dog":          "🌭",
+	"korean-rice-cake": "🥢",
+	"lasagna-sheets":   "🍝",
+	"miso-soup":        "🍜",
+	"nachos":           "🧀",
+	"noodles":          "🍜",
+	"paella":           "🥘",
+	"pizza":            "🍕",
+	"rack-of-lamb":     "🍖",
+	"rice-bowl":        "🍚",
+	"salad":            "🥗",
+	"sandwich":         "🥪",
+	"sausage":          "🌭",
+	"seafood":          "🦐",
+	"spaghetti":        "🍝",
+	"porridge":         "🧀",
+	"steak":            "🥩",
+	"steak-rare":       "🥩",
+	"sushi":            "🍣",
+	"taco":             "🌮",
+	"vegan-food":       "🥦",
+	"wrap":             "🌯",
+}
+
+func emojiFor(dish ai.MenuItem) string {
+	if emoji, ok := iconEmoji[dish.Icon]; ok {
+		return emoji
+	}
+	return "🍽️"
+}
+
+func heading(day lunchDay) string {
+	return "Lunch on " + day.date.Format("Monday, 2 January")
+}
+
+// slackBlockLimit is the most blocks Slack takes in one message.
+const slackBlockLimit = 50
+
+// slackMessage gives each dish a section of its own, with its photo beside it.
+// A day with more dishes than Slack takes blocks for lists each restaurant's
+// dishes in one section instead, without the photos.
+func slackMessage(day lunchDay) map[string]any {
+	header := map[string]any{
+		"type": "header",
+		"text": map[string]any{"type": "plain_text", "text": heading(day)},
+	}
+	section := func(text string) map[string]any {
+		return map[string]any{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": text}}
+	}
+
+	blocks := []map[string]any{header}
+	for i, restaurant := range day.restaurants {
+		if i > 0 {
+			blocks = append(blocks, map[string]any{"type": "divider"})
+		}
+		blocks = append(blocks, section(fmt.Sprintf("*<%s|%s>*", restaurant.url, slackEscape(restaurant.name))))
+		for _, dish := range restaurant.dishes {
+			block := section(slackDish(dish))
+			if dish.Photo != "" {
+				block["accessory"] = map[string]any{"type": "image", "image_url": dish.Photo, "alt_text": dish.Name}
+			}
+			blocks = append(blocks, block)
+		}
+	}
+
+	if len(blocks) > slackBlockLimit {
+		blocks = []map[string]any{header}
+		for _, restaurant := range day.restaurants {
+			lines := []string{fmt.Sprintf("*<%s|%s>*", restaurant.url, slackEscape(restaurant.name))}
+			for _, dish := range restaurant.dishes {
+				lines = append(lines, slackDish(dish))
+			}
+			blocks = append(blocks, section(strings.Join(lines, "\n")))
+		}
+	}
+
+	// text is what notifications and clients without blocks show
+	return map[string]any{"text": heading(day), "blocks": blocks}
+}
+
+func slackDish(dish ai.MenuItem) string {
+	line := fmt.Sprintf("%s *%s*", emojiFor(dish), slackEscape(dish.Name))
+	if dish.Type != "" {
+		line += " _" + slackEscape(dish.Type) + "_"
+	}
+	if dish.Description != "" {
+		line += "\n" + slackEscape(dish.Description)
+	}
+	return line
+}
+
+// slackEscape escapes the characters Slack's mrkdwn reads as markup.
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// teamsMessage is an Adaptive Card, a row per dish with the photo on the left.
+func teamsMessage(day lunchDay) map[string]any {
+	text := func(text string, attributes map[string]any) map[string]any {
+		block := map[string]any{"type": "TextBlock", "text": text, "wrap": true}
+		for key, value := range attributes {
+			block[key] = value
+		}
+		return block
+	}
+
+	body := []map[string]any{text(heading(day), map[string]any{"size": "Large", "weight": "Bolder"})}
+	for _, restaurant := range day.restaurants {
+		body = append(body, text(fmt.Sprintf("[%s](%s)", restaurant.name, restaurant.url), map[string]any{
+			"size": "Medium", "weight": "Bolder", "separator": true, "spacing": "Large",
+		}))
+		for _, dish := range restaurant.dishes {
+			title := emojiFor(dish) + " **" + dish.Name + "**"
+			if dish.Type != "" {
+				title += " _" + dish.Type + "_"
+			}
+			details := []map[string]any{text(title, nil)}
+			if dish.Description != "" {
+				details = append(details, text(dish.Description, map[string]any{"isSubtle": true, "spacing": "None"}))
+			}
+
+			var columns []map[string]any
+			if dish.Photo != "" {
+				columns = append(columns, map[string]any{
+					"type":  "Column",
+					"width": "auto",
+					"items": []map[string]any{{"type": "Image", "url": dish.Photo, "size": "Small", "altText": dish.Name}},
+				})
+			}
+			columns = append(columns, map[string]any{"type": "Column", "width": "stretch", "items": details})
+			body = append(body, map[string]any{"type": "ColumnSet", "columns": columns})
+		}
+	}
+
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+				"msteams": map[string]any{"width": "Full"},
+			},
+		}},
+	}
+}
+
+// markdownMessage links the photos rather than showing them: not every chat that
+// takes Markdown sizes an image down to a thumbnail.
+func markdownMessage(day lunchDay) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "#### %s\n", heading(day))
+	for _, restaurant := range day.restaurants {
+		fmt.Fprintf(&text, "\n**[%s](%s)**\n", restaurant.name, restaurant.url)
+		for _, dish := range restaurant.dishes {
+			fmt.Fprintf(&text, "- %s **%s**", emojiFor(dish), dish.Name)
+			if dish.Type != "" {
+				fmt.Fprintf(&text, " _%s_", dish.Type)
+			}
+			if dish.Description != "" {
+				fmt.Fprintf(&text, " – %s", dish.Description)
+			}
+			if dish.Photo != "" {
+				fmt.Fprintf(&text, " [📷](%s)", dish.Photo)
+			}
+			text.WriteString("\n")
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,247 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// webhookTimeout bounds one post to a chat webhook.
+const webhookTimeout = 15 * time.Second
+
+// RunNotify posts today's menus of every restaurant to the chat webhooks in
+// config.Webhooks and NOTIFY_WEBHOOKS. It posts to each webhook once a day: a
+// second run on the same day only posts to the webhooks the first one did not
+// reach, unless config.Force is set.
+func RunNotify(config Config) error {
+	// Load environment variables from .env file
+	loadEnv()
+
+	webhooks, err := parseWebhooks(append(config.Webhooks, strings.Fields(os.Getenv("NOTIFY_WEBHOOKS"))...))
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 && !config.DryRun {
+		return errors.New("no webhooks to post to, pass -webhook or set NOTIFY_WEBHOOKS")
+	}
+
+	restaurants, err := loadRegistry(restaurantsFile(config))
+	if err != nil {
+		return err
+	}
+	store, err := openStore(config)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	return notify(context.Background(), newMenuReader(restaurants, store), webhooks, time.Now().In(zurich()), config, client)
+}
+
+func notify(ctx context.Context, reader *menuReader, webhooks []webhook, now time.Time, config Config, client *http.Client) error {
+	day, err := lunchOn(ctx, reader, now)
+	if err != nil {
+		return err
+	}
+	if len(day.restaurants) == 0 {
+		slog.InfoContext(ctx, "No menus published, nothing to post", "date", day.date.Format(time.DateOnly))
+		return nil
+	}
+
+	if config.DryRun {
+		// Every format, whether a webhook uses it or not, to see what they look like
+		for _, format := range messageFormats {
+			message, err := format.render(day)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s:\n%s\n", format, message)
+		}
+		return nil
+	}
+
+	posted, err := readNotified(ctx, reader.store, day.date)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, hook := range webhooks {
+		if posted.Webhooks[hook.key()] != "" && !config.Force {
+			slog.InfoContext(ctx, "Today's menu was already posted, skipping the webhook", "webhook", hook.String())
+			continue
+		}
+
+		message, err := hook.format.render(day)
+		if err != nil {
+			return err
+		}
+		if err := hook.post(ctx, client, message); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		slog.InfoContext(ctx, "Posted today's menu", "webhook", hook.String())
+
+		// Recorded right away, so a webhook that fails after this one doesn't get
+		// this one posted to twice when the run is retried
+		posted.Webhooks[hook.key()] = time.Now().UTC().Format(time.RFC3339)
+		if err := writeNotified(ctx, reader.store, day.date, posted); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lunchDay is what is posted: the dishes of every restaurant that has any on date.
+type lunchDay struct {
+	date        time.Time
+	restaurants []restaurantDishes
+}
+
+type restaurantDishes struct {
+	name   string
+	url    string
+	dishes []ai.MenuItem
+}
+
+func lunchOn(ctx context.Context, reader *menuReader, date time.Time) (lunchDay, error) {
+	files, err := reader.load(ctx, weekOf(date))
+	if err != nil {
+		return lunchDay{}, err
+	}
+
+	day := lunchDay{date: date}
+	for _, id := range reader.ids {
+		menu, ok := files.menus[id]
+		if !ok {
+			continue
+		}
+		// A day on the menu without dishes is a closed canteen, as far as a chat cares
+		if dishes, ok := menu.dishesOn(date); ok && len(dishes) > 0 {
+			restaurant := reader.restaurants[id]
+			day.restaurants = append(day.restaurants, restaurantDishes{name: restaurant.Name, url: restaurant.URL, dishes: dishes})
+		}
+	}
+	return day, nil
+}
+
+// webhook is an incoming webhook of a chat, and the format it takes messages in.
+type webhook struct {
+	format messageFormat
+	url    string
+}
+
+// parseWebhooks reads webhooks given as format=url, e.g.
+// "slack=https://hooks.slack.com/services/...".
+func parseWebhooks(specs []string) ([]webhook, error) {
+	var webhooks []webhook
+	for _, spec := range specs {
+		name, rawURL, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid webhook %q, want format=url, e.g. slack=https://hooks.slack.com/...", spec)
+		}
+		format, err := parseMessageFormat(name)
+		if err != nil {
+			return nil, err
+		}
+		if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("invalid %s webhook URL %q", format, rawURL)
+		}
+		webhooks = append(webhooks, webhook{format: format, url: rawURL})
+	}
+	return webhooks, nil
+}
+
+// String names the webhook without its URL, whose path is the secret that lets
+// anyone post to the channel.
+func (w webhook) String() string {
+	u, _ := url.Parse(w.url)
+	return fmt.Sprintf("the %s webhook at %s", w.format, u.Host)
+}
+
+// key tells the webhooks apart in the notified file, which sits in the storage
+// next to the menus - readable by anyone the menus are. So it is a hash of the
+// URL, never the URL.
+func (w webhook) key() string {
+	sum := sha256.Sum256([]byte(w.url))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (w webhook) post(ctx context.Context, client *http.Client, message []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(message))
+	if err != nil {
+		return fmt.Errorf("failed to post to %s: %w", w, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.Do(request)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// It quotes the URL
+		err = urlErr.Err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to post to %s: %w", w, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		// Slack and Teams say what they didn't like in the body
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("%s refused the message: %s: %s", w, response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// notified is which webhooks a day's menu was posted to, each with the time it
+// was.
+type notified struct {
+	Date     string            `json:"date"`
+	Webhooks map[string]string `json:"webhooks"`
+}
+
+// notifiedFilename is notified_<date>.json, next to the menus.
+func notifiedFilename(date time.Time) string {
+	return "notified_" + date.Format(time.DateOnly) + ".json"
+}
+
+func readNotified(ctx context.Context, store storage.Store, date time.Time) (*notified, error) {
+	posted := &notified{Date: date.Format(time.DateOnly), Webhooks: make(map[string]string)}
+
+	data, err := store.Get(ctx, notifiedFilename(date))
+	if errors.Is(err, storage.ErrNotFound) {
+		return posted, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, posted); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", notifiedFilename(date), err)
+	}
+	if posted.Webhooks == nil {
+		posted.Webhooks = make(map[string]string)
+	}
+	return posted, nil
+}
+
+func writeNotified(ctx context.Context, store storage.Store, date time.Time, posted *notified) error {
+	data, err := json.MarshalIndent(posted, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, notifiedFilename(date), data)
+}
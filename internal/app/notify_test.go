@@ -0,0 +1,201 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// chat stands in for the chats' incoming webhooks, each a path on one server.
+// A path in failing answers with an error.
+type chat struct {
+	mu       sync.Mutex
+	messages map[string][]string
+	failing  map[string]bool
+}
+
+func newChat(t *testing.T) (*chat, *httptest.Server) {
+	c := &chat{messages: make(map[string][]string), failing: make(map[string]bool)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.failing[r.URL.Path] {
+			http.Error(w, "invalid_blocks", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		c.messages[r.URL.Path] = append(c.messages[r.URL.Path], string(body))
+	}))
+	t.Cleanup(server.Close)
+	return c, server
+}
+
+func (c *chat) received(path string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.messages[path])
+}
+
+func TestNotifyPostsOnceADay(t *testing.T) {
+	store, restaurants := publishedMenus(t)
+	reader := newMenuReader(restaurants, store)
+	chat, server := newChat(t)
+
+	webhooks, err := parseWebhooks([]string{
+		"slack=" + server.URL + "/slack",
+		"Teams=" + server.URL + "/teams",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(config Config) error {
+		return notify(context.Background(), reader, webhooks, serveNow, config, server.Client())
+	}
+
+	// Teams is down: Slack gets the menu, and the run fails for Teams
+	chat.failing["/teams"] = true
+	if err := run(Config{}); err == nil || !strings.Contains(err.Error(), "invalid_blocks") {
+		t.Errorf("notify() error = %v, want Teams' refusal", err)
+	}
+	if err := run(Config{}); err == nil {
+		t.Error("notify() with Teams still down succeeded")
+	}
+	if chat.received("/slack") != 1 {
+		t.Fatalf("Slack got %d messages, want 1 across both runs", chat.received("/slack"))
+	}
+	if strings.Contains(string(mustGet(t, store, notifiedFilename(serveNow))), server.URL) {
+		t.Error("the notified file has the webhook's URL in it")
+	}
+
+	// Back up: only Teams is posted to, and after that nobody
+	chat.failing["/teams"] = false
+	for range 2 {
+		if err := run(Config{}); err != nil {
+			t.Fatalf("notify() error = %v", err)
+		}
+	}
+	if chat.received("/slack") != 1 || chat.received("/teams") != 1 {
+		t.Errorf("Slack got %d, Teams %d messages, want 1 each", chat.received("/slack"), chat.received("/teams"))
+	}
+
+	if err := run(Config{Force: true}); err != nil {
+		t.Fatalf("notify(-force) error = %v", err)
+	}
+	if chat.received("/slack") != 2 || chat.received("/teams") != 2 {
+		t.Errorf("-force: Slack got %d, Teams %d messages, want 2 each", chat.received("/slack"), chat.received("/teams"))
+	}
+
+	// A Saturday has nothing to post
+	if err := notify(context.Background(), reader, webhooks, serveNow.AddDate(0, 0, 1), Config{}, server.Client()); err != nil {
+		t.Errorf("notify(Saturday) error = %v", err)
+	}
+	if chat.received("/slack") != 2 {
+		t.Errorf("Slack got a message on a Saturday")
+	}
+}
+
+func mustGet(t *testing.T, store storage.Store, name string) []byte {
+	t.Helper()
+	data, err := store.Get(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestMessages(t *testing.T) {
+	store, restaurants := publishedMenus(t)
+	day, err := lunchOn(context.Background(), newMenuReader(restaurants, store), serveNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(day.restaurants) != 2 || day.restaurants[0].name != "Gira" || day.restaurants[1].name != "Turbolama" {
+		t.Fatalf("restaurants = %+v, want Gira and Turbolama", day.restaurants)
+	}
+
+	for _, format := range messageFormats {
+		message, err := format.render(day)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		text := string(message)
+		if !json.Valid(message) {
+			t.Errorf("%s: invalid JSON %s", format, text)
+		}
+		for _, want := range []string{"Lunch on Friday, 17 July", "Poulet Cordon Bleu", "Curry Bowl", "🍗", "https://example.test/postino.jpg", "https://gira.example/menu"} {
+			if !strings.Contains(text, want) {
+				t.Errorf("%s message has no %q: %s", format, want, text)
+			}
+		}
+	}
+
+	var slack struct {
+		Blocks []struct {
+			Type      string
+			Accessory *struct {
+				ImageURL string `json:"image_url"`
+			}
+		}
+	}
+	message, _ := formatSlack.render(day)
+	json.Unmarshal(message, &slack)
+	photos := 0
+	for _, block := range slack.Blocks {
+		if block.Accessory != nil && block.Accessory.ImageURL != "" {
+			photos++
+		}
+	}
+	if photos != 1 {
+		t.Errorf("Slack message has %d thumbnails, want the one photo", photos)
+	}
+}
+
+func TestSlackMessageStaysUnderTheBlockLimit(t *testing.T) {
+	day := lunchDay{date: serveNow}
+	for range 6 {
+		restaurant := restaurantDishes{name: "Gira <&>", url: "https://gira.example"}
+		for range 10 {
+			restaurant.dishes = append(restaurant.dishes, ai.MenuItem{Name: "Dal", Photo: "https://example.test/dal.jpg"})
+		}
+		day.restaurants = append(day.restaurants, restaurant)
+	}
+
+	message := slackMessage(day)
+	blocks := message["blocks"].([]map[string]any)
+	if len(blocks) > slackBlockLimit {
+		t.Errorf("%d blocks, Slack takes %d", len(blocks), slackBlockLimit)
+	}
+	if text := blocks[1]["text"].(map[string]any)["text"].(string); !strings.Contains(text, "|Gira &lt;&amp;&gt;>") {
+		t.Errorf("the restaurant's name is not escaped: %q", text)
+	}
+}
+
+func TestParseWebhooks(t *testing.T) {
+	for _, spec := range []string{
+		"https://hooks.slack.com/services/x",
+		"discord=https://discord.example/hook",
+		"slack=hooks.slack.com/services/x",
+		"markdown=",
+	} {
+		if _, err := parseWebhooks([]string{spec}); err == nil {
+			t.Errorf("parseWebhooks(%q) succeeded, want an error", spec)
+		}
+	}
+
+	webhooks, err := parseWebhooks([]string{"markdown=https://chat.example/hooks/secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := webhooks[0].String(); strings.Contains(got, "secret") {
+		t.Errorf("String() = %q, gives the secret away", got)
+	}
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/replay"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// parseCachePrefix is where the parse cache keeps its days: parses/<key>.json.
+const parseCachePrefix = "parses/"
+
+// parseCacheRetention is how long a day is kept: a week is only fetched again
+// while it is current.
+const parseCacheRetention = 7 * 24 * time.Hour
+
+// parseCache keeps the days the model parsed, under a hash of what it was asked:
+// the prompt (see ai.Parser.PromptKey), the model and the day's HTML. A day that is the same as on
+// an earlier run, e.g. when a failed upload is retried or the week is fetched
+// again, is taken from there rather than parsed again, which is free, quick and
+// gives the same dishes as the first time.
+//
+// Only days that passed validation are kept, so that a day the model got wrong is
+// parsed again the next time rather than kept wrong.
+//
+// The cache is a local directory, never the storage: the storage is the public
+// bucket, and the model's raw answers are not for publishing.
+//
+// A nil parseCache keeps nothing, so callers can use one unconditionally.
+type parseCache struct {
+	store storage.Store
+}
+
+// openParseCache opens the cache in the directory parseCacheDir names. A run on a
+// tape has none: a day taken from the cache would be missing from the recording,
+// and a replay is there to parse what was recorded. Days parsed longer ago than
+// parseCacheRetention are dropped on the way.
+func openParseCache(config Config) (*parseCache, error) {
+	if config.RecordDir != "" || config.ReplayDir != "" {
+		return nil, nil
+	}
+	dir, err := parseCacheDir(config)
+	if dir == "" || err != nil {
+		return nil, err
+	}
+	store, err := storage.NewDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	cache := &parseCache{store: store}
+	cache.expire(context.Background(), time.Now().Add(-parseCacheRetention))
+	return cache, nil
+}
+
+// parseCacheDir is the directory parsed days are cached in: the flag if given,
+// else the PARSE_CACHE_DIR environment variable, else, when the run uploads, the
+// user's cache directory. Runs that upload nowhere have none.
+func parseCacheDir(config Config) (string, error) {
+	if config.ParseCacheDir != "" {
+		return config.ParseCacheDir, nil
+	}
+	if dir := os.Getenv("PARSE_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	if !config.Upload {
+		return "", nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lunch-wankdorf"), nil
+}
+
+// expire deletes the days parsed before cutoff.
+func (c *parseCache) expire(ctx context.Context, cutoff time.Time) {
+	objects, err := c.store.List(ctx, parseCachePrefix)
+	if err != nil {
+		slog.WarnContext(ctx, "Could not list the parse cache", "error", err)
+		return
+	}
+	for _, object := range objects {
+		if !object.Modified.Before(cutoff) {
+			continue
+		}
+		if err := c.store.Delete(ctx, object.Name); err != nil {
+			slog.WarnContext(ctx, "Could not drop an old day from the parse cache", "error", err)
+		}
+	}
+}
+
+// cachedDay is a day as the cache keeps it. Everything but the items is there for
+// whoever looks at the file.
+type cachedDay struct {
+	PromptVersion int           `json:"promptVersion"`
+	Model         string        `json:"model"`
+	Day           string        `json:"day"`
+	Date          string        `json:"date,omitempty"`
+	Parsed        time.Time     `json:"parsed"`
+	Items         []ai.MenuItem `json:"items"`
+}
+
+func (c *parseCache) filename(parser *ai.Parser, day scraper.DayMenu) string {
+	return parseCachePrefix + replay.Hash(parser.PromptKey(), parser.Model(), day.Day, day.HTML) + ".json"
+}
+
+// get returns the day's items if the day was parsed before, exactly as it is now.
+func (c *parseCache) get(ctx context.Context, parser *ai.Parser, day scraper.DayMenu) ([]ai.MenuItem, bool) {
+	if c == nil {
+		return nil, false
+	}
+	filename := c.filename(parser, day)
+	data, err := c.store.Get(ctx, filename)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			slog.WarnContext(ctx, "Could not read the day from the parse cache", "error", err)
+		}
+		return nil, false
+	}
+
+	var cached cachedDay
+	if err := json.Unmarshal(data, &cached); err != nil {
+		slog.WarnContext(ctx, "Ignoring a broken day in the parse cache", "file", filename, "error", err)
+		return nil, false
+	}
+	return cached.Items, true
+}
+
+// put keeps the day's items for the next run.
+func (c *parseCache) put(ctx context.Context, parser *ai.Parser, day scraper.DayMenu, items []ai.MenuItem) {
+	if c == nil {
+		return
+	}
+	data, err := json.MarshalIndent(cachedDay{
+		PromptVersion: parser.PromptVersion(),
+		Model:         parser.Model(),
+		Day:           day.Day,
+		Date:          day.Date,
+		Parsed:        time.Now().UTC().Truncate(time.Second),
+		Items:         items,
+	}, "", "  ")
+	if err == nil {
+		err = c.store.Put(ctx, c.filename(parser, day), data)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Could not keep the day in the parse cache", "error", err)
+	}
+}
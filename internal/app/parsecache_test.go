@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+func TestParseCache(t *testing.T) {
+	cache, err := openParseCache(Config{ParseCacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parse := func(provider *scriptedProvider, html string) ([]ai.MenuItem, []string) {
+		t.Helper()
+		day := validatedDay
+		day.HTML = html
+		items, problems, err := parseDayWithRetry(context.Background(), ai.NewParser(provider, nil), day, cache)
+		if err != nil {
+			t.Fatalf("parseDayWithRetry() error = %v", err)
+		}
+		return items, problems
+	}
+
+	first := &scriptedProvider{answers: []string{correctAnswer}}
+	parsed, _ := parse(first, validatedDay.HTML)
+
+	// The same day again is not sent to the model
+	again := &scriptedProvider{answers: []string{duplicatedAnswer}}
+	if items, problems := parse(again, validatedDay.HTML); len(again.prompts) != 0 || len(problems) != 0 || !reflect.DeepEqual(items, parsed) {
+		t.Errorf("sent %d prompts for a day that was parsed before, got %+v, want %+v", len(again.prompts), items, parsed)
+	}
+
+	// A restaurant that adds a hint to the prompt gets the day parsed again
+	hinted, _ := ai.NewParser(again, nil).ForRestaurant(ai.Prompt{Hints: []string{"Pizza is vegan."}})
+	if _, ok := cache.get(context.Background(), hinted, validatedDay); ok {
+		t.Error("a day parsed with another prompt was taken from the cache")
+	}
+
+	// A day that changed is
+	changed := validatedDay.HTML + `<div><h3>Dessert</h3><p>Tiramisu</p></div>`
+	if parse(again, changed); len(again.prompts) == 0 {
+		t.Error("a day that changed was taken from the cache")
+	}
+
+	// And so is a day that failed validation, until the model gets it right
+	failing := &scriptedProvider{answers: []string{duplicatedAnswer}}
+	if _, problems := parse(failing, changed); len(problems) == 0 || len(failing.prompts) == 0 {
+		t.Errorf("a day that failed validation was taken from the cache (%d prompts)", len(failing.prompts))
+	}
+
+	// Runs on a tape and runs that upload nowhere have no cache
+	t.Setenv("PARSE_CACHE_DIR", "")
+	for _, config := range []Config{{RecordDir: t.TempDir(), ParseCacheDir: t.TempDir()}, {}} {
+		if cache, err := openParseCache(config); cache != nil || err != nil {
+			t.Errorf("openParseCache(%+v) = %v, %v, want none", config, cache, err)
+		}
+	}
+}
+
+// The model's answers stay on the machine that ran it: a run that uploads keeps
+// them in the user's cache directory, never in the storage, which is public.
+func TestParseCacheIsNotInTheStorage(t *testing.T) {
+	t.Setenv("PARSE_CACHE_DIR", "")
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	storageDir := t.TempDir()
+	cache, err := openParseCache(Config{Upload: true, Storage: storage.BackendLocal, StorageDir: storageDir})
+	if err != nil || cache == nil {
+		t.Fatalf("openParseCache() = %v, %v, want the user's cache directory", cache, err)
+	}
+	cache.put(context.Background(), ai.NewParser(&scriptedProvider{}, nil), validatedDay, nil)
+
+	if entries, _ := os.ReadDir(storageDir); len(entries) != 0 {
+		t.Errorf("the storage has %v, want nothing", entries)
+	}
+	dir, _ := os.UserCacheDir()
+	if cached, _ := filepath.Glob(filepath.Join(dir, "lunch-wankdorf", "parses", "*.json")); len(cached) != 1 {
+		t.Errorf("the cache directory has %v, want the day", cached)
+	}
+}
+
+// A run that is retried, each time in a container of its own, finds the days the
+// first one parsed in the directory it is given.
+func TestParseCacheIsSharedByRunsOnTheSameDirectory(t *testing.T) {
+	t.Setenv("PARSE_CACHE_DIR", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	run := func(provider *scriptedProvider) {
+		t.Helper()
+		cache, err := openParseCache(Config{Upload: true})
+		if err != nil || cache == nil {
+			t.Fatalf("openParseCache() = %v, %v, want the configured directory", cache, err)
+		}
+		if _, _, err := parseDayWithRetry(context.Background(), ai.NewParser(provider, nil), validatedDay, cache); err != nil {
+			t.Fatalf("parseDayWithRetry() error = %v", err)
+		}
+	}
+
+	first := &scriptedProvider{answers: []string{correctAnswer}}
+	run(first)
+	retry := &scriptedProvider{answers: []string{correctAnswer}}
+	run(retry)
+	if len(first.prompts) == 0 || len(retry.prompts) != 0 {
+		t.Errorf("the runs sent %d and %d prompts, want only the first to", len(first.prompts), len(retry.prompts))
+	}
+}
+
+func TestParseCacheExpiresOldDays(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := openParseCache(Config{ParseCacheDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := ai.NewParser(&scriptedProvider{}, nil)
+	ctx := context.Background()
+	cache.put(ctx, parser, validatedDay, nil)
+	old := filepath.Join(dir, filepath.FromSlash(cache.filename(parser, validatedDay)))
+	lastWeek := time.Now().Add(-parseCacheRetention - time.Hour)
+	if err := os.Chtimes(old, lastWeek, lastWeek); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openParseCache(Config{ParseCacheDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.get(ctx, parser, validatedDay); ok {
+		t.Error("a day parsed more than a week ago is still in the cache")
+	}
+}
@@ -1,9 +1,10 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"sort"
 	"strings"
@@ -11,6 +12,8 @@ import (
 	"time"
 
 	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/logging"
+	"github.com/chlab/lunch-wankdorf/pkg/metrics"
 	"github.com/chlab/lunch-wankdorf/pkg/scraper"
 )
 
@@ -25,7 +28,7 @@ const (
 // found. Where a photo comes from depends on the restaurant: Espace puts them on
 // the menu page (keyed by category), food2050 only on the dish pages we already
 // link to.
-func addPhotos(menu *ai.DailyMenu, days []scraper.DayMenu) int {
+func addPhotos(ctx context.Context, menu *ai.DailyMenu, days []scraper.DayMenu, client *http.Client) int {
 	photosByDay := make(map[string]map[string]string, len(days))
 	for _, day := range days {
 		photosByDay[day.Day] = day.Photos
@@ -44,19 +47,18 @@ func addPhotos(menu *ai.DailyMenu, days []scraper.DayMenu) int {
 		}
 	}
 
-	found := fromPage.added + fetchDishPhotos(toFetch)
-	log.Printf("Photos: %d of %d dishes have one", found, countItems(menu))
+	found := fromPage.added + fetchDishPhotos(ctx, client, toFetch)
+	slog.InfoContext(ctx, "Dish photos found", "photos", found, "dishes", countItems(menu))
 
 	return found
 }
 
 // fetchDishPhotos looks up each dish's photo on its own page, in parallel.
-func fetchDishPhotos(items []*ai.MenuItem) int {
+func fetchDishPhotos(ctx context.Context, client *http.Client, items []*ai.MenuItem) int {
 	if len(items) == 0 {
 		return 0
 	}
 
-	client := &http.Client{Timeout: photoFetchTimeout}
 	queue := make(chan *ai.MenuItem)
 
 	var mu sync.Mutex
@@ -71,12 +73,15 @@ func fetchDishPhotos(items []*ai.MenuItem) int {
 				photo, err := scraper.FetchDishPhoto(client, item.Link)
 				if err != nil {
 					// A missing photo is not worth failing the menu over
-					log.Printf("Warning: could not fetch the photo for %q: %v", item.Name, err)
+					metrics.PhotoFetches.WithLabelValues("error").Inc()
+					slog.WarnContext(ctx, "Could not fetch the dish's photo", "dish", item.Name, "error", err)
 					continue
 				}
 				if photo == "" {
+					metrics.PhotoFetches.WithLabelValues("none").Inc()
 					continue
 				}
+				metrics.PhotoFetches.WithLabelValues("found").Inc()
 
 				thumb, large := scraper.PhotoURLs(photo)
 
@@ -189,22 +194,32 @@ func countItems(menu *ai.DailyMenu) int {
 func RunPhotoUpdate(config Config) error {
 	loadEnv()
 
-	restaurant, exists := restaurantMenus[config.RestaurantID]
-	if !exists {
-		return fmt.Errorf("restaurant with ID '%s' not found", config.RestaurantID)
+	restaurants, err := loadRegistry(restaurantsFile(config))
+	if err != nil {
+		return err
+	}
+
+	restaurant, err := restaurants.lookup(config.RestaurantID)
+	if err != nil {
+		return err
 	}
-	if !restaurant.HasCustomScraper {
+	if restaurant.Scraper != "sv" {
 		return fmt.Errorf("%s publishes its photos on the dish pages, which the weekly run already fetches", restaurant.Name)
 	}
 
 	// Only today's photos can be new: Espace publishes a day's photos on the morning
 	// of that day, and every earlier day of the week was picked up by the run on its
 	// own morning. Asking for the whole week would re-scrape days we already have.
-	today := time.Now().Format(time.DateOnly)
+	now := time.Now()
+	today := now.Format(time.DateOnly)
 
-	log.Printf("Looking for new %s photos for %s", restaurant.Name, today)
+	ctx := logging.With(context.Background(), "restaurant", restaurant.ID)
+	slog.InfoContext(ctx, "Looking for new photos", "date", today)
 
-	scraped, err := scraper.ScrapeEspaceDay(restaurant.URL, today, config.DebugMode)
+	browser := scraper.NewBrowser(config.DebugMode)
+	defer browser.Close()
+
+	scraped, err := scraper.ScrapeEspaceDay(ctx, browser, restaurant.URL, today, config.DebugMode)
 	if err != nil {
 		return fmt.Errorf("error scraping menu data: %w", err)
 	}
@@ -216,16 +231,17 @@ func RunPhotoUpdate(config Config) error {
 		scrapedPhotos += len(day.Photos)
 	}
 	if scrapedPhotos == 0 {
-		log.Println("No photos published yet, nothing to do")
+		slog.InfoContext(ctx, "No photos published yet, nothing to do")
 		return nil
 	}
 
-	bucket, err := openMenuBucket()
+	store, err := openStore(config)
 	if err != nil {
 		return err
 	}
 
-	menuJSON, err := bucket.get(restaurant.Name)
+	filename := menuFilename(restaurant.Name, weekOf(now))
+	menuJSON, err := store.Get(ctx, filename)
 	if err != nil {
 		return err
 	}
@@ -241,14 +257,13 @@ func RunPhotoUpdate(config Config) error {
 	// one thing that ties a photo to a dish. Say so, rather than reporting "nothing
 	// to do" and looking like a quiet success.
 	if result.unmatched > 0 {
-		log.Printf("Warning: %d photos matched no menu item (categories: %s). "+
-			"Has the menu been parsed since categories were added?",
-			result.unmatched, strings.Join(result.unmatchedCategories, ", "))
+		slog.WarnContext(ctx, "Photos matched no menu item. Has the menu been parsed since categories were added?",
+			"unmatched", result.unmatched, "categories", strings.Join(result.unmatchedCategories, ", "))
 	}
 
 	if result.added == 0 {
-		log.Printf("Found %d photos, %d already published, nothing to add",
-			scrapedPhotos, result.alreadySet)
+		slog.InfoContext(ctx, "All the photos are already published, nothing to add",
+			"photos", scrapedPhotos, "published", result.alreadySet)
 		return nil
 	}
 	added := result.added
@@ -258,16 +273,18 @@ func RunPhotoUpdate(config Config) error {
 		return fmt.Errorf("failed to marshal menu: %w", err)
 	}
 
-	if !config.UploadToR2 {
+	if !config.Upload {
 		fmt.Println(string(updated))
-		log.Printf("Would add %d photos (pass -upload to publish them)", added)
+		slog.InfoContext(ctx, "Would add photos (pass -upload to publish them)", "photos", added)
 		return nil
 	}
 
-	if err := bucket.put(restaurant.Name, updated); err != nil {
+	// Published the way a run publishes it, so the archive, the calendars and the
+	// feed (where readers see the days that got photos as updated) have the same
+	// menu as the JSON
+	if err := uploadMenu(ctx, updated, restaurant.Name, weekOf(now), config); err != nil {
 		return err
 	}
-
-	log.Printf("Added %d photos to the %s menu", added, restaurant.Name)
+	slog.InfoContext(ctx, "Added photos to the menu", "photos", added, "file", filename)
 	return nil
 }
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// DefaultRetention keeps last week's menus along with this week's and the next.
+const DefaultRetention = 7 * 24 * time.Hour
+
+// RunPrune deletes the week files (menus and their calendars) and notification
+// markers that are older than the retention, after copying the menus into the
+// archive unless config.Archive is off. Nothing is deleted if archiving fails.
+//
+// It archives what RunArchive does, the menus of the restaurants in the registry.
+// A menu of any other restaurant is left where it is when archiving, rather than
+// deleted without having been archived.
+func RunPrune(config Config) error {
+	// Load environment variables from .env file
+	loadEnv()
+
+	restaurants, err := loadRegistry(restaurantsFile(config))
+	if err != nil {
+		return err
+	}
+	store, err := openStore(config)
+	if err != nil {
+		return err
+	}
+	_, err = prune(context.Background(), store, restaurants, time.Now(), config)
+	return err
+}
+
+// prune returns how many files it deleted.
+func prune(ctx context.Context, store storage.Store, restaurants registry, now time.Time, config Config) (int, error) {
+	if config.Retention < 0 {
+		return 0, fmt.Errorf("invalid retention %s", config.Retention)
+	}
+	cutoff := now.Add(-config.Retention)
+	slog.InfoContext(ctx, "Pruning old files", "week", weekOf(cutoff).String(), "cutoff", cutoff.Format(time.DateOnly))
+
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	if config.Archive {
+		if _, err := archiveAll(ctx, store, restaurants, config.DryRun); err != nil {
+			return 0, fmt.Errorf("failed to archive the menus, so nothing was deleted: %w", err)
+		}
+	}
+
+	deleted := 0
+	var errs []error
+	for _, object := range objects {
+		if !expired(object.Name, cutoff) {
+			continue
+		}
+		if _, _, menu := parseMenuFilename(object.Name); menu && config.Archive && !restaurants.hasMenu(object.Name) {
+			slog.WarnContext(ctx, "Leaving the menu of a restaurant that isn't in the registry, as it wasn't archived", "file", object.Name)
+			continue
+		}
+		if config.DryRun {
+			slog.InfoContext(ctx, "Would delete the file", "file", object.Name)
+		} else {
+			if err := store.Delete(ctx, object.Name); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			slog.InfoContext(ctx, "Deleted the file", "file", object.Name)
+		}
+		deleted++
+	}
+
+	if config.DryRun {
+		slog.InfoContext(ctx, "Would delete files (dry run, nothing was deleted)", "files", deleted)
+	} else {
+		slog.InfoContext(ctx, "Deleted files", "files", deleted, "storage", store.String())
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// expired reports whether the file is one that pruning deletes, and is from
+// before the cutoff: a menu or its week's calendar from an earlier week than the
+// cutoff's, or a notification marker from an earlier day. Everything else, the
+// archive, the feeds and the calendars to subscribe to among them, is kept.
+func expired(name string, cutoff time.Time) bool {
+	if date, ok := strings.CutPrefix(name, "notified_"); ok {
+		day, err := time.Parse(time.DateOnly, strings.TrimSuffix(date, ".json"))
+		return err == nil && day.Format(time.DateOnly) < cutoff.Format(time.DateOnly)
+	}
+
+	// <restaurantname>_<weeknumber>_<year>.ics is named after its menu
+	if calendar, ok := strings.CutSuffix(name, ".ics"); ok {
+		name = calendar + ".json"
+	}
+	_, week, ok := parseMenuFilename(name)
+	return ok && week.before(weekOf(cutoff))
+}
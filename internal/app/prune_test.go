@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+func TestExpired(t *testing.T) {
+	tests := []struct {
+		name    string
+		cutoff  string // a week before the run
+		expired bool
+	}{
+		{"gira_28_2026.json", "2026-07-13", true},
+		{"gira_28_2026.ics", "2026-07-13", true},
+		{"gira_29_2026.json", "2026-07-13", false}, // the cutoff's week is kept
+		{"gira_30_2026.json", "2026-07-13", false},
+		// Week 53 of 2026 runs until 3 January 2027
+		{"gira_52_2026.json", "2027-01-02", true},
+		{"gira_53_2026.json", "2027-01-02", false},
+		{"gira_1_2027.json", "2027-01-02", false},
+		{"gira_53_2026.json", "2027-01-04", true},
+		// 29 December 2025 is in week 1 of 2026
+		{"gira_52_2025.json", "2025-12-29", true},
+		{"gira_1_2026.json", "2025-12-29", false},
+		{"notified_2026-07-09.json", "2026-07-10", true},
+		{"notified_2026-07-10.json", "2026-07-10", false},
+		{"gira.ics", "2027-01-04", false},
+		{"gira.atom", "2027-01-04", false},
+		{"restaurants.json", "2027-01-04", false},
+		{"archive/2025/52/gira.json", "2027-01-04", false},
+		{"archive/index.json", "2027-01-04", false},
+		{"history/gira.sqlite", "2027-01-04", false},
+	}
+	for _, tt := range tests {
+		cutoff, _ := time.Parse(time.DateOnly, tt.cutoff)
+		if got := expired(tt.name, cutoff.Add(12*time.Hour)); got != tt.expired {
+			t.Errorf("expired(%s, %s) = %v, want %v", tt.name, tt.cutoff, got, tt.expired)
+		}
+	}
+}
+
+// failingPuts is a store that can't write, e.g. one without the permission to.
+type failingPuts struct {
+	storage.Store
+}
+
+func (failingPuts) Put(context.Context, string, []byte) error {
+	return errors.New("access denied")
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	newStore := func(t *testing.T) storage.Store {
+		t.Helper()
+		store, err := storage.NewDir(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"gira_51_2026.json", "gira_51_2026.ics", "gira_52_2026.json", "gira_53_2026.json", "gira_1_2027.json", "gira.ics", "notified_2026-12-24.json", "notified_2026-12-28.json", "closed_51_2026.json"} {
+			if err := store.Put(ctx, name, []byte(`{}`)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return store
+	}
+	names := func(store storage.Store) []string {
+		objects, _ := store.List(ctx, "")
+		var names []string
+		for _, object := range objects {
+			names = append(names, object.Name)
+		}
+		return names
+	}
+	// The Sunday the prune workflow runs on, so week 52 is last week
+	now := time.Date(2027, 1, 3, 23, 0, 0, 0, time.UTC)
+	config := Config{Retention: DefaultRetention, Archive: true}
+	// Closed isn't in it: its menu is neither archived nor deleted, as archive
+	// wouldn't archive it either
+	restaurants := registry{"gira": {ID: "gira", Name: "Gira"}}
+
+	t.Run("dry run", func(t *testing.T) {
+		store := newStore(t)
+		before := names(store)
+		config := config
+		config.DryRun = true
+		if deleted, err := prune(ctx, store, restaurants, now, config); deleted != 3 || err != nil {
+			t.Fatalf("prune() = %d, %v, want 3", deleted, err)
+		}
+		if after := names(store); !reflect.DeepEqual(after, before) {
+			t.Errorf("the dry run left %v, want %v", after, before)
+		}
+	})
+
+	t.Run("archives before it deletes", func(t *testing.T) {
+		store := newStore(t)
+		if deleted, err := prune(ctx, store, restaurants, now, config); deleted != 3 || err != nil {
+			t.Fatalf("prune() = %d, %v, want 3", deleted, err)
+		}
+		want := []string{
+			"archive/2026/51/gira.json",
+			"archive/2026/52/gira.json",
+			"archive/2026/53/gira.json",
+			"archive/2027/1/gira.json",
+			"archive/index.json",
+			"closed_51_2026.json",
+			"gira.ics",
+			"gira_1_2027.json",
+			"gira_52_2026.json",
+			"gira_53_2026.json",
+			"notified_2026-12-28.json",
+		}
+		if got := names(store); !reflect.DeepEqual(got, want) {
+			t.Errorf("prune() left %v, want %v", got, want)
+		}
+	})
+
+	t.Run("deletes nothing it couldn't archive", func(t *testing.T) {
+		store := newStore(t)
+		before := names(store)
+		if _, err := prune(ctx, failingPuts{store}, restaurants, now, config); err == nil {
+			t.Fatal("prune() succeeded without archiving")
+		}
+		if after := names(store); !reflect.DeepEqual(after, before) {
+			t.Errorf("prune() left %v, want %v", after, before)
+		}
+	})
+
+	t.Run("without archiving", func(t *testing.T) {
+		store := newStore(t)
+		config := config
+		config.Archive = false
+		config.Retention = 0
+		if deleted, err := prune(ctx, store, restaurants, now, config); deleted != 6 || err != nil {
+			t.Fatalf("prune() = %d, %v, want 6", deleted, err)
+		}
+		if got, want := names(store), []string{"gira.ics", "gira_1_2027.json", "gira_53_2026.json"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("prune() left %v, want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+	_ "time/tzdata" // so the canteens' time zone is there on a host without one
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// zurich is the canteens' time zone. "Today" and "this week" are theirs, wherever
+// the server or the job runs.
+var zurich = sync.OnceValue(func() *time.Location {
+	location, err := time.LoadLocation("Europe/Zurich")
+	if err != nil {
+		panic(fmt.Sprintf("no time zone data for the canteens: %v", err))
+	}
+	return location
+})
+
+// menuReader reads the published menus back, by week, for whatever presents them
+// (see Serve and RunNotify).
+type menuReader struct {
+	restaurants registry
+	ids         []string // the restaurants' IDs, sorted, so everything lists them in a stable order
+	store       storage.Store
+
+	// A reader that is asked again and again (the API) keeps what it read for
+	// cacheFor, by the clock now, rather than go to the storage for every request.
+	// Zero reads the storage every time.
+	cacheFor time.Duration
+	now      func() time.Time
+	mu       sync.Mutex
+	cache    map[string]cachedMenu // by filename
+}
+
+// cachedMenu is a menu file as it was read, or nil if it wasn't published then.
+type cachedMenu struct {
+	menu     *menuFile
+	modified time.Time
+	read     time.Time
+}
+
+func newMenuReader(restaurants registry, store storage.Store) *menuReader {
+	m := &menuReader{restaurants: restaurants, store: store}
+	for id := range restaurants {
+		m.ids = append(m.ids, id)
+	}
+	sort.Strings(m.ids)
+	return m
+}
+
+// weekFiles are the menu files published for a week, by restaurant ID.
+type weekFiles struct {
+	menus    map[string]*menuFile
+	modified time.Time // when the newest of them was written
+}
+
+// load reads the week's menu files of the restaurants with the given IDs, or of
+// every restaurant if none are given. A restaurant that has not published the
+// week is left out.
+func (m *menuReader) load(ctx context.Context, week isoWeek, ids ...string) (weekFiles, error) {
+	if len(ids) == 0 {
+		ids = m.ids
+	}
+
+	files := weekFiles{menus: make(map[string]*menuFile)}
+	for _, id := range ids {
+		name := m.restaurants[id].Name
+		menu, modified, err := m.read(ctx, menuFilename(name, week), name)
+		if err != nil {
+			return weekFiles{}, err
+		}
+		if menu == nil {
+			continue
+		}
+		files.menus[id] = menu
+		if modified.After(files.modified) {
+			files.modified = modified
+		}
+	}
+	return files, nil
+}
+
+// read returns a restaurant's menu file and when it was written, or nil if it
+// isn't published. A file read less than cacheFor ago is not read again, nor is
+// one found missing: a menu published in between is served once that has passed.
+func (m *menuReader) read(ctx context.Context, filename, restaurantName string) (*menuFile, time.Time, error) {
+	if m.cacheFor > 0 {
+		m.mu.Lock()
+		cached, ok := m.cache[filename]
+		m.mu.Unlock()
+		if ok && m.now().Sub(cached.read) < m.cacheFor {
+			return cached.menu, cached.modified, nil
+		}
+	}
+
+	menu, modified, err := m.readStorage(ctx, filename, restaurantName)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if m.cacheFor > 0 {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		now := m.now()
+		if m.cache == nil {
+			m.cache = make(map[string]cachedMenu)
+		}
+		// Weeks that are no longer asked for are dropped as others come in, so
+		// the cache doesn't keep every week anyone ever looked at
+		for name, cached := range m.cache {
+			if now.Sub(cached.read) >= m.cacheFor {
+				delete(m.cache, name)
+			}
+		}
+		m.cache[filename] = cachedMenu{menu: menu, modified: modified, read: now}
+	}
+	return menu, modified, nil
+}
+
+// readStorage reads a menu file in one request, which says since when it is
+// there as well.
+func (m *menuReader) readStorage(ctx context.Context, filename, restaurantName string) (*menuFile, time.Time, error) {
+	data, object, err := m.store.GetObject(ctx, filename)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	menu := &menuFile{raw: data}
+	if err := json.Unmarshal(data, menu); err != nil {
+		slog.WarnContext(ctx, "Skipping a file that is not a menu", "file", filename, "error", err)
+		return nil, time.Time{}, nil
+	}
+	menu.restaurantName = restaurantName
+	return menu, object.Modified, nil
+}
+
+// menuFile is a published menu as it is read back: a DailyMenu or a WeeklyMenu,
+// told apart by its type.
+type menuFile struct {
+	Type string `json:"type"`
+	ai.MenuMeta
+	Menu json.RawMessage `json:"menu"`
+
+	raw            json.RawMessage // the file as it is stored
+	restaurantName string          // for the dishes that don't say
+}
+
+// menuDay is one day of a menu file. A weekly menu is a single menuDay without a
+// name or date.
+type menuDay struct {
+	name   string // "Monday"
+	date   string
+	dishes []ai.MenuItem
+}
+
+// days returns the file's days from Monday to Sunday. Dates the file doesn't
+// carry (schema version 1) are worked out from the week it was published for.
+func (f *menuFile) days(week isoWeek) []menuDay {
+	if f.Type == "weekly" {
+		var dishes []ai.MenuItem
+		if err := json.Unmarshal(f.Menu, &dishes); err != nil {
+			return nil
+		}
+		return []menuDay{{dishes: f.withRestaurant(dishes)}}
+	}
+
+	var byDay map[string][]ai.MenuItem
+	if err := json.Unmarshal(f.Menu, &byDay); err != nil {
+		return nil
+	}
+	var days []menuDay
+	for _, weekday := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		name := weekday.String()
+		dishes, ok := byDay[name]
+		if !ok {
+			continue
+		}
+		date := f.Days[name].Date
+		if date == "" {
+			date = week.date(weekday)
+		}
+		days = append(days, menuDay{name: name, date: date, dishes: f.withRestaurant(dishes)})
+	}
+	return days
+}
+
+// dishesOn returns the dishes served on date, and whether the menu has the day at
+// all. A weekly menu is served Monday to Friday.
+func (f *menuFile) dishesOn(date time.Time) ([]ai.MenuItem, bool) {
+	for _, day := range f.days(weekOf(date)) {
+		if day.name == "" && date.Weekday() != time.Saturday && date.Weekday() != time.Sunday {
+			return day.dishes, true
+		}
+		if day.name == date.Weekday().String() {
+			return day.dishes, true
+		}
+	}
+	return nil, false
+}
+
+func (f *menuFile) withRestaurant(dishes []ai.MenuItem) []ai.MenuItem {
+	for i := range dishes {
+		if dishes[i].Restaurant == "" {
+			dishes[i].Restaurant = f.restaurantName
+		}
+	}
+	if dishes == nil {
+		dishes = []ai.MenuItem{}
+	}
+	return dishes
+}
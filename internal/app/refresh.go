@@ -0,0 +1,243 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/replay"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// dayMeta is what the page said about a day, for the menu's metadata.
+func dayMeta(day scraper.DayMenu) ai.DayMeta {
+	meta := ai.DayMeta{Date: day.Date, DishesOnPage: day.Dishes}
+	if len(day.Items) > 0 {
+		meta.Scraped = make([]string, len(day.Items))
+		for i, dish := range day.Items {
+			meta.Scraped[i] = dish.Category + ": " + strings.Join(strings.Fields(dish.Description), " ")
+		}
+	} else {
+		meta.PageHash = replay.Hash(day.HTML)
+	}
+	return meta
+}
+
+// dayChange is how a day on the page differs from the published one.
+type dayChange struct {
+	day            string   // "Wednesday"
+	added, removed []string // dishes, "category: description"
+	page           bool     // the page changed, for scrapers that don't list the dishes
+	unpublished    bool     // the day isn't in the published menu
+	gone           bool     // the day is in the published menu, but no longer on the page
+}
+
+func (c dayChange) changed() bool {
+	return len(c.added) > 0 || len(c.removed) > 0 || c.page || c.unpublished || c.gone
+}
+
+func (c dayChange) String() string {
+	if c.unpublished {
+		return c.day + ": not published yet"
+	}
+	if c.gone {
+		return c.day + ": no longer on the page"
+	}
+	var parts []string
+	for _, dish := range c.removed {
+		parts = append(parts, "- "+dish)
+	}
+	for _, dish := range c.added {
+		parts = append(parts, "+ "+dish)
+	}
+	if c.page {
+		parts = append(parts, "the page changed")
+	}
+	return c.day + ": " + strings.Join(parts, "; ")
+}
+
+// attrs is the change as a log record's attributes, for a diff that can be read
+// back out of the JSON log.
+func (c dayChange) attrs() []any {
+	attrs := []any{"day", c.day}
+	switch {
+	case c.unpublished:
+		attrs = append(attrs, "unpublished", true)
+	case c.gone:
+		attrs = append(attrs, "gone", true)
+	case c.page:
+		attrs = append(attrs, "pageChanged", true)
+	default:
+		attrs = append(attrs, "added", c.added, "removed", c.removed)
+	}
+	return attrs
+}
+
+// compareDay compares a day on the page to what was published for it.
+func compareDay(published *ai.DailyMenu, day scraper.DayMenu) dayChange {
+	name := capitalize(day.Day)
+	change := dayChange{day: name}
+	before, ok := published.Days[name]
+	if _, hasDishes := published.Menu[name]; !ok || !hasDishes {
+		change.unpublished = true
+		return change
+	}
+
+	now := dayMeta(day)
+	if len(now.Scraped) == 0 || len(before.Scraped) == 0 {
+		// Published before the dishes were kept, or by a scraper that doesn't list
+		// them: the page is all there is to compare, and without its hash the day
+		// counts as changed
+		change.page = now.PageHash == "" || now.PageHash != before.PageHash
+		return change
+	}
+	for _, dish := range now.Scraped {
+		if !slices.Contains(before.Scraped, dish) {
+			change.added = append(change.added, dish)
+		}
+	}
+	for _, dish := range before.Scraped {
+		if !slices.Contains(now.Scraped, dish) {
+			change.removed = append(change.removed, dish)
+		}
+	}
+	return change
+}
+
+// changedDays reads the week's published menu and returns it with the days on the
+// page that differ from it and the published days that are gone from the page,
+// logging how. A week that isn't published yet, or not by day, comes back whole
+// and without a published menu, to be parsed as usual.
+func changedDays(ctx context.Context, restaurant scraper.RestaurantMenu, week weekMenu, config Config) (*ai.DailyMenu, []scraper.DayMenu, []string, error) {
+	store, err := openStore(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	data, err := store.Get(ctx, menuFilename(restaurant.Name, week.week))
+	if errors.Is(err, storage.ErrNotFound) {
+		slog.InfoContext(ctx, "The menu isn't published yet, parsing all of it")
+		return nil, week.days, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	published := &ai.DailyMenu{}
+	if err := json.Unmarshal(data, published); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read the published menu: %w", err)
+	}
+	if published.Type != "daily" {
+		slog.InfoContext(ctx, "The published menu isn't by day, parsing all of it")
+		return nil, week.days, nil, nil
+	}
+
+	var changed []scraper.DayMenu
+	for _, day := range week.days {
+		change := compareDay(published, day)
+		if !change.changed() {
+			continue
+		}
+		slog.InfoContext(ctx, "Changed since it was published", change.attrs()...)
+		changed = append(changed, day)
+	}
+
+	gone := goneDays(published, week)
+	for _, day := range gone {
+		slog.InfoContext(ctx, "Changed since it was published", dayChange{day: day, gone: true}.attrs()...)
+	}
+	return published, changed, gone, nil
+}
+
+// goneDays are the published days the page no longer has, e.g. a holiday that was
+// announced during the week. Only the days after the first one on the page count:
+// the page may leave out the days of the week that are over, which were served
+// as they were published.
+func goneDays(published *ai.DailyMenu, week weekMenu) []string {
+	if len(week.days) == 0 {
+		return nil
+	}
+	onPage := make(map[string]bool, len(week.days))
+	first := week.days[0].Date
+	for _, day := range week.days {
+		onPage[capitalize(day.Day)] = true
+		first = min(first, day.Date)
+	}
+
+	var gone []string
+	for _, weekday := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		name := weekday.String()
+		if _, ok := published.Menu[name]; !ok || onPage[name] || week.week.date(weekday) < first {
+			continue
+		}
+		gone = append(gone, name)
+	}
+	return gone
+}
+
+// keepPhotos gives the refreshed dishes that are still on the menu the photos they
+// had, so that a photo the photo job added (see fillMissingPhotos) isn't lost to a
+// change elsewhere on the day. A dish that is new under a category gets none of
+// the old dish's: it is matched on its name as well as its category.
+func keepPhotos(menu, published *ai.DailyMenu) {
+	for day, items := range menu.Menu {
+		for i := range items {
+			item := &items[i]
+			for _, before := range published.Menu[day] {
+				if before.Photo != "" && before.Name == item.Name && before.Category == item.Category {
+					item.Photo, item.PhotoLarge = before.Photo, before.PhotoLarge
+					break
+				}
+			}
+		}
+	}
+}
+
+// mergeDays puts the refreshed days into the published menu, which keeps the rest
+// but for the days that are gone, and takes the refreshed menu's metadata.
+func mergeDays(published, refreshed *ai.DailyMenu, gone []string) *ai.DailyMenu {
+	if published.Menu == nil {
+		published.Menu = make(map[string][]ai.MenuItem)
+	}
+	days := published.Days
+	if days == nil {
+		days = make(map[string]ai.DayMeta)
+	}
+	for day, items := range refreshed.Menu {
+		published.Menu[day] = items
+		days[day] = refreshed.Days[day]
+	}
+	for _, day := range gone {
+		delete(published.Menu, day)
+		delete(days, day)
+	}
+	published.MenuMeta = refreshed.MenuMeta
+	published.Days = days
+	return published
+}
+
+// daysUsage adds up what the days of a menu took from the model. After a refresh
+// that is the days it parsed again and what the others took when they were parsed.
+func daysUsage(days map[string]ai.DayMeta) ai.Spend {
+	var usage ai.Spend
+	for _, day := range days {
+		usage = usage.Add(day.Usage)
+	}
+	return usage
+}
+
+// currentWeek keeps only the week of now, the one a refresh is for.
+func currentWeek(weeks []weekMenu, current isoWeek) []weekMenu {
+	for _, week := range weeks {
+		if week.week == current {
+			return []weekMenu{week}
+		}
+	}
+	return nil
+}
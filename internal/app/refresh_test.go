@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := storage.NewDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := newSession(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.close()
+
+	restaurant := scraper.RestaurantMenu{ID: "gira", Name: "Gira", URL: "https://gira.test"}
+	config := Config{Upload: true, Storage: storage.BackendLocal, StorageDir: dir, Refresh: true}
+	day := func(name, date, category, description string) scraper.DayMenu {
+		return scraper.DayMenu{Day: name, Date: date, Dishes: 1, Items: []ai.Dish{{Category: category, Description: description}}}
+	}
+	monday := day("monday", "2026-07-13", "Pizza Del Giorno", "PIZZA SICILIANA, Kapern")
+	tuesday := day("tuesday", "2026-07-14", "Pasta Del Giorno", "PASTA PESTO, Basilikum")
+	week := isoWeek{2026, 29}
+	refresh := func(days ...scraper.DayMenu) *ai.DailyMenu {
+		t.Helper()
+		captureStdout(t, func() error {
+			_, err := publishWeek(ctx, restaurant, weekMenu{week: week, days: days}, nil, parseRules, config, sess)
+			return err
+		})
+		data, err := store.Get(ctx, "gira_29_2026.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		menu := &ai.DailyMenu{}
+		if err := json.Unmarshal(data, menu); err != nil {
+			t.Fatal(err)
+		}
+		return menu
+	}
+
+	// Not published yet, so all of it is
+	menu := refresh(monday, tuesday)
+	if len(menu.Menu["Monday"]) != 1 || len(menu.Menu["Tuesday"]) != 1 {
+		t.Fatalf("published %+v, want Monday and Tuesday", menu.Menu)
+	}
+	if got := menu.Days["Tuesday"].Scraped; !reflect.DeepEqual(got, []string{"Pasta Del Giorno: PASTA PESTO, Basilikum"}) {
+		t.Errorf("Days[Tuesday].Scraped = %q, want the page's dish", got)
+	}
+
+	// The photo job has been by since
+	menu.Menu["Monday"][0].Photo = "https://photos.test/pizza.jpg"
+	menu.Menu["Tuesday"][0].Photo = "https://photos.test/pesto.jpg"
+	photographed, _ := json.Marshal(menu)
+	if err := store.Put(ctx, "gira_29_2026.json", photographed); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing changed, nothing is published
+	refresh(monday, tuesday)
+	if data, _ := store.Get(ctx, "gira_29_2026.json"); string(data) != string(photographed) {
+		t.Error("a refresh without changes published the menu again")
+	}
+
+	// Tuesday's pasta changed: only Tuesday is replaced, and Monday keeps its photo
+	arrabbiata := day("tuesday", "2026-07-14", "Pasta Del Giorno", "PASTA ARRABBIATA, scharf")
+	menu = refresh(monday, arrabbiata)
+	if got := menu.Menu["Monday"][0]; got.Name != "Pizza Siciliana" || got.Photo != "https://photos.test/pizza.jpg" {
+		t.Errorf("Monday = %+v, want the pizza with its photo", got)
+	}
+	if got := menu.Menu["Tuesday"]; len(got) != 1 || got[0].Name != "Pasta Arrabbiata" || got[0].Photo != "" {
+		t.Errorf("Tuesday = %+v, want the new pasta without the old one's photo", got)
+	}
+	if got := menu.Days["Tuesday"].Scraped; !reflect.DeepEqual(got, []string{"Pasta Del Giorno: PASTA ARRABBIATA, scharf"}) {
+		t.Errorf("Days[Tuesday].Scraped = %q, want the new dish", got)
+	}
+
+	// The page leaves out Monday, which is over: Monday stays as it was served
+	before, _ := store.Get(ctx, "gira_29_2026.json")
+	refresh(arrabbiata)
+	if data, _ := store.Get(ctx, "gira_29_2026.json"); string(data) != string(before) {
+		t.Error("a refresh of a page without the days that are over published the menu again")
+	}
+
+	// Tuesday is called off: it is taken off the menu, and Monday is left alone
+	menu = refresh(monday)
+	if _, ok := menu.Menu["Tuesday"]; ok {
+		t.Errorf("Tuesday = %+v, want it gone", menu.Menu["Tuesday"])
+	}
+	if _, ok := menu.Days["Tuesday"]; ok {
+		t.Errorf("Days[Tuesday] = %+v, want it gone", menu.Days["Tuesday"])
+	}
+	if got := menu.Menu["Monday"]; len(got) != 1 || got[0].Photo != "https://photos.test/pizza.jpg" {
+		t.Errorf("Monday = %+v, want the pizza with its photo", got)
+	}
+	if got := (dayChange{day: "Tuesday", gone: true}).String(); got != "Tuesday: no longer on the page" {
+		t.Errorf("the change = %q, want Tuesday gone", got)
+	}
+}
+
+func TestCompareDay(t *testing.T) {
+	published := &ai.DailyMenu{
+		Menu: map[string][]ai.MenuItem{"Tuesday": {{Name: "Pasta Pesto"}}, "Friday": {{Name: "Fish"}}},
+		MenuMeta: ai.MenuMeta{Days: map[string]ai.DayMeta{
+			"Tuesday": {Scraped: []string{"Pasta Del Giorno: PASTA PESTO, Basilikum", "Chefs Choice: POULET CURRY"}},
+			"Friday":  {PageHash: "0123456789abcdef"},
+		}},
+	}
+	tests := []struct {
+		day  scraper.DayMenu
+		want string
+	}{
+		{
+			scraper.DayMenu{Day: "tuesday", Items: []ai.Dish{
+				{Category: "Pasta Del Giorno", Description: "PASTA ARRABBIATA,  scharf"},
+				{Category: "Chefs Choice", Description: "POULET CURRY"},
+			}},
+			"Tuesday: - Pasta Del Giorno: PASTA PESTO, Basilikum; + Pasta Del Giorno: PASTA ARRABBIATA, scharf",
+		},
+		{scraper.DayMenu{Day: "friday", HTML: "<p>Fish and chips</p>"}, "Friday: the page changed"},
+		{scraper.DayMenu{Day: "wednesday", HTML: "<p>Risotto</p>"}, "Wednesday: not published yet"},
+	}
+	for _, tt := range tests {
+		if got := compareDay(published, tt.day); !got.changed() || got.String() != tt.want {
+			t.Errorf("compareDay(%s) = %q, want %q", tt.day.Day, got, tt.want)
+		}
+	}
+
+	same := scraper.DayMenu{Day: "tuesday", Items: []ai.Dish{
+		{Category: "Chefs Choice", Description: "POULET CURRY"},
+		{Category: "Pasta Del Giorno", Description: "PASTA PESTO, Basilikum"},
+	}}
+	if got := compareDay(published, same); got.changed() {
+		t.Errorf("compareDay(the same dishes in another order) = %q, want no change", got)
+	}
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+	"gopkg.in/yaml.v3"
+)
+
+// registry is the available restaurant menus, keyed by the ID passed to -restaurant.
+type registry map[string]scraper.RestaurantMenu
+
+// The registry that ships with the binary. A file passed with -restaurantsFile
+// replaces it entirely.
+//
+//go:embed restaurants.yaml
+var defaultRegistry []byte
+
+// loadRegistry reads the restaurants from path, or the shipped default if path is
+// empty, and checks them before anything is scraped.
+func loadRegistry(path string) (registry, error) {
+	data := defaultRegistry
+	source := "the default registry"
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the restaurants file: %w", err)
+		}
+		source = path
+	}
+
+	restaurants, err := parseRegistry(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid restaurants in %s: %w", source, err)
+	}
+	return restaurants, nil
+}
+
+// parseRegistry decodes a registry file. YAML is a superset of JSON, so this reads
+// either.
+func parseRegistry(data []byte) (registry, error) {
+	var file struct {
+		Restaurants registry `yaml:"restaurants"`
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	// A misspelled field would otherwise be dropped without a word, and the
+	// restaurant scraped as if it wasn't there
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	if len(file.Restaurants) == 0 {
+		return nil, errors.New("no restaurants defined")
+	}
+	for id, restaurant := range file.Restaurants {
+		restaurant.ID = id
+		file.Restaurants[id] = restaurant
+	}
+	if err := file.Restaurants.validate(); err != nil {
+		return nil, err
+	}
+	return file.Restaurants, nil
+}
+
+// validate reports every problem at once, so a broken file takes one fix, not one
+// run per mistake.
+func (r registry) validate() error {
+	ids := make([]string, 0, len(r))
+	for id := range r {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var errs []error
+	for _, id := range ids {
+		restaurant := r[id]
+		invalid := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{id}, args...)...))
+		}
+
+		// IDs are given on the command line as a comma-separated list
+		if id != strings.ToLower(id) || strings.ContainsAny(id, ", ") {
+			invalid("IDs must be lowercase, without commas or spaces")
+		}
+		if restaurant.Name == "" {
+			invalid("name is required")
+		}
+		if restaurant.URL == "" {
+			invalid("url is required")
+		}
+
+		if err := scraper.Validate(restaurant); err != nil {
+			invalid("%v", err)
+		}
+		if _, err := parseParseMode(restaurant.Parser); err != nil {
+			invalid("%v", err)
+		}
+		if restaurant.Prompt.Version < 0 {
+			invalid("prompt version %d, want 0 for the latest or the one to stay on", restaurant.Prompt.Version)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// lookup finds a restaurant by its ID.
+func (r registry) lookup(id string) (scraper.RestaurantMenu, error) {
+	if id == "" {
+		return scraper.RestaurantMenu{}, fmt.Errorf("restaurant not defined")
+	}
+	restaurant, exists := r[id]
+	if !exists {
+		return scraper.RestaurantMenu{}, fmt.Errorf("restaurant with ID '%s' not found", id)
+	}
+	return restaurant, nil
+}
+
+// feedFilenames are the restaurants' feeds (see publishFeed), sorted.
+func (r registry) feedFilenames() []string {
+	filenames := make([]string, 0, len(r))
+	for _, restaurant := range r {
+		filenames = append(filenames, feedFilename(restaurant.Name))
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+// hasMenu reports whether filename is the menu of one of the restaurants.
+func (r registry) hasMenu(filename string) bool {
+	for _, restaurant := range r {
+		if isMenuOf(restaurant.Name, filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// restaurantsFile is where the registry comes from: the flag if given, else the
+// RESTAURANTS_FILE environment variable, else the shipped default.
+func restaurantsFile(config Config) string {
+	if config.RestaurantsFile != "" {
+		return config.RestaurantsFile
+	}
+	return os.Getenv("RESTAURANTS_FILE")
+}
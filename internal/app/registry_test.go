@@ -0,0 +1,114 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func defaultRestaurants(t *testing.T) registry {
+	t.Helper()
+
+	restaurants, err := loadRegistry("")
+	if err != nil {
+		t.Fatalf("loadRegistry() error = %v", err)
+	}
+	return restaurants
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	restaurants := defaultRestaurants(t)
+
+	espace, err := restaurants.lookup("espace")
+	if err != nil {
+		t.Fatalf("lookup(espace) error = %v", err)
+	}
+	if espace.Scraper != "sv" {
+		t.Errorf("espace.Scraper = %q, want sv", espace.Scraper)
+	}
+
+	gira := restaurants["gira"]
+	if gira.Scraper != "food2050" || gira.BaseURL != "https://app.food2050.ch" {
+		t.Errorf("gira = %+v, want the food2050 scraper and base URL", gira)
+	}
+
+	// The rules only take over from the model when a restaurant opts in
+	for id, restaurant := range restaurants {
+		if restaurant.Parser != "" {
+			t.Errorf("%s.Parser = %q, want the model, the default", id, restaurant.Parser)
+		}
+	}
+
+	// The selector has quotes in it, which YAML must leave alone
+	if got := restaurants["turbolama"].MenuSelector; got != `a[aria-label="FOOD MENU"]` {
+		t.Errorf("turbolama.MenuSelector = %q", got)
+	}
+}
+
+func TestLoadRegistryReadsJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "restaurants.json")
+	err := os.WriteFile(path, []byte(`{"restaurants": {"mensa": {
+		"name": "Mensa", "url": "https://mensa.test/menu", "scraper": "html"
+	}}}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restaurants, err := loadRegistry(path)
+	if err != nil {
+		t.Fatalf("loadRegistry() error = %v", err)
+	}
+	if got := restaurants["mensa"].Name; got != "Mensa" {
+		t.Errorf("name = %q, want Mensa", got)
+	}
+	// A file replaces the default, it does not add to it
+	if _, exists := restaurants["gira"]; exists {
+		t.Error("the file's registry was merged with the default")
+	}
+}
+
+func TestParseRegistryReportsEveryProblem(t *testing.T) {
+	_, err := parseRegistry([]byte(`
+restaurants:
+  lama:
+    name: Lama
+    url: https://lama.test
+    scraper: pdf
+  Kiosk:
+    url: https://kiosk.test
+    scraper: rss
+    prompt:
+      version: -1
+`))
+	if err == nil {
+		t.Fatal("want an error for an invalid registry")
+	}
+
+	for _, want := range []string{
+		"lama: menuSelector is required",
+		"Kiosk: IDs must be lowercase",
+		"Kiosk: name is required",
+		`Kiosk: unknown scraper "rss"`,
+		"Kiosk: prompt version -1",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestParseRegistryRejectsUnknownFields(t *testing.T) {
+	// A typo must not silently drop a setting
+	_, err := parseRegistry([]byte(`
+restaurants:
+  gira:
+    name: Gira
+    url: https://gira.test
+    scraper: food2050
+    disabeld: true
+`))
+	if err == nil {
+		t.Error("want an error for a misspelled field")
+	}
+}
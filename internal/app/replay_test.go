@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+)
+
+// stubScraper stands in for a restaurant's site, which a test can't reach.
+type stubScraper struct{ data scraper.MenuData }
+
+func (s stubScraper) Scrape(context.Context, scraper.RestaurantMenu) (*scraper.MenuData, error) {
+	data := s.data
+	data.Days = append([]scraper.DayMenu(nil), s.data.Days...)
+	return &data, nil
+}
+
+func init() {
+	scraper.Register("test-stub", func(scraper.Options) scraper.Scraper {
+		return stubScraper{data: scraper.MenuData{
+			Content: "<div>the week</div>",
+			Days: []scraper.DayMenu{{
+				Day:    "friday",
+				Date:   "2026-07-17",
+				HTML:   `<div><h3>Pizza Del Giorno</h3><p>PIZZA SICILIANA, Kapern</p><a href="/dish/2026-07-17">Details</a></div>`,
+				Dishes: 1,
+			}},
+		}}
+	})
+}
+
+// captureStdout returns what run prints, which is where the parsed menu goes.
+func captureStdout(t *testing.T, run func() error) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		output <- string(b)
+	}()
+
+	runErr := run()
+	w.Close()
+	if runErr != nil {
+		t.Fatalf("run error = %v", runErr)
+	}
+	return <-output
+}
+
+func runRecorded(t *testing.T, config Config, baseURL string) string {
+	t.Helper()
+
+	restaurant := scraper.RestaurantMenu{Name: "Gira", URL: "https://gira.test", BaseURL: baseURL, Scraper: "test-stub"}
+
+	sess, err := newSession(config)
+	if err != nil {
+		t.Fatalf("newSession() error = %v", err)
+	}
+	defer sess.close()
+
+	return captureStdout(t, func() error {
+		_, err := processRestaurant(context.Background(), restaurant, config, sess)
+		return err
+	})
+}
+
+// A recorded run replays to the same menu, with neither the model nor the dish
+// pages there to ask.
+func TestReplayReproducesARecordedRun(t *testing.T) {
+	dir := t.TempDir()
+
+	server := httptest.NewServer(nil)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/chat/completions":
+			content := `{"items":[{"name":"Pizza Siciliana","description":"Kapern","type":"vegetarian",` +
+				`"icon":"pizza","link":"/dish/2026-07-17","category":"Pizza Del Giorno"}]}`
+			json.NewEncoder(w).Encode(map[string]any{
+				"choices": []map[string]any{{"message": map[string]any{"role": "assistant", "content": content}}},
+			})
+		case strings.HasPrefix(r.URL.Path, "/dish/"):
+			io.WriteString(w, `<script id="__NEXT_DATA__" type="application/json">`+
+				`{"props":{"pageProps":{"organisation":{"outlet":{"menuCategory":{"menuItem":{"dish":`+
+				`{"imageUrl":"https://storage.googleapis.com/pizza.jpg"}}}}}}}}</script>`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	t.Setenv("AI_PROVIDER", "")
+	t.Setenv("OPENAI_BASE_URL", server.URL+"/v1")
+	recorded := runRecorded(t, Config{RecordDir: dir}, server.URL)
+
+	// Nothing live is left to answer the replay
+	server.Close()
+	t.Setenv("OPENAI_BASE_URL", "")
+	t.Setenv("OPENAI_API_KEY", "")
+	// Published to a local mirror, the one place a replay may go
+	mirror, history := t.TempDir(), t.TempDir()
+	replayed := runRecorded(t, Config{ReplayDir: dir, Upload: true, Storage: "local", StorageDir: mirror, HistoryBucket: history}, server.URL)
+
+	// Only when it was made, that it was made from a tape rather than a model, and
+	// the dish history that comes with uploading may differ
+	decode := func(output string) ai.DailyMenu {
+		var menu ai.DailyMenu
+		if err := json.Unmarshal([]byte(output), &menu); err != nil {
+			t.Fatalf("output is not a menu: %v\n%s", err, output)
+		}
+		menu.GeneratedAt, menu.Model = time.Time{}, ""
+		return menu
+	}
+	withoutHistory := func(menu ai.DailyMenu) ai.DailyMenu {
+		for _, items := range menu.Menu {
+			for i := range items {
+				items[i].FirstSeen, items[i].LastSeen, items[i].TimesServed = "", "", 0
+			}
+		}
+		return menu
+	}
+	menu := decode(replayed)
+	if !reflect.DeepEqual(withoutHistory(decode(replayed)), decode(recorded)) {
+		t.Errorf("replay differs from the recording:\nrecorded: %s\nreplayed: %s", recorded, replayed)
+	}
+	friday := menu.Menu["Friday"]
+	if len(friday) != 1 || friday[0].Name != "Pizza Siciliana" {
+		t.Fatalf("Friday = %+v, want the recorded dish", friday)
+	}
+	if friday[0].Photo == "" {
+		t.Error("the dish page was not replayed: the dish has no photo")
+	}
+	if dish := friday[0]; dish.FirstSeen != "2026-07-17" || dish.LastSeen != "" || dish.TimesServed != 1 {
+		t.Errorf("history = %s, %q, %d, want a new dish", dish.FirstSeen, dish.LastSeen, dish.TimesServed)
+	}
+
+	// The file says what it is, for the week its dishes are served in
+	meta := menu.MenuMeta
+	if meta.SchemaVersion != ai.MenuSchemaVersion || meta.RestaurantName != "Gira" || meta.SourceURL != "https://gira.test" {
+		t.Errorf("metadata = %+v, want the restaurant and schema version", meta)
+	}
+	if meta.PromptVersion != ai.DefaultPrompts().Latest() {
+		t.Errorf("prompt version = %d, want the latest, %d", meta.PromptVersion, ai.DefaultPrompts().Latest())
+	}
+	if meta.Year != 2026 || meta.Week != 29 {
+		t.Errorf("week = %d of %d, want 29 of 2026 from the scraped date", meta.Week, meta.Year)
+	}
+	if day := meta.Days["Friday"]; day.Date != "2026-07-17" || day.DishesOnPage != 1 {
+		t.Errorf("Days[Friday] = %+v, want the date and the page's dish count", day)
+	}
+
+	published, err := os.ReadFile(filepath.Join(mirror, "gira_29_2026.json"))
+	if err != nil || strings.TrimSpace(string(published)) != strings.TrimSpace(replayed) {
+		t.Errorf("the mirror has %q (%v), want the replayed menu as gira_29_2026.json", published, err)
+	}
+	if _, err := os.Stat(filepath.Join(history, "history", "gira.sqlite")); err != nil {
+		t.Errorf("no dish history next to the mirror: %v", err)
+	}
+	for _, calendar := range []string{"gira_29_2026.ics", "gira.ics"} {
+		if data, err := os.ReadFile(filepath.Join(mirror, calendar)); err != nil || !strings.Contains(string(data), "DTSTART;VALUE=DATE:20260717") {
+			t.Errorf("the mirror has %q (%v) as %s, want Friday's event", data, err, calendar)
+		}
+	}
+}
+
+func TestReplayedRunsAreNotUploaded(t *testing.T) {
+	if _, err := newSession(Config{ReplayDir: t.TempDir(), Upload: true}); err == nil {
+		t.Error("want an error when a replay would overwrite the published menu")
+	}
+}
@@ -0,0 +1,226 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/logging"
+	"github.com/chlab/lunch-wankdorf/pkg/metrics"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+)
+
+// The stages of a restaurant's run, as they are timed in the log and the report.
+const (
+	stageScrape = "scrape" // the restaurant's site, or its PDF
+	stageClean  = "clean"  // tidying the scraped HTML up for the model
+	stageParse  = "parse"  // the model or the rules, validation and retries included
+	stagePhotos = "photos" // the dish photos
+	stageUpload = "upload" // the dish history, the menu and everything published next to it
+)
+
+// stageTimes adds up how long each stage of a restaurant's run took. A page with
+// two weeks on it goes through parse, photos and upload twice.
+type stageTimes struct {
+	mu    sync.Mutex
+	times map[string]time.Duration
+}
+
+// restaurantRun is the restaurant a context is running, for its stage times and
+// the labels of its metrics.
+type restaurantRun struct {
+	id    string
+	times stageTimes
+}
+
+type restaurantRunKey struct{}
+
+// restaurantOf is the ID of the restaurant ctx is running, or "" outside of one.
+func restaurantOf(ctx context.Context) string {
+	if run, ok := ctx.Value(restaurantRunKey{}).(*restaurantRun); ok {
+		return run.id
+	}
+	return ""
+}
+
+func (s *stageTimes) add(stage string, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.times == nil {
+		s.times = make(map[string]time.Duration)
+	}
+	s.times[stage] += elapsed
+}
+
+func (s *stageTimes) seconds() map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seconds := make(map[string]float64, len(s.times))
+	for stage, elapsed := range s.times {
+		seconds[stage] = roundSeconds(elapsed)
+	}
+	return seconds
+}
+
+// startStage starts a stage of the run. The context it returns puts the stage in
+// the records logged with it; the function ends the stage, logging how long it
+// took and adding that to the run report and the metrics.
+func startStage(ctx context.Context, stage string) (context.Context, func()) {
+	ctx = logging.With(ctx, "stage", stage)
+	start := time.Now()
+	return ctx, func() {
+		elapsed := time.Since(start)
+		slog.InfoContext(ctx, "Stage done", "duration", elapsed)
+		if run, ok := ctx.Value(restaurantRunKey{}).(*restaurantRun); ok {
+			run.times.add(stage, elapsed)
+			metrics.StageDuration.WithLabelValues(run.id, stage).Observe(elapsed.Seconds())
+		}
+	}
+}
+
+// runRestaurant runs processRestaurant with the restaurant in every record it logs
+// and its stages timed.
+func runRestaurant(restaurant scraper.RestaurantMenu, config Config, sess *session) batchResult {
+	run := &restaurantRun{id: restaurant.ID}
+	ctx := logging.With(context.Background(), "restaurant", restaurant.ID)
+	ctx = context.WithValue(ctx, restaurantRunKey{}, run)
+	ctx, tally := ai.WithTally(ctx)
+
+	start := time.Now()
+	problems, err := processRestaurant(ctx, restaurant, config, sess)
+	if err != nil {
+		slog.ErrorContext(ctx, "Restaurant failed", "error", err)
+	}
+	usage := tally.Spend()
+	if usage.Calls > 0 {
+		slog.InfoContext(ctx, "Model usage", usage.Attrs()...)
+	}
+	return batchResult{
+		id:       restaurant.ID,
+		duration: time.Since(start),
+		finished: time.Now(),
+		err:      err,
+		problems: problems,
+		stages:   run.times.seconds(),
+		usage:    usage,
+	}
+}
+
+// runReport is what -report writes at the end of a run: how it went for each
+// restaurant, how long each of its stages took, in seconds, and what it took from
+// the model. The run ID is the one in the log records.
+type runReport struct {
+	RunID       string             `json:"runId"`
+	Started     time.Time          `json:"started"`
+	Finished    time.Time          `json:"finished"`
+	Seconds     float64            `json:"seconds"`
+	Succeeded   int                `json:"succeeded"`
+	Failed      int                `json:"failed"`
+	Usage       ai.Spend           `json:"usage"`
+	Restaurants []restaurantReport `json:"restaurants"`
+}
+
+type restaurantReport struct {
+	ID       string             `json:"id"`
+	Status   string             `json:"status"` // ok, invalid (published with validation problems) or failed
+	Error    string             `json:"error,omitempty"`
+	Problems []string           `json:"problems,omitempty"`
+	Seconds  float64            `json:"seconds"`
+	Stages   map[string]float64 `json:"stages"`
+	Usage    ai.Spend           `json:"usage"`
+}
+
+func newRunReport(started time.Time, results []batchResult) runReport {
+	finished := time.Now()
+	report := runReport{
+		RunID:       logging.RunID(),
+		Started:     started.UTC().Truncate(time.Second),
+		Finished:    finished.UTC().Truncate(time.Second),
+		Seconds:     roundSeconds(finished.Sub(started)),
+		Usage:       totalUsage(results),
+		Restaurants: make([]restaurantReport, len(results)),
+	}
+	for i, result := range results {
+		restaurant := restaurantReport{
+			ID:       result.id,
+			Status:   result.status(),
+			Problems: result.problems,
+			Seconds:  roundSeconds(result.duration),
+			Stages:   result.stages,
+			Usage:    result.usage,
+		}
+		if result.err != nil {
+			restaurant.Error = result.err.Error()
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+		report.Restaurants[i] = restaurant
+	}
+	return report
+}
+
+// writeReport writes the run report to config.ReportFile, if the run has one. A
+// report that can't be written is only a warning: the menus are out either way.
+func writeReport(started time.Time, results []batchResult, config Config) {
+	if config.ReportFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(newRunReport(started, results), "", "  ")
+	if err == nil {
+		err = os.WriteFile(config.ReportFile, data, 0o644)
+	}
+	if err != nil {
+		slog.Warn("Could not write the run report", "file", config.ReportFile, "error", err)
+		return
+	}
+	slog.Info("Wrote the run report", "file", config.ReportFile)
+}
+
+// pushMetrics pushes the run's metrics to the Pushgateway, if the run has one,
+// grouped by the restaurants it fetched: the jobs of the weekly matrix fetch one
+// each, and each keeps a group of its own, replaced by its next run. The
+// restaurants that succeeded add when they did to groups of their own, which a
+// failed run leaves alone. Like the report, a push that fails is only a warning.
+func pushMetrics(results []batchResult, config Config) {
+	url := pushgatewayURL(config)
+	if url == "" {
+		return
+	}
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.id
+	}
+	grouping := map[string]string{"restaurants": strings.Join(ids, ",")}
+	if err := metrics.Push(context.Background(), url, grouping); err != nil {
+		slog.Warn("Could not push the metrics", "pushgateway", url, "error", err)
+		return
+	}
+	for _, result := range results {
+		if result.err != nil {
+			continue
+		}
+		if err := metrics.PushSuccess(context.Background(), url, result.id, result.finished); err != nil {
+			slog.Warn("Could not push the restaurant's success", "pushgateway", url, "restaurant", result.id, "error", err)
+		}
+	}
+	slog.Info("Pushed the metrics", "pushgateway", url)
+}
+
+// pushgatewayURL is the Pushgateway the run's metrics go to: the flag if given,
+// else the PUSHGATEWAY_URL environment variable, else none.
+func pushgatewayURL(config Config) string {
+	if config.Pushgateway != "" {
+		return config.Pushgateway
+	}
+	return os.Getenv("PUSHGATEWAY_URL")
+}
+
+func roundSeconds(d time.Duration) float64 {
+	return d.Round(time.Millisecond).Seconds()
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+)
+
+func TestRunRestaurantTimesItsStages(t *testing.T) {
+	dishLink = "" // No dish pages to fetch photos from
+	restaurant := scraper.RestaurantMenu{ID: "gira", Name: "Gira", URL: "https://gira.test", Scraper: "test-dishes"}
+	config := Config{Parser: "rules"}
+	sess, err := newSession(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.close()
+
+	var result batchResult
+	captureStdout(t, func() error {
+		result = runRestaurant(restaurant, config, sess)
+		return result.err
+	})
+
+	if result.id != "gira" || result.status() != "ok" {
+		t.Errorf("result = %+v, want gira ok", result)
+	}
+	for _, stage := range []string{stageScrape, stageClean, stageParse, stagePhotos, stageUpload} {
+		if _, ok := result.stages[stage]; !ok {
+			t.Errorf("stages = %v, want %s timed", result.stages, stage)
+		}
+	}
+}
+
+func TestParseWeekCountsWhatEachDayTook(t *testing.T) {
+	provider := &scriptedProvider{
+		answers: []string{duplicatedAnswer, correctAnswer},
+		usage:   ai.Usage{InputTokens: 900, OutputTokens: 400},
+	}
+	parser := ai.NewParser(provider, ai.NewMeter(ai.Prices{"scripted": {Input: 1, Output: 5}}, 0))
+	ctx, restaurant := ai.WithTally(context.Background())
+
+	menu, _, err := parseWeek(ctx, parser, []scraper.DayMenu{validatedDay}, parseModel, nil)
+	if err != nil {
+		t.Fatalf("parseWeek() error = %v", err)
+	}
+
+	// The day took a retry: two calls of 900 and 400 tokens, at $0.0029 each
+	want := ai.Spend{Calls: 2, Usage: ai.Usage{InputTokens: 1800, OutputTokens: 800}, CostUSD: 0.0058}
+	if got := menu.Days["Friday"].Usage; got.Calls != want.Calls || got.Usage != want.Usage || math.Abs(got.CostUSD-want.CostUSD) > 1e-9 {
+		t.Errorf("Days[Friday].Usage = %+v, want %+v", got, want)
+	}
+	if got := restaurant.Spend(); got.Calls != 2 {
+		t.Errorf("the restaurant's tally = %+v, want the day's two calls", got)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	results := []batchResult{
+		{id: "gira", duration: 12345 * time.Millisecond, stages: map[string]float64{stageScrape: 3.2, stageParse: 8.1},
+			usage: ai.Spend{Calls: 5, Usage: ai.Usage{InputTokens: 4300, OutputTokens: 2000}, CostUSD: 0.012225}},
+		{id: "luna", duration: time.Second, problems: []string{"friday: 1 dish missing"},
+			usage: ai.Spend{Calls: 1, Usage: ai.Usage{InputTokens: 2100, OutputTokens: 900}, CostUSD: 0.005675}},
+		{id: "espace", duration: 4 * time.Minute, err: errors.New("failed to scrape the monday menu")},
+	}
+	writeReport(time.Now().Add(-5*time.Minute), results, Config{ReportFile: path})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report runReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("not a report: %v\n%s", err, data)
+	}
+	if report.RunID == "" || report.Succeeded != 2 || report.Failed != 1 || len(report.Restaurants) != 3 {
+		t.Errorf("report = %+v, want a run ID and 2 of 3 restaurants succeeded", report)
+	}
+	if gira := report.Restaurants[0]; gira.Status != "ok" || gira.Seconds != 12.345 || gira.Stages[stageScrape] != 3.2 || gira.Usage.CostUSD != 0.0122 {
+		t.Errorf("gira = %+v, want ok in 12.345s with its stages and its cost to a hundredth of a cent", gira)
+	}
+	if report.Usage.Calls != 6 || report.Usage.InputTokens != 6400 || report.Usage.CostUSD != 0.0179 {
+		t.Errorf("report.Usage = %+v, want the restaurants' added up", report.Usage)
+	}
+	if luna := report.Restaurants[1]; luna.Status != "invalid" || len(luna.Problems) != 1 {
+		t.Errorf("luna = %+v, want invalid with its problem", luna)
+	}
+	if espace := report.Restaurants[2]; espace.Status != "failed" || espace.Error != "failed to scrape the monday menu" {
+		t.Errorf("espace = %+v, want failed with its error", espace)
+	}
+}
+
+// Only the restaurants that succeeded push their last success, to groups the run's
+// own push doesn't replace
+func TestPushMetricsKeepsTheLastSuccessOfAFailedRestaurant(t *testing.T) {
+	var pushes []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		pushes = append(pushes, r.Method+" "+r.URL.Path)
+	}))
+	defer server.Close()
+
+	pushMetrics([]batchResult{
+		{id: "gira", finished: time.Now()},
+		{id: "espace", err: errors.New("Chrome crashed")},
+	}, Config{Pushgateway: server.URL})
+
+	want := []string{
+		"PUT /metrics/job/lunch_fetch/restaurants/gira,espace",
+		"POST /metrics/job/lunch_fetch/restaurant/gira",
+	}
+	if !slices.Equal(pushes, want) {
+		t.Errorf("pushes = %q, want %q", pushes, want)
+	}
+}
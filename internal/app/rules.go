@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+)
+
+// parseMode is how a scraped day becomes menu items.
+type parseMode string
+
+const (
+	parseModel         parseMode = "model"       // the model reads the day's HTML
+	parseRules         parseMode = "rules"       // built from the dishes the scraper listed, no model
+	parseRulesAndModel parseMode = "rules+model" // rules first, then the model's names, types and icons
+)
+
+// parseParseMode checks a restaurant's (or -parser's) parser setting. Empty is
+// the model, as it was before there was a choice.
+func parseParseMode(value string) (parseMode, error) {
+	switch mode := parseMode(strings.ToLower(value)); mode {
+	case "", parseModel:
+		return parseModel, nil
+	case parseRules, parseRulesAndModel:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown parser %q, want %s, %s or %s", value, parseModel, parseRules, parseRulesAndModel)
+	}
+}
+
+// parseModeFor is the restaurant's parse mode, unless the run overrides it.
+func parseModeFor(restaurant scraper.RestaurantMenu, config Config) (parseMode, error) {
+	if config.Parser != "" {
+		return parseParseMode(config.Parser)
+	}
+	return parseParseMode(restaurant.Parser)
+}
+
+// listsDishes reports whether the scraper listed every day's dishes one by one,
+// which is what the rules need.
+func listsDishes(days []scraper.DayMenu) bool {
+	for _, day := range days {
+		if day.Items == nil && day.Dishes > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDay turns one day into menu items the way mode says, and returns the
+// validation problems that are left. parser is not used (and may be nil) when the
+// mode has no model in it.
+func parseDay(ctx context.Context, parser *ai.Parser, day scraper.DayMenu, mode parseMode, cache *parseCache) ([]ai.MenuItem, []string, error) {
+	switch mode {
+	case parseRules:
+		// Made from the page itself, so there is nothing to check it against
+		return ai.ParseDishes(day.Items), nil, nil
+	case parseRulesAndModel:
+		baseline := ai.ParseDishes(day.Items)
+		parsed, problems, err := parseDayWithRetry(ctx, parser, day, cache)
+		if err != nil {
+			// The model only improves on the rules, so losing it loses nothing else
+			slog.WarnContext(ctx, "The model could not parse the day, using the page's own dish list", "error", err)
+			return baseline, nil, nil
+		}
+		// The baseline decides which dishes there are, but the names, types and
+		// icons of an answer that still failed validation are the model's all the
+		// same: its problems stay, and so does anything wrong with the merged day
+		items := enrichItems(ctx, baseline, parsed)
+		for _, problem := range validateDay(day, items) {
+			if !slices.Contains(problems, problem) {
+				problems = append(problems, problem)
+			}
+		}
+		return items, problems, nil
+	default:
+		return parseDayWithRetry(ctx, parser, day, cache)
+	}
+}
+
+// enrichItems takes the model's name, description, type and icon for every dish
+// of the baseline it also returned, matched by link. The baseline decides which
+// dishes there are: a dish the model dropped keeps the rules' version, and one it
+// made up is left out. Where the two disagree is logged, which is what the
+// baseline is for.
+func enrichItems(ctx context.Context, baseline, parsed []ai.MenuItem) []ai.MenuItem {
+	byLink := make(map[string]ai.MenuItem, len(parsed))
+	for _, item := range parsed {
+		byLink[item.Link] = item
+	}
+
+	items := make([]ai.MenuItem, len(baseline))
+	var missing, names, types, icons int
+	for i, item := range baseline {
+		model, ok := byLink[item.Link]
+		if !ok {
+			missing++
+			items[i] = item
+			continue
+		}
+
+		if !strings.EqualFold(model.Name, item.Name) {
+			names++
+		}
+		if model.Type != item.Type {
+			types++
+		}
+		if model.Icon != item.Icon {
+			icons++
+		}
+
+		item.Name = model.Name
+		item.Description = model.Description
+		item.Type = model.Type
+		item.Icon = model.Icon
+		items[i] = item
+	}
+
+	if missing > 0 {
+		slog.WarnContext(ctx, "The model left out dishes, keeping the page's version of those",
+			"missing", missing, "dishes", len(baseline))
+	}
+	if names+types+icons > 0 {
+		slog.InfoContext(ctx, "The model disagreed with the page's dish list",
+			"names", names, "types", types, "icons", icons)
+	}
+	return items
+}
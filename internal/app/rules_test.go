@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+)
+
+// dishLink is where test-dishes' one dish links to.
+var dishLink string
+
+func init() {
+	scraper.Register("test-dishes", func(scraper.Options) scraper.Scraper {
+		return stubScraper{data: scraper.MenuData{Days: []scraper.DayMenu{{
+			Day:    "friday",
+			Date:   "2026-07-17",
+			HTML:   "<div><h3>Pizza Del Giorno</h3><p>PIZZA SICILIANA, Kapern</p></div>",
+			Dishes: 1,
+			Items: []ai.Dish{{
+				Category: "Pizza Del Giorno", Description: "PIZZA SICILIANA, Kapern", Link: dishLink, Labels: []string{"vegetarian"},
+			}},
+		}}}}
+	})
+}
+
+// A food2050 restaurant set to rules+model still gets its menu when there is no
+// model to ask.
+func TestRulesAndModelWithoutAnAPIKey(t *testing.T) {
+	// Dish pages without photos
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	dishLink = server.URL + "/menu,pizza-del-giorno/2026-07-17"
+
+	for _, key := range []string{"AI_PROVIDER", "OPENAI_API_KEY", "OPENAI_BASE_URL"} {
+		t.Setenv(key, "")
+	}
+
+	restaurant := scraper.RestaurantMenu{Name: "Gira", URL: "https://gira.test", Scraper: "test-dishes", Parser: "rules+model"}
+	sess, err := newSession(Config{})
+	if err != nil {
+		t.Fatalf("newSession() error = %v", err)
+	}
+	defer sess.close()
+
+	output := captureStdout(t, func() error {
+		_, err := processRestaurant(context.Background(), restaurant, Config{}, sess)
+		return err
+	})
+
+	var menu ai.DailyMenu
+	if err := json.Unmarshal([]byte(output), &menu); err != nil {
+		t.Fatalf("output is not a menu: %v\n%s", err, output)
+	}
+	want := ai.MenuItem{
+		Name: "Pizza Siciliana", Description: "Kapern", Type: "vegetarian", Icon: "pizza",
+		Link: dishLink, Category: "Pizza Del Giorno",
+	}
+	if friday := menu.Menu["Friday"]; len(friday) != 1 || friday[0] != want {
+		t.Errorf("Friday = %+v, want %+v", friday, want)
+	}
+}
+
+func TestRulesNeedTheScraperToListDishes(t *testing.T) {
+	restaurant := scraper.RestaurantMenu{Name: "Gira", URL: "https://gira.test", Scraper: "test-stub"}
+	sess, err := newSession(Config{})
+	if err != nil {
+		t.Fatalf("newSession() error = %v", err)
+	}
+	defer sess.close()
+
+	// test-stub only has the day's HTML, which takes a model to read
+	_, err = processRestaurant(context.Background(), restaurant, Config{Parser: "rules"}, sess)
+	if err == nil {
+		t.Error("want an error for the rules parser on a scraper that doesn't list dishes")
+	}
+}
+
+func TestEnrichItemsKeepsThePagesDishes(t *testing.T) {
+	baseline := []ai.MenuItem{
+		{Name: "Pasta Pesto", Type: "", Icon: "spaghetti", Link: "/pasta", Category: "Pasta Del Giorno"},
+		{Name: "Poulet Curry", Type: "meat", Icon: "curry", Link: "/curry", Category: "Chefs Choice"},
+	}
+	parsed := []ai.MenuItem{
+		{Name: "Pasta al Pesto", Description: "Basilikum", Type: "vegetarian", Icon: "spaghetti", Link: "/pasta", Category: "Pasta"},
+		{Name: "Made Up", Type: "vegan", Icon: "salad", Link: "/nowhere"},
+	}
+
+	items := enrichItems(context.Background(), baseline, parsed)
+
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want the page's 2", len(items))
+	}
+	// The model's words, under the page's category
+	pasta := ai.MenuItem{Name: "Pasta al Pesto", Description: "Basilikum", Type: "vegetarian", Icon: "spaghetti",
+		Link: "/pasta", Category: "Pasta Del Giorno"}
+	if items[0] != pasta {
+		t.Errorf("items[0] = %+v, want %+v", items[0], pasta)
+	}
+	// A dish the model dropped is kept as the rules built it
+	if items[1] != baseline[1] {
+		t.Errorf("items[1] = %+v, want the baseline %+v", items[1], baseline[1])
+	}
+}
+
+func TestParseParseMode(t *testing.T) {
+	for value, want := range map[string]parseMode{"": parseModel, "model": parseModel, "Rules": parseRules, "rules+model": parseRulesAndModel} {
+		if got, err := parseParseMode(value); err != nil || got != want {
+			t.Errorf("parseParseMode(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+	if _, err := parseParseMode("regex"); err == nil {
+		t.Error("want an error for an unknown parser")
+	}
+}
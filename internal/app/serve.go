@@ -0,0 +1,348 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/metrics"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Serve runs the JSON API over the published menus (see newAPI) until the server
+// fails. It only ever reads the storage, so it can run next to the jobs that
+// publish to it.
+func Serve(config Config) error {
+	// Load environment variables from .env file
+	loadEnv()
+
+	restaurants, err := loadRegistry(restaurantsFile(config))
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(config)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              config.Addr,
+		Handler:           withCORS(newAPI(restaurants, store, time.Now), config.CORSOrigin),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	slog.Info("Serving the menus", "storage", store.String(), "addr", config.Addr)
+	return server.ListenAndServe()
+}
+
+// api answers questions about the menus without its callers having to know how
+// the files are named: which week, which day, which dish. The answers are made
+// from the files as they were at most menuCacheFor ago, so a menu is served soon
+// after it is published without every request going to the storage. Days and
+// weeks are the canteens' (see zurich), wherever the server runs.
+type api struct {
+	*menuReader
+	now func() time.Time
+}
+
+// newAPI routes:
+//
+//	GET /api/restaurants                    the restaurants
+//	GET /api/menus/{week}                   every restaurant's menu file for a week: 2026-W29, current or next
+//	GET /api/menus/today                    every restaurant's dishes today
+//	GET /api/restaurants/{id}/days/{date}   one restaurant's dishes on a date, e.g. 2026-07-17
+//	GET /api/search?q=curry[&week=]         the dishes whose name, description or category mention q
+//	GET /metrics                            the server's metrics, for Prometheus (see package metrics)
+func newAPI(restaurants registry, store storage.Store, now func() time.Time) http.Handler {
+	reader := newMenuReader(restaurants, store)
+	reader.cacheFor, reader.now = menuCacheFor, now
+	a := &api{menuReader: reader, now: func() time.Time { return now().In(zurich()) }}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/restaurants", a.listRestaurants)
+	mux.HandleFunc("GET /api/menus/today", a.today)
+	mux.HandleFunc("GET /api/menus/{week}", a.week)
+	mux.HandleFunc("GET /api/restaurants/{id}/days/{date}", a.day)
+	mux.HandleFunc("GET /api/search", a.search)
+	mux.Handle("GET /metrics", metricsHandler())
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "no such endpoint: %s", r.URL.Path)
+	})
+	return countRequests(mux)
+}
+
+// menuCacheFor is how long the API reuses a menu file it read, as long as the
+// answers may be cached by clients (see writeJSON).
+const menuCacheFor = time.Minute
+
+// metricsHandler serves the package's metrics, and the server's runtime and
+// process with them: unlike a run's push, this is a process that stays up.
+func metricsHandler() http.Handler {
+	runtime := prometheus.NewRegistry()
+	runtime.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return promhttp.HandlerFor(prometheus.Gatherers{metrics.Registry, runtime}, promhttp.HandlerOpts{})
+}
+
+// countRequests counts the requests mux answers by the route they took, which
+// unlike the path is a label with only so many values.
+func countRequests(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(recorder, r)
+		metrics.APIRequests.WithLabelValues(r.Pattern, strconv.Itoa(recorder.status)).Inc()
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (a *api) listRestaurants(w http.ResponseWriter, r *http.Request) {
+	type restaurant struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		URL      string `json:"url"`
+		Disabled bool   `json:"disabled,omitempty"`
+	}
+
+	list := make([]restaurant, 0, len(a.ids))
+	for _, id := range a.ids {
+		config := a.restaurants[id]
+		list = append(list, restaurant{ID: id, Name: config.Name, URL: config.URL, Disabled: config.Disabled})
+	}
+	writeJSON(w, r, list, time.Time{})
+}
+
+func (a *api) week(w http.ResponseWriter, r *http.Request) {
+	week, err := a.weekParam(r.PathValue("week"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	files, err := a.load(r.Context(), week)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "%v", err)
+		return
+	}
+	if len(files.menus) == 0 {
+		writeError(w, http.StatusNotFound, "no menus published for %s", week)
+		return
+	}
+
+	menus := make(map[string]json.RawMessage, len(files.menus))
+	for id, menu := range files.menus {
+		menus[id] = menu.raw
+	}
+	writeJSON(w, r, struct {
+		Year  int                        `json:"year"`
+		Week  int                        `json:"week"`
+		Menus map[string]json.RawMessage `json:"menus"`
+	}{week.year, week.week, menus}, files.modified)
+}
+
+func (a *api) today(w http.ResponseWriter, r *http.Request) {
+	today := a.now()
+	files, err := a.load(r.Context(), weekOf(today))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "%v", err)
+		return
+	}
+
+	// A restaurant without a menu today (closed, or not published yet) is left out
+	menus := make(map[string][]ai.MenuItem)
+	for id, menu := range files.menus {
+		if dishes, ok := menu.dishesOn(today); ok {
+			menus[id] = dishes
+		}
+	}
+	writeJSON(w, r, struct {
+		Date  string                   `json:"date"`
+		Day   string                   `json:"day"`
+		Menus map[string][]ai.MenuItem `json:"menus"`
+	}{today.Format(time.DateOnly), today.Weekday().String(), menus}, files.modified)
+}
+
+func (a *api) day(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := a.restaurants[id]; !ok {
+		writeError(w, http.StatusNotFound, "no restaurant %q", id)
+		return
+	}
+	date, err := time.Parse(time.DateOnly, r.PathValue("date"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid date %q, want e.g. 2026-07-17", r.PathValue("date"))
+		return
+	}
+
+	files, err := a.load(r.Context(), weekOf(date), id)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "%v", err)
+		return
+	}
+	menu, ok := files.menus[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "%s has no menu published for %s", id, weekOf(date))
+		return
+	}
+	dishes, ok := menu.dishesOn(date)
+	if !ok {
+		writeError(w, http.StatusNotFound, "%s has no menu on %s", id, date.Format(time.DateOnly))
+		return
+	}
+
+	writeJSON(w, r, struct {
+		RestaurantID   string        `json:"restaurantId"`
+		RestaurantName string        `json:"restaurantName"`
+		Date           string        `json:"date"`
+		Day            string        `json:"day"`
+		Dishes         []ai.MenuItem `json:"dishes"`
+	}{id, a.restaurants[id].Name, date.Format(time.DateOnly), date.Weekday().String(), dishes}, files.modified)
+}
+
+// searchHit is a dish that matched, and where and when it is served. Day and Date
+// are empty for a weekly menu, whose dishes are on every day.
+type searchHit struct {
+	RestaurantID string `json:"restaurantId"`
+	Day          string `json:"day,omitempty"`
+	Date         string `json:"date,omitempty"`
+	ai.MenuItem
+}
+
+func (a *api) search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	week, err := a.weekParam(r.URL.Query().Get("week"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	files, err := a.load(r.Context(), week)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "%v", err)
+		return
+	}
+
+	needle := strings.ToLower(query)
+	hits := []searchHit{}
+	for _, id := range a.ids {
+		menu, ok := files.menus[id]
+		if !ok {
+			continue
+		}
+		for _, day := range menu.days(week) {
+			for _, dish := range day.dishes {
+				text := strings.ToLower(dish.Name + "\n" + dish.Description + "\n" + dish.Category)
+				if strings.Contains(text, needle) {
+					hits = append(hits, searchHit{RestaurantID: id, Day: day.name, Date: day.date, MenuItem: dish})
+				}
+			}
+		}
+	}
+
+	writeJSON(w, r, struct {
+		Query   string      `json:"query"`
+		Year    int         `json:"year"`
+		Week    int         `json:"week"`
+		Results []searchHit `json:"results"`
+	}{query, week.year, week.week, hits}, files.modified)
+}
+
+// weekParam reads a week as the API takes it: an ISO week, "current" or "next".
+// No week at all is the current one.
+func (a *api) weekParam(value string) (isoWeek, error) {
+	switch value {
+	case "", "current":
+		return weekOf(a.now()), nil
+	case "next":
+		return weekOf(a.now().AddDate(0, 0, 7)), nil
+	default:
+		return parseISOWeek(value)
+	}
+}
+
+// writeJSON answers with v, tagged with a hash of it and the time the menus it was
+// made from were last written, so a client polling for changes is only sent one
+// when there is one (If-None-Match, If-Modified-Since).
+func writeJSON(w http.ResponseWriter, r *http.Request, v any, modified time.Time) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to encode the answer: %v", err)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	http.ServeContent(w, r, "", modified, bytes.NewReader(body))
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	body, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{fmt.Sprintf(format, args...)})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// withCORS lets browsers on other origins call the API. origins is "*" for any
+// origin, or a comma-separated list of the ones allowed; empty allows none.
+func withCORS(next http.Handler, origins string) http.Handler {
+	allowed := make(map[string]bool)
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowed[origin] = true
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		header := w.Header()
+		switch {
+		case allowed["*"]:
+			header.Set("Access-Control-Allow-Origin", "*")
+		case allowed[origin]:
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Add("Vary", "Origin")
+		case len(allowed) > 0:
+			// The answer depends on the origin even when it is refused
+			header.Add("Vary", "Origin")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", "If-None-Match, If-Modified-Since")
+			header.Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		header.Set("Access-Control-Expose-Headers", "ETag, Last-Modified")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,329 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// A Friday in week 29 of 2026
+var serveNow = time.Date(2026, 7, 17, 11, 30, 0, 0, time.UTC)
+
+// publishedMenus is a storage with gira's week 29 (with dates) and turbolama's (a
+// weekly menu from before the metadata, without), and the restaurants, one of
+// which published nothing.
+func publishedMenus(t *testing.T) (storage.Store, registry) {
+	t.Helper()
+
+	store, err := storage.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(name string, menu any) {
+		data, err := json.Marshal(menu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(context.Background(), name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gira := &ai.DailyMenu{
+		Type: "daily",
+		MenuMeta: ai.MenuMeta{
+			SchemaVersion: ai.MenuSchemaVersion,
+			Year:          2026,
+			Week:          29,
+			Days: map[string]ai.DayMeta{
+				"Monday": {Date: "2026-07-13"},
+				"Friday": {Date: "2026-07-17"},
+			},
+		},
+		Menu: map[string][]ai.MenuItem{
+			"Monday": {{Name: "Green Curry", Description: "Jasminreis", Category: "Green"}},
+			"Friday": {
+				{Name: "Poulet Cordon Bleu", Category: "Postino", Type: "meat", Icon: "fried-chicken", Photo: "https://example.test/postino.jpg"},
+				{Name: "Dal", Description: "Linsen-Curry", Category: "Green"},
+			},
+		},
+	}
+	put("gira_29_2026.json", gira)
+	put("turbolama_29_2026.json", map[string]any{
+		"type": "weekly",
+		"menu": []ai.MenuItem{{Name: "Curry Bowl", Restaurant: "Turbolama"}},
+	})
+
+	restaurants := registry{
+		"gira":      {ID: "gira", Name: "Gira", URL: "https://gira.example/menu"},
+		"turbolama": {ID: "turbolama", Name: "Turbolama"},
+		"luna":      {ID: "luna", Name: "Luna"},
+	}
+	return store, restaurants
+}
+
+func newTestAPI(t *testing.T) http.Handler {
+	store, restaurants := publishedMenus(t)
+	return withCORS(newAPI(restaurants, store, func() time.Time { return serveNow }), "https://lunch.example")
+}
+
+func get(t *testing.T, handler http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		request.Header.Set(header[i], header[i+1])
+	}
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	return response
+}
+
+func decode[T any](t *testing.T, response *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(response.Body.Bytes(), &v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", response.Body.String(), err)
+	}
+	return v
+}
+
+func TestServeStatus(t *testing.T) {
+	api := newTestAPI(t)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/restaurants", http.StatusOK},
+		{"/api/menus/2026-W29", http.StatusOK},
+		{"/api/menus/current", http.StatusOK},
+		{"/api/menus/next", http.StatusNotFound},
+		{"/api/menus/2026-W53", http.StatusNotFound}, // 2026 has 53 weeks, just no menu for it
+		{"/api/menus/2025-W53", http.StatusBadRequest},
+		{"/api/menus/29", http.StatusBadRequest},
+		{"/api/menus/today", http.StatusOK},
+		{"/api/restaurants/gira/days/2026-07-13", http.StatusOK},
+		{"/api/restaurants/gira/days/2026-07-14", http.StatusNotFound}, // not on the menu
+		{"/api/restaurants/luna/days/2026-07-17", http.StatusNotFound}, // nothing published
+		{"/api/restaurants/nope/days/2026-07-17", http.StatusNotFound},
+		{"/api/restaurants/gira/days/17.07.2026", http.StatusBadRequest},
+		{"/api/search?q=curry", http.StatusOK},
+		{"/api/search", http.StatusBadRequest},
+		{"/api/menu", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		response := get(t, api, tt.path)
+		if response.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d: %s", tt.path, response.Code, tt.want, response.Body)
+		}
+		if ct := response.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("GET %s Content-Type = %q, want application/json", tt.path, ct)
+		}
+	}
+}
+
+func TestServeWeekPassesTheFilesThrough(t *testing.T) {
+	response := decode[struct {
+		Year, Week int
+		Menus      map[string]json.RawMessage
+	}](t, get(t, newTestAPI(t), "/api/menus/2026-W29"))
+
+	if response.Year != 2026 || response.Week != 29 || len(response.Menus) != 2 {
+		t.Fatalf("got week %d of %d with %d menus, want week 29 of 2026 with gira and turbolama", response.Week, response.Year, len(response.Menus))
+	}
+	var gira ai.DailyMenu
+	if err := json.Unmarshal(response.Menus["gira"], &gira); err != nil || gira.SchemaVersion != ai.MenuSchemaVersion || len(gira.Menu["Friday"]) != 2 {
+		t.Errorf("gira = %s, want the published file", response.Menus["gira"])
+	}
+}
+
+func TestServeToday(t *testing.T) {
+	response := decode[struct {
+		Date, Day string
+		Menus     map[string][]ai.MenuItem
+	}](t, get(t, newTestAPI(t), "/api/menus/today"))
+
+	if response.Date != "2026-07-17" || response.Day != "Friday" {
+		t.Errorf("today = %s %s, want Friday 2026-07-17", response.Day, response.Date)
+	}
+	if gira := response.Menus["gira"]; len(gira) != 2 || gira[0].Restaurant != "Gira" {
+		t.Errorf("gira = %+v, want Friday's two dishes, named after the restaurant", gira)
+	}
+	if turbolama := response.Menus["turbolama"]; len(turbolama) != 1 {
+		t.Errorf("turbolama = %+v, want the weekly menu", turbolama)
+	}
+}
+
+func TestServeSearch(t *testing.T) {
+	response := decode[struct {
+		Results []searchHit
+	}](t, get(t, newTestAPI(t), "/api/search?q=CURRY&week=2026-W29"))
+
+	var got []string
+	for _, hit := range response.Results {
+		got = append(got, hit.RestaurantID+" "+hit.Day+" "+hit.Date+" "+hit.Name)
+	}
+	want := []string{
+		"gira Monday 2026-07-13 Green Curry",
+		"gira Friday 2026-07-17 Dal", // in its description
+		"turbolama   Curry Bowl",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("results:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// Just after midnight in Bern, it is already Friday there, whatever the server's
+// clock says.
+func TestServeTodayIsTheCanteens(t *testing.T) {
+	store, restaurants := publishedMenus(t)
+	api := newAPI(restaurants, store, func() time.Time { return time.Date(2026, 7, 16, 22, 30, 0, 0, time.UTC) })
+
+	response := decode[struct{ Date, Day string }](t, get(t, api, "/api/menus/today"))
+	if response.Date != "2026-07-17" || response.Day != "Friday" {
+		t.Errorf("today = %s %s, want Friday 2026-07-17", response.Day, response.Date)
+	}
+}
+
+// countedReads is a store that counts the reads that go to it.
+type countedReads struct {
+	storage.Store
+	reads int
+}
+
+func (s *countedReads) List(ctx context.Context, prefix string) ([]storage.Object, error) {
+	s.reads++
+	return s.Store.List(ctx, prefix)
+}
+
+func (s *countedReads) Get(ctx context.Context, name string) ([]byte, error) {
+	s.reads++
+	return s.Store.Get(ctx, name)
+}
+
+func (s *countedReads) GetObject(ctx context.Context, name string) ([]byte, storage.Object, error) {
+	s.reads++
+	return s.Store.GetObject(ctx, name)
+}
+
+func TestServeCachesTheMenus(t *testing.T) {
+	published, restaurants := publishedMenus(t)
+	store := &countedReads{Store: published}
+	now := serveNow
+	api := newAPI(restaurants, store, func() time.Time { return now })
+
+	get(t, api, "/api/menus/current")
+	// A request for each restaurant's file, which says since when it is there too
+	if reads := store.reads; reads != len(restaurants) {
+		t.Errorf("%d reads for the week's three files, want one each", reads)
+	}
+	reads := store.reads
+	get(t, api, "/api/menus/current")
+	get(t, api, "/api/search?q=curry")
+	if store.reads != reads {
+		t.Errorf("%d reads for answers from the same files, want none", store.reads-reads)
+	}
+
+	// Luna publishes: it is served once the cache has expired, not before
+	if err := published.Put(context.Background(), "luna_29_2026.json", []byte(`{"type": "weekly", "menu": []}`)); err != nil {
+		t.Fatal(err)
+	}
+	if response := get(t, api, "/api/restaurants/luna/days/2026-07-17"); response.Code != http.StatusNotFound {
+		t.Errorf("luna within the minute = %d, want the cached 404", response.Code)
+	}
+	now = now.Add(menuCacheFor)
+	if response := get(t, api, "/api/restaurants/luna/days/2026-07-17"); response.Code != http.StatusOK {
+		t.Errorf("luna after the minute = %d, want 200: %s", response.Code, response.Body)
+	}
+}
+
+func TestServeDayWorksOutDatesAFileDoesNotHave(t *testing.T) {
+	menu := &menuFile{Type: "daily", Menu: json.RawMessage(`{"Wednesday": [{"name": "Risotto"}]}`), restaurantName: "Luna"}
+
+	days := menu.days(isoWeek{2026, 53})
+	if len(days) != 1 || days[0].date != "2026-12-30" || days[0].dishes[0].Restaurant != "Luna" {
+		t.Errorf("days = %+v, want Wednesday 2026-12-30 at Luna", days)
+	}
+	if _, ok := menu.dishesOn(time.Date(2026, 12, 30, 12, 0, 0, 0, time.UTC)); !ok {
+		t.Error("dishesOn(Wednesday) found nothing")
+	}
+}
+
+func TestServeConditionalRequests(t *testing.T) {
+	api := newTestAPI(t)
+
+	first := get(t, api, "/api/menus/today")
+	etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("ETag = %q, Last-Modified = %q, want both", etag, lastModified)
+	}
+
+	if response := get(t, api, "/api/menus/today", "If-None-Match", etag); response.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match with the ETag = %d, want 304", response.Code)
+	}
+	if response := get(t, api, "/api/menus/today", "If-Modified-Since", lastModified); response.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since Last-Modified = %d, want 304", response.Code)
+	}
+	if response := get(t, api, "/api/search?q=dal", "If-None-Match", etag); response.Code != http.StatusOK {
+		t.Errorf("another answer with the ETag = %d, want 200", response.Code)
+	}
+}
+
+func TestServeCORS(t *testing.T) {
+	api := newTestAPI(t)
+
+	allowed := get(t, api, "/api/restaurants", "Origin", "https://lunch.example")
+	if got := allowed.Header().Get("Access-Control-Allow-Origin"); got != "https://lunch.example" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the allowed origin", got)
+	}
+	if got := allowed.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(got, "ETag") {
+		t.Errorf("Access-Control-Expose-Headers = %q, want ETag exposed", got)
+	}
+
+	other := get(t, api, "/api/restaurants", "Origin", "https://elsewhere.example")
+	if got := other.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q for an origin that isn't allowed", got)
+	}
+
+	preflight := httptest.NewRequest(http.MethodOptions, "/api/menus/today", nil)
+	preflight.Header.Set("Origin", "https://lunch.example")
+	preflight.Header.Set("Access-Control-Request-Method", "GET")
+	response := httptest.NewRecorder()
+	api.ServeHTTP(response, preflight)
+	if response.Code != http.StatusNoContent || !strings.Contains(response.Header().Get("Access-Control-Allow-Methods"), "GET") {
+		t.Errorf("preflight = %d, Allow-Methods %q, want 204 allowing GET", response.Code, response.Header().Get("Access-Control-Allow-Methods"))
+	}
+
+	// Any origin, as the frontend on R2 needs it
+	anyOrigin := withCORS(http.NotFoundHandler(), "*")
+	if got := get(t, anyOrigin, "/", "Origin", "https://x.example").Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	api := newTestAPI(t)
+	get(t, api, "/api/menus/2026-W29")
+	get(t, api, "/api/menus/29")
+
+	response := get(t, api, "/metrics")
+	if response.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, want 200", response.Code)
+	}
+	for _, want := range []string{
+		`lunch_api_requests_total{code="200",route="GET /api/menus/{week}"}`,
+		`lunch_api_requests_total{code="400",route="GET /api/menus/{week}"}`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(response.Body.String(), want) {
+			t.Errorf("GET /metrics has no %s:\n%s", want, response.Body)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/replay"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+	"github.com/chlab/lunch-wankdorf/pkg/storage"
+)
+
+// session is what the restaurants of one invocation share: one Chrome, one
+// parser and what it spends, and the tape when the run is recorded or replayed.
+type session struct {
+	browser *scraper.Browser
+	tape    *replay.Tape
+	meter   *ai.Meter
+	prompts *ai.Prompts
+
+	parserOnce sync.Once
+	parser     *ai.Parser
+	parserErr  error
+
+	cache *parseCache
+}
+
+func newSession(config Config) (*session, error) {
+	tape, err := openTape(config)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := ai.LoadPrices(pricesFile(config))
+	if err != nil {
+		return nil, err
+	}
+	prompts, err := ai.LoadPrompts(promptsDir(config))
+	if err != nil {
+		return nil, err
+	}
+	cache, err := openParseCache(config)
+	if err != nil {
+		// Without it the days are parsed as they were before there was one
+		slog.Warn("No parse cache", "error", err)
+	}
+	return &session{
+		browser: scraper.NewBrowser(config.DebugMode),
+		tape:    tape,
+		meter:   ai.NewMeter(prices, config.Budget),
+		prompts: prompts,
+		cache:   cache,
+	}, nil
+}
+
+func (s *session) close() {
+	s.browser.Close()
+}
+
+// openTape opens the tape to record to or replay from, if the run has one.
+func openTape(config Config) (*replay.Tape, error) {
+	switch {
+	case config.RecordDir != "" && config.ReplayDir != "":
+		return nil, errors.New("a run can record or replay, not both")
+	case config.RecordDir != "":
+		slog.Info("Recording everything fetched", "dir", config.RecordDir)
+		return replay.Open(config.RecordDir, replay.Record)
+	case config.ReplayDir != "":
+		// A replayed menu is last week's, or a deliberately broken one - never
+		// something to publish over the live menu. A local mirror is fair game.
+		if config.Upload && !strings.EqualFold(config.Storage, storage.BackendLocal) {
+			return nil, errors.New("a replayed run can only be uploaded to local storage")
+		}
+		slog.Info("Replaying a recording, nothing will be fetched", "dir", config.ReplayDir)
+		return replay.Open(config.ReplayDir, replay.Replay)
+	default:
+		return nil, nil
+	}
+}
+
+// scraper builds the scraper a restaurant names, on the session's tape.
+func (s *session) scraper(restaurant scraper.RestaurantMenu, debug bool) (scraper.Scraper, error) {
+	sc, err := scraper.New(restaurant.Scraper, scraper.Options{Browser: s.browser, Debug: debug})
+	if err != nil {
+		return nil, err
+	}
+	return scraper.Taped(sc, s.tape), nil
+}
+
+// getParser returns the session's parser, setting it up on first use: a dry run
+// never gets this far, and must not need an API key. A replay needs no provider
+// at all.
+func (s *session) getParser() (*ai.Parser, error) {
+	s.parserOnce.Do(func() {
+		if s.tape.Replaying() {
+			// A replay spends nothing, whatever the recording did
+			s.parser = ai.NewParser(ai.TapedProvider(nil, s.tape), nil).WithPrompts(s.prompts)
+			return
+		}
+
+		provider, err := ai.ProviderFromEnv()
+		if err != nil {
+			s.parserErr = err
+			return
+		}
+		s.parser = ai.NewParser(ai.TapedProvider(provider, s.tape), s.meter).WithPrompts(s.prompts)
+	})
+	return s.parser, s.parserErr
+}
+
+// httpClient is for the requests the run makes itself (dish pages), on the
+// session's tape.
+func (s *session) httpClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: s.tape.Transport(nil)}
+}
+
+// pricesFile is the file the models' prices are read from: the flag if given, else
+// the PRICES_FILE environment variable, else none, for the shipped prices.
+func pricesFile(config Config) string {
+	if config.PricesFile != "" {
+		return config.PricesFile
+	}
+	return os.Getenv("PRICES_FILE")
+}
+
+// promptsDir is the directory the prompt templates are read from: the flag if
+// given, else the PROMPTS_DIR environment variable, else none, for the shipped
+// prompts.
+func promptsDir(config Config) string {
+	if config.PromptsDir != "" {
+		return config.PromptsDir
+	}
+	return os.Getenv("PROMPTS_DIR")
+}
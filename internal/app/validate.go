@@ -0,0 +1,97 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+)
+
+// validateDay checks a parsed day against what its page actually offered, and
+// describes every problem in words the model can act on when the day is retried.
+//
+// The dish count alone misses a day that comes back with the right number of
+// dishes but one of them twice, or with a dish the model made up. So besides the
+// count, every dish's category and link must be on the page, and no dish may be
+// there twice.
+func validateDay(day scraper.DayMenu, items []ai.MenuItem) []string {
+	var problems []string
+	if len(items) < day.Dishes {
+		problems = append(problems, fmt.Sprintf("only %d of the %d dishes on the page were returned", len(items), day.Dishes))
+	}
+
+	page := offeredOn(day)
+	linkedBy := make(map[string]string, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if item.Category != "" && !page.hasCategory(item.Category) {
+			problems = append(problems, fmt.Sprintf("%q: the category %q is not on the page", item.Name, item.Category))
+		}
+
+		if item.Link != "" {
+			if !page.links[item.Link] {
+				problems = append(problems, fmt.Sprintf("%q: the link %s is not on the page", item.Name, item.Link))
+			}
+			if other, ok := linkedBy[item.Link]; ok {
+				problems = append(problems, fmt.Sprintf("%q has the same link as %q, one of them is a duplicate", item.Name, other))
+			}
+			linkedBy[item.Link] = item.Name
+		}
+
+		key := strings.ToLower(item.Category + "\x00" + item.Name)
+		if seen[key] {
+			problems = append(problems, fmt.Sprintf("%q is listed twice", item.Name))
+		}
+		seen[key] = true
+	}
+
+	return problems
+}
+
+// pageOffer is what a day's page shows: the text the categories are copied from,
+// and every link on it.
+type pageOffer struct {
+	categories map[string]bool
+	text       string
+	links      map[string]bool
+}
+
+func offeredOn(day scraper.DayMenu) pageOffer {
+	offer := pageOffer{categories: make(map[string]bool), links: make(map[string]bool)}
+
+	// What the scraper worked out for itself is on the page, even if it is not in
+	// the HTML the model was given
+	for _, dish := range day.Items {
+		offer.categories[dish.Category] = true
+		offer.links[dish.Link] = true
+	}
+	for category, link := range day.Links {
+		offer.categories[category] = true
+		offer.links[link] = true
+	}
+	for category := range day.Photos {
+		offer.categories[category] = true
+	}
+	if day.URL != "" {
+		offer.links[day.URL] = true
+	}
+
+	if doc, err := goquery.NewDocumentFromReader(strings.NewReader(day.HTML)); err == nil {
+		offer.text = strings.Join(strings.Fields(doc.Text()), " ")
+		doc.Find("a[href]").Each(func(_ int, link *goquery.Selection) {
+			href, _ := link.Attr("href")
+			offer.links[href] = true
+		})
+	}
+
+	return offer
+}
+
+// hasCategory reports whether category is on the page. A category has to be
+// copied verbatim, so anything that is not in the page's text was reworded or
+// made up.
+func (o pageOffer) hasCategory(category string) bool {
+	return o.categories[category] || strings.Contains(o.text, strings.Join(strings.Fields(category), " "))
+}
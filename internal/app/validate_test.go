@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/metrics"
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var validatedDay = scraper.DayMenu{
+	Day: "friday",
+	HTML: `<div><h3>Pasta Del Giorno</h3><p>PASTA PESTO, Basilikum</p><a href="/pasta">Details</a></div>` +
+		`<div><h3>Pizza Del Giorno</h3><p>PIZZA SICILIANA, Kapern</p><a href="/pizza">Details</a></div>`,
+	Dishes: 2,
+}
+
+// validatedDishes is validatedDay's dishes as a scraper that lists them one by one
+// has them, for the rules.
+var validatedDishes = []ai.Dish{
+	{Category: "Pasta Del Giorno", Description: "PASTA PESTO, Basilikum", Link: "/pasta", Labels: []string{"vegetarian"}},
+	{Category: "Pizza Del Giorno", Description: "PIZZA SICILIANA, Kapern", Link: "/pizza", Labels: []string{"vegetarian"}},
+}
+
+func TestValidateDay(t *testing.T) {
+	pasta := ai.MenuItem{Name: "Pasta Pesto", Link: "/pasta", Category: "Pasta Del Giorno"}
+	pizza := ai.MenuItem{Name: "Pizza Siciliana", Link: "/pizza", Category: "Pizza Del Giorno"}
+
+	tests := []struct {
+		name  string
+		items []ai.MenuItem
+		want  []string // one substring per problem
+	}{
+		{"everything on the page", []ai.MenuItem{pasta, pizza}, nil},
+		{"a dish short", []ai.MenuItem{pasta}, []string{"only 1 of the 2 dishes"}},
+		{
+			// The right count, but the pizza is missing
+			"the same dish twice",
+			[]ai.MenuItem{pasta, pasta},
+			[]string{"the same link as", "listed twice"},
+		},
+		{
+			// Loose, but copied from the page all the same
+			"part of a heading",
+			[]ai.MenuItem{pasta, {Name: "Pizza Siciliana", Link: "/pizza", Category: "Pizza"}},
+			nil,
+		},
+		{
+			"a reworded category",
+			[]ai.MenuItem{pasta, {Name: "Pizza Siciliana", Link: "/pizza", Category: "Pizza of the Day"}},
+			[]string{`the category "Pizza of the Day" is not on the page`},
+		},
+		{
+			"a made-up link",
+			[]ai.MenuItem{pasta, {Name: "Pizza Siciliana", Link: "/menu/pizza", Category: "Pizza Del Giorno"}},
+			[]string{"the link /menu/pizza is not on the page"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := validateDay(validatedDay, test.items)
+			if len(problems) != len(test.want) {
+				t.Fatalf("problems = %q, want %d", problems, len(test.want))
+			}
+			for i, want := range test.want {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("problems[%d] = %q, want it to mention %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+// scriptedProvider answers with one scripted completion after the other, and
+// keeps the prompts it was sent.
+type scriptedProvider struct {
+	mu      sync.Mutex
+	answers []string
+	usage   ai.Usage // what each answer took
+	prompts []string
+}
+
+func (p *scriptedProvider) Model() string { return "scripted" }
+
+func (p *scriptedProvider) Complete(_ context.Context, req ai.CompletionRequest) (*ai.Completion, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	answer := p.answers[min(len(p.prompts), len(p.answers)-1)]
+	p.prompts = append(p.prompts, req.Prompt)
+	return &ai.Completion{Content: answer, Usage: p.usage}, nil
+}
+
+const (
+	duplicatedAnswer = `{"items":[` +
+		`{"name":"Pasta Pesto","description":"","type":"vegetarian","icon":"spaghetti","link":"/pasta","category":"Pasta Del Giorno"},` +
+		`{"name":"Pasta Pesto","description":"","type":"vegetarian","icon":"spaghetti","link":"/pasta","category":"Pasta Del Giorno"}]}`
+	correctAnswer = `{"items":[` +
+		`{"name":"Pasta Pesto","description":"","type":"vegetarian","icon":"spaghetti","link":"/pasta","category":"Pasta Del Giorno"},` +
+		`{"name":"Pizza Siciliana","description":"","type":"vegetarian","icon":"pizza","link":"/pizza","category":"Pizza Del Giorno"}]}`
+)
+
+func TestParseDayWithRetryTellsTheModelWhatWasWrong(t *testing.T) {
+	provider := &scriptedProvider{answers: []string{duplicatedAnswer, correctAnswer}}
+	ctx := context.WithValue(context.Background(), restaurantRunKey{}, &restaurantRun{id: "test-retry"})
+	retries := metrics.ParseRetries.WithLabelValues("test-retry")
+
+	items, problems, err := parseDayWithRetry(ctx, ai.NewParser(provider, nil), validatedDay, nil)
+	if err != nil {
+		t.Fatalf("parseDayWithRetry() error = %v", err)
+	}
+	if len(problems) != 0 || len(items) != 2 {
+		t.Errorf("got %d items and problems %q, want the corrected day", len(items), problems)
+	}
+	if got := testutil.ToFloat64(retries); got != 1 {
+		t.Errorf("counted %v retries, want 1", got)
+	}
+	onPage, parsed := testutil.ToFloat64(metrics.DishesOnPage.WithLabelValues("test-retry")), testutil.ToFloat64(metrics.DishesParsed.WithLabelValues("test-retry"))
+	if onPage != float64(validatedDay.Dishes) || parsed != 2 {
+		t.Errorf("counted %v dishes on the page and %v parsed, want %d and 2", onPage, parsed, validatedDay.Dishes)
+	}
+
+	if len(provider.prompts) != 2 {
+		t.Fatalf("sent %d prompts, want a retry", len(provider.prompts))
+	}
+	if strings.Contains(provider.prompts[0], "previous answer") {
+		t.Error("the first attempt has feedback, but there was nothing to correct yet")
+	}
+	if !strings.Contains(provider.prompts[1], `"Pasta Pesto" is listed twice`) {
+		t.Errorf("the retry does not say what was wrong:\n%s", provider.prompts[1])
+	}
+}
+
+func init() {
+	scraper.Register("test-validated", func(scraper.Options) scraper.Scraper {
+		day := validatedDay
+		day.Items = validatedDishes
+		return stubScraper{data: scraper.MenuData{Days: []scraper.DayMenu{day}}}
+	})
+}
+
+func TestRequireValidBlocksTheUpload(t *testing.T) {
+	// The rules only fill in what the model left out: an answer that still fails
+	// validation blocks the upload all the same
+	for _, parser := range []string{"model", "rules+model"} {
+		t.Run(parser, func(t *testing.T) {
+			sess, err := newSession(Config{})
+			if err != nil {
+				t.Fatalf("newSession() error = %v", err)
+			}
+			defer sess.close()
+			sess.parserOnce.Do(func() {
+				sess.parser = ai.NewParser(&scriptedProvider{answers: []string{duplicatedAnswer}}, nil)
+			})
+
+			config := Config{Upload: true, RequireValid: true, Parser: parser}
+			restaurant := scraper.RestaurantMenu{Name: "Gira", URL: "https://gira.test", Scraper: "test-validated"}
+
+			var problems []string
+			captureStdout(t, func() error {
+				problems, err = processRestaurant(context.Background(), restaurant, config, sess)
+				return nil
+			})
+
+			if err == nil || !strings.Contains(err.Error(), "not uploaded") {
+				t.Errorf("error = %v, want the menu held back", err)
+			}
+			if len(problems) == 0 || !strings.HasPrefix(problems[0], "friday: ") {
+				t.Errorf("problems = %q, want them by day", problems)
+			}
+		})
+	}
+}
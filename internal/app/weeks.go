@@ -0,0 +1,105 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+)
+
+// isoWeek is the week a published menu file is for.
+type isoWeek struct {
+	year int
+	week int
+}
+
+func weekOf(t time.Time) isoWeek {
+	year, week := t.ISOWeek()
+	return isoWeek{year: year, week: week}
+}
+
+func (w isoWeek) String() string {
+	return fmt.Sprintf("week %d of %d", w.week, w.year)
+}
+
+func (w isoWeek) before(other isoWeek) bool {
+	return w.year < other.year || (w.year == other.year && w.week < other.week)
+}
+
+// parseISOWeek reads a week the way ISO 8601 writes it, e.g. "2026-W29".
+func parseISOWeek(value string) (isoWeek, error) {
+	yearPart, weekPart, ok := strings.Cut(value, "-W")
+	year, yearErr := strconv.Atoi(yearPart)
+	week, weekErr := strconv.Atoi(weekPart)
+	if !ok || yearErr != nil || weekErr != nil {
+		return isoWeek{}, fmt.Errorf("invalid week %q, want e.g. 2026-W29", value)
+	}
+
+	// December 28 is always in the last week of its year, 52 or 53
+	if _, last := time.Date(year, time.December, 28, 0, 0, 0, 0, time.UTC).ISOWeek(); week < 1 || week > last {
+		return isoWeek{}, fmt.Errorf("invalid week %q, %d has weeks 1 to %d", value, year, last)
+	}
+	return isoWeek{year: year, week: week}, nil
+}
+
+// date is the day of the week that falls on weekday, as an ISO date.
+func (w isoWeek) date(weekday time.Weekday) string {
+	// January 4 is always in week 1
+	jan4 := time.Date(w.year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	monday := jan4.AddDate(0, 0, -(int(jan4.Weekday())+6)%7)
+	return monday.AddDate(0, 0, (w.week-1)*7+(int(weekday)+6)%7).Format(time.DateOnly)
+}
+
+// weekMenu is the part of a scraped page that falls into one ISO week.
+type weekMenu struct {
+	week isoWeek
+	days []scraper.DayMenu
+}
+
+// splitByWeek groups the scraped days by the ISO week their date falls in, oldest
+// first. The week a menu belongs to is the one its dishes are served in, not the
+// one the run happens in: a Friday run that already sees next Monday's dishes must
+// put them into next week's file, not this one's.
+//
+// A day without a date (a scraper that can't tell) is put into the week of now,
+// which is what every menu was published under before.
+func splitByWeek(days []scraper.DayMenu, now time.Time) ([]weekMenu, error) {
+	byWeek := make(map[isoWeek][]scraper.DayMenu)
+	for _, day := range days {
+		week := weekOf(now)
+		if day.Date != "" {
+			date, err := time.Parse(time.DateOnly, day.Date)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected date %q for %s: %w", day.Date, day.Day, err)
+			}
+			week = weekOf(date)
+		}
+		byWeek[week] = append(byWeek[week], day)
+	}
+
+	weeks := make([]weekMenu, 0, len(byWeek))
+	for week, days := range byWeek {
+		weeks = append(weeks, weekMenu{week: week, days: days})
+	}
+	sort.Slice(weeks, func(i, j int) bool { return weeks[i].week.before(weeks[j].week) })
+
+	if len(weeks) > 1 {
+		slog.Info("The page spans several weeks, publishing each on its own", "weeks", len(weeks))
+	}
+	return weeks, nil
+}
+
+// upcomingWeeks drops the weeks up to and including current.
+func upcomingWeeks(weeks []weekMenu, current isoWeek) []weekMenu {
+	var upcoming []weekMenu
+	for _, week := range weeks {
+		if current.before(week.week) {
+			upcoming = append(upcoming, week)
+		}
+	}
+	return upcoming
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/scraper"
+)
+
+func TestSplitByWeekFollowsTheScrapedDates(t *testing.T) {
+	// A Friday run whose page already shows next week, across the turn of the year
+	friday := time.Date(2026, 12, 25, 12, 0, 0, 0, time.UTC)
+	days := []scraper.DayMenu{
+		{Day: "monday", Date: "2027-01-04"},
+		{Day: "thursday", Date: "2026-12-31"},
+		{Day: "friday", Date: "2027-01-01"},
+		{Day: "friday", Date: "2026-12-25"},
+	}
+
+	weeks, err := splitByWeek(days, friday)
+	if err != nil {
+		t.Fatalf("splitByWeek() error = %v", err)
+	}
+
+	want := []struct {
+		week isoWeek
+		days int
+	}{
+		{isoWeek{2026, 52}, 1},
+		{isoWeek{2026, 53}, 2}, // Jan 1 2027 is still in week 53 of 2026
+		{isoWeek{2027, 1}, 1},
+	}
+	if len(weeks) != len(want) {
+		t.Fatalf("got %d weeks, want %d: %+v", len(weeks), len(want), weeks)
+	}
+	for i, w := range want {
+		if weeks[i].week != w.week || len(weeks[i].days) != w.days {
+			t.Errorf("weeks[%d] = %s with %d days, want %s with %d", i, weeks[i].week, len(weeks[i].days), w.week, w.days)
+		}
+	}
+
+	if upcoming := upcomingWeeks(weeks, weekOf(friday)); len(upcoming) != 2 || upcoming[0].week != (isoWeek{2026, 53}) {
+		t.Errorf("upcomingWeeks() = %+v, want weeks 53 and 1", upcoming)
+	}
+	if got, want := menuFilename("Gira", weeks[2].week), "gira_1_2027.json"; got != want {
+		t.Errorf("menuFilename() = %q, want %q", got, want)
+	}
+}
+
+func TestSplitByWeekPutsUndatedDaysIntoTheCurrentWeek(t *testing.T) {
+	now := time.Date(2026, 7, 17, 12, 0, 0, 0, time.UTC)
+
+	weeks, err := splitByWeek([]scraper.DayMenu{{Day: "friday"}}, now)
+	if err != nil {
+		t.Fatalf("splitByWeek() error = %v", err)
+	}
+	if len(weeks) != 1 || weeks[0].week != (isoWeek{2026, 29}) {
+		t.Errorf("weeks = %+v, want week 29 of 2026", weeks)
+	}
+
+	if _, err := splitByWeek([]scraper.DayMenu{{Day: "friday", Date: "17.07.2026"}}, now); err == nil {
+		t.Error("want an error for a date that isn't ISO")
+	}
+}
@@ -0,0 +1,149 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	anthropicBaseURL   = "https://api.anthropic.com"
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 8192
+)
+
+// anthropicProvider talks to the Anthropic Messages API. It has no response
+// format to put a schema on, so the schema becomes the input of a tool the model
+// is made to call, and the tool call's input is the answer.
+type anthropicProvider struct {
+	client  *http.Client
+	apiKey  string
+	baseURL string
+	model   string
+}
+
+func newAnthropicProvider(apiKey, baseURL, model string) (*anthropicProvider, error) {
+	if apiKey == "" {
+		return nil, errors.New("ANTHROPIC_API_KEY environment variable not set")
+	}
+	if model == "" {
+		return nil, errors.New("ANTHROPIC_MODEL environment variable not set")
+	}
+	if baseURL == "" {
+		baseURL = anthropicBaseURL
+	}
+
+	return &anthropicProvider{
+		client:  &http.Client{},
+		apiKey:  apiKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+	}, nil
+}
+
+func (p *anthropicProvider) Model() string {
+	return p.model
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type anthropicRequest struct {
+	Model      string              `json:"model"`
+	MaxTokens  int                 `json:"max_tokens"`
+	Messages   []anthropicMessage  `json:"messages"`
+	Tools      []anthropicTool     `json:"tools"`
+	ToolChoice anthropicToolChoice `json:"tool_choice"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *anthropicProvider) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	body := anthropicRequest{
+		Model:     p.model,
+		MaxTokens: anthropicMaxTokens,
+		Messages:  []anthropicMessage{{Role: "user", Content: req.Prompt}},
+		Tools: []anthropicTool{{
+			Name:        req.SchemaName,
+			Description: "Record the parsed menu.",
+			InputSchema: req.Schema,
+		}},
+		ToolChoice: anthropicToolChoice{Type: "tool", Name: req.SchemaName},
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Anthropic base URL %q: %w", p.baseURL, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Api-Key", p.apiKey)
+	httpReq.Header.Set("Anthropic-Version", anthropicVersion)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("Anthropic API error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the Anthropic response: %w", err)
+	}
+
+	var parsed anthropicResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("Anthropic API error: %s: %s", resp.Status, respBody)
+	}
+	if parsed.Error != nil {
+		return nil, fmt.Errorf("Anthropic API error: %s: %s", parsed.Error.Type, parsed.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Anthropic API error: %s", resp.Status)
+	}
+
+	for _, block := range parsed.Content {
+		if block.Type == "tool_use" && block.Name == req.SchemaName {
+			usage := Usage{InputTokens: parsed.Usage.InputTokens, OutputTokens: parsed.Usage.OutputTokens}
+			return &Completion{Content: string(block.Input), Usage: usage}, nil
+		}
+	}
+	return nil, fmt.Errorf("no response from API (stop reason: %s)", parsed.StopReason)
+}
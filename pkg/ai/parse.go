@@ -0,0 +1,355 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/metrics"
+)
+
+const completionTimeout = 3 * time.Minute
+
+// MenuItem represents a single dish on a restaurant menu.
+type MenuItem struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Icon        string `json:"icon"`
+	Link        string `json:"link,omitempty"`
+	Restaurant  string `json:"restaurant,omitempty"`
+
+	// Category is the heading the dish is listed under ("Pizza Del Giorno",
+	// "Chefs Choice"). It is what a photo is matched to, so it is filled by the
+	// model, copied verbatim from the page.
+	Category string `json:"category,omitempty"`
+
+	// Photo is a thumbnail-sized dish photo and PhotoLarge the version the
+	// frontend opens in the lightbox. Both are filled in by us, never by the
+	// model, and are empty when the restaurant has no photo for the dish.
+	Photo      string `json:"photo,omitempty"`
+	PhotoLarge string `json:"photoLarge,omitempty"`
+
+	// FirstSeen, LastSeen and TimesServed are the dish's history at the
+	// restaurant as of the day it is on (see pkg/history), also filled in by us:
+	// the first day it was served, the last day before this one, and on how many
+	// days, this one included. A dish whose FirstSeen is its own day is new.
+	FirstSeen   string `json:"firstSeen,omitempty"`
+	LastSeen    string `json:"lastSeen,omitempty"`
+	TimesServed int    `json:"timesServed,omitempty"`
+}
+
+// DailyMenu wraps a per-day menu (HTML restaurants).
+type DailyMenu struct {
+	Type string `json:"type"`
+	MenuMeta
+	Menu map[string][]MenuItem `json:"menu"`
+}
+
+// WeeklyMenu wraps a flat list of items (PDF restaurants).
+type WeeklyMenu struct {
+	Type string `json:"type"`
+	MenuMeta
+	Menu []MenuItem `json:"menu"`
+}
+
+// MenuSchemaVersion is the version of the published menu files. Version 1 was
+// just the type and the menu; 2 added MenuMeta. Fields are only ever added, so a
+// reader of an older version (the frontend) can read a newer file.
+const MenuSchemaVersion = 2
+
+// MenuMeta says what a published menu is and where it came from, so a consumer
+// can tell a stale file from a fresh one. Its fields sit next to type and menu
+// rather than wrapping them, which keeps the files readable by the frontend as it
+// was. A version 1 file has none of them.
+type MenuMeta struct {
+	SchemaVersion  int       `json:"schemaVersion,omitempty"`
+	RestaurantID   string    `json:"restaurantId,omitempty"`
+	RestaurantName string    `json:"restaurantName,omitempty"`
+	Year           int       `json:"year,omitempty"` // ISO week-numbering year
+	Week           int       `json:"week,omitempty"` // ISO week
+	GeneratedAt    time.Time `json:"generatedAt,omitzero"`
+	Model          string    `json:"model,omitempty"`         // the model that parsed the menu, empty if none did
+	PromptVersion  int       `json:"promptVersion,omitempty"` // the version of the prompts it was asked with (see Prompts)
+	Parser         string    `json:"parser,omitempty"`        // model, rules or rules+model
+	SourceURL      string    `json:"sourceUrl,omitempty"`
+	Usage          Spend     `json:"usage,omitzero"` // what parsing the menu took from the model, the days' added up
+
+	// Days has the same keys as a daily menu ("Monday"); weekly menus have none.
+	Days map[string]DayMeta `json:"days,omitempty"`
+}
+
+// Metadata gives the menus that embed MenuMeta a common way to fill it in.
+func (m *MenuMeta) Metadata() *MenuMeta {
+	return m
+}
+
+// DayMeta is what the page said about a day, next to what was made of it.
+type DayMeta struct {
+	Date         string `json:"date"`         // ISO date, e.g. "2026-07-17"
+	DishesOnPage int    `json:"dishesOnPage"` // what the parsed day was checked against
+
+	// Scraped is the day's dishes as the page listed them, "category: description",
+	// and PageHash a hash of the day's HTML for the scrapers that don't list them
+	// one by one. A refresh compares the page to them to tell whether the day
+	// changed since.
+	Scraped  []string `json:"scraped,omitempty"`
+	PageHash string   `json:"pageHash,omitempty"`
+
+	// Usage is what parsing the day took from the model, retries included. A day
+	// from the cache, or parsed by the rules, took nothing and has none.
+	Usage Spend `json:"usage,omitzero"`
+}
+
+// IconsList describes each icon plus an optional disambiguation hint, for use
+// in the prompt. The schema enum uses just the bare icon names (see iconNames).
+var IconsList = []string{
+	"bento",
+	"curry (only curries)",
+	"dumplings (ravioli, gnocchi, tortellini, asian dumplings)",
+	"french-fries",
+	"fried-chicken (only chicken)",
+	"hamburger (any type of burger)",
+	"hot-dog",
+	"korean-rice-cake (spring or summer rolls)",
+	"lasagna-sheets",
+	"miso-soup (asian-style soup)",
+	"nachos",
+	"noodles (asian, not pasta)",
+	"paella",
+	"pizza",
+	"rack-of-lamb",
+	"rice-bowl (rice dishes, risotto, bowl)",
+	"salad",
+	"sandwich",
+	"sausage",
+	"seafood",
+	"spaghetti (pasta)",
+	"porridge (mac n cheese)",
+	"steak (grilled meats, bbq)",
+	"steak-rare (meat)",
+	"sushi",
+	"taco",
+	"vegan-food (vegetarian bowls)",
+	"wrap",
+}
+
+// The types a dish can have, which are the ones the frontend knows. Fish and
+// seafood are meat: the type is there to tell vegetarians what they can eat.
+const (
+	TypeVegan      = "vegan"
+	TypeVegetarian = "vegetarian"
+	TypeMeat       = "meat"
+)
+
+// DishTypes are the types, strictest first. A prompt version that names them (see
+// Prompts) has the schema hold the model to them, as it does to the icons.
+var DishTypes = []string{TypeVegan, TypeVegetarian, TypeMeat}
+
+func iconNames() []string {
+	out := make([]string, len(IconsList))
+	for i, item := range IconsList {
+		if idx := strings.Index(item, " ("); idx > 0 {
+			out[i] = item[:idx]
+		} else {
+			out[i] = item
+		}
+	}
+	return out
+}
+
+// menuItemSchema describes one dish. Day menus (HTML) also carry the dish's link
+// and the category heading it sits under; PDF menus have neither. The type is one
+// of types, or anything if there are none.
+func menuItemSchema(includeLink bool, types []string) map[string]any {
+	dishType := map[string]any{"type": "string"}
+	if len(types) > 0 {
+		dishType["enum"] = types
+	}
+	properties := map[string]any{
+		"name":        map[string]any{"type": "string"},
+		"description": map[string]any{"type": "string"},
+		"type":        dishType,
+		"icon":        map[string]any{"type": "string", "enum": iconNames()},
+	}
+	required := []string{"name", "description", "type", "icon"}
+	if includeLink {
+		properties["link"] = map[string]any{"type": "string"}
+		properties["category"] = map[string]any{"type": "string"}
+		required = append(required, "link", "category")
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func itemsSchema(includeLink bool, types []string) json.RawMessage {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"items": map[string]any{
+				"type":  "array",
+				"items": menuItemSchema(includeLink, types),
+			},
+		},
+		"required":             []string{"items"},
+		"additionalProperties": false,
+	}
+	b, _ := json.Marshal(schema)
+	return b
+}
+
+// Parser turns scraped menus into MenuItems with a model. The prompts and the JSON
+// schema the answer has to follow are the same whichever provider runs the model.
+type Parser struct {
+	provider CompletionProvider
+	meter    *Meter
+	prompts  *Prompts
+	prompt   Prompt // what the prompts are written with; its Version is set
+}
+
+// NewParser returns a parser that sends its prompts to provider, priced and held
+// to a budget by meter, which may be nil. It writes them with the latest of the
+// shipped prompts.
+func NewParser(provider CompletionProvider, meter *Meter) *Parser {
+	prompts := DefaultPrompts()
+	return &Parser{provider: provider, meter: meter, prompts: prompts, prompt: Prompt{Version: prompts.Latest()}}
+}
+
+// WithPrompts returns a parser that writes its prompts with the latest of prompts
+// instead. It shares p's provider and meter.
+func (p *Parser) WithPrompts(prompts *Prompts) *Parser {
+	parser := *p
+	parser.prompts, parser.prompt = prompts, Prompt{Version: prompts.Latest()}
+	return &parser
+}
+
+// ForRestaurant returns a parser for a restaurant's menus, which writes its
+// prompts with the version, language and hints the restaurant asks for in prompt.
+// It shares p's provider and meter.
+func (p *Parser) ForRestaurant(prompt Prompt) (*Parser, error) {
+	prompt, err := p.prompts.resolve(prompt)
+	if err != nil {
+		return nil, err
+	}
+	parser := *p
+	parser.prompt = prompt
+	return &parser, nil
+}
+
+// PromptVersion is the version of the prompts the parser writes.
+func (p *Parser) PromptVersion() int {
+	return p.prompt.Version
+}
+
+// PromptKey identifies the prompts the parser writes, short of the menu in them:
+// the templates as they are, what the restaurant adds and the schema the answer
+// is held to. An answer kept under another key was to another prompt.
+func (p *Parser) PromptKey() string {
+	return p.prompts.key(p.prompt)
+}
+
+// Model is the model the parser's provider runs.
+func (p *Parser) Model() string {
+	return p.provider.Model()
+}
+
+func (p *Parser) complete(ctx context.Context, prompt string, schema json.RawMessage, schemaName string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+
+	if err := p.meter.check(p.Model()); err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	completion, err := p.provider.Complete(ctx, CompletionRequest{
+		Prompt:     prompt,
+		Schema:     schema,
+		SchemaName: schemaName,
+	})
+	elapsed := time.Since(start)
+	if err != nil {
+		metrics.ModelRequestDuration.WithLabelValues(p.Model(), "error").Observe(elapsed.Seconds())
+		slog.WarnContext(ctx, "The model failed to answer", "model", p.Model(), "schema", schemaName, "duration", elapsed, "error", err)
+		return "", err
+	}
+
+	spend := p.meter.record(ctx, p.Model(), completion.Usage)
+	for _, tally := range talliesFrom(ctx) {
+		tally.add(spend)
+	}
+
+	metrics.ModelRequestDuration.WithLabelValues(p.Model(), "ok").Observe(elapsed.Seconds())
+	metrics.ModelTokens.WithLabelValues(p.Model(), "input").Add(float64(spend.InputTokens))
+	metrics.ModelTokens.WithLabelValues(p.Model(), "output").Add(float64(spend.OutputTokens))
+	metrics.ModelTokens.WithLabelValues(p.Model(), "reasoning").Add(float64(spend.ReasoningTokens))
+	metrics.ModelCost.WithLabelValues(p.Model()).Add(spend.CostUSD)
+	slog.InfoContext(ctx, "The model answered", "model", p.Model(), "schema", schemaName, "duration", elapsed,
+		"inputTokens", spend.InputTokens, "outputTokens", spend.OutputTokens, "reasoningTokens", spend.ReasoningTokens,
+		"costUsd", roundCost(spend.CostUSD))
+	return completion.Content, nil
+}
+
+// ParseDayMenu sends a single day's HTML to the model to extract that day's dishes.
+//
+// One call per day, rather than one call for the whole week: the model reliably
+// lost interest towards the end of a week-long document and returned the last days
+// empty. A day is small enough to parse in full, the day itself is never in doubt,
+// and a day that does come back short can be retried on its own.
+//
+// feedback is what was wrong with an earlier answer for the same day, for a retry
+// to correct.
+func (p *Parser) ParseDayMenu(ctx context.Context, day string, dayHTML string, feedback ...string) ([]MenuItem, error) {
+	prompt, err := p.prompts.render("day", p.prompt, promptData{Day: day, Feedback: feedback, Input: dayHTML})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := p.complete(ctx, prompt, p.prompts.schema(p.prompt, true), "restaurant_day_menu")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the %s menu: %w", day, err)
+	}
+
+	var parsed struct {
+		Items []MenuItem `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse the %s menu JSON: %w", day, err)
+	}
+
+	return parsed.Items, nil
+}
+
+// ParseRestaurantPdfMenu sends extracted text from a PDF to the model to extract menu information.
+func (p *Parser) ParseRestaurantPdfMenu(ctx context.Context, extractedText string, restaurantName string, pdfURL string) (*WeeklyMenu, error) {
+	prompt, err := p.prompts.render("pdf", p.prompt, promptData{Input: extractedText})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := p.complete(ctx, prompt, p.prompts.schema(p.prompt, false), "restaurant_pdf_menu")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PDF menu: %w", err)
+	}
+
+	var parsed struct {
+		Items []MenuItem `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse menu items from JSON: %w", err)
+	}
+
+	for i := range parsed.Items {
+		parsed.Items[i].Restaurant = restaurantName
+		parsed.Items[i].Link = pdfURL
+	}
+
+	return &WeeklyMenu{Type: "weekly", Menu: parsed.Items}, nil
+}
@@ -0,0 +1,192 @@
+package ai
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/chlab/lunch-wankdorf/pkg/replay"
+)
+
+// Prompts are the prompt templates, by version. Each version is a text/template
+// file of its own, v<N>.tmpl, defining a "day" template (ParseDayMenu) and a "pdf"
+// one (ParseRestaurantPdfMenu), so a change to the prompts is a new file and going
+// back is a line in restaurants.yaml (see Prompt). The data they are given
+// is promptData.
+//
+// A version may also define a "types" template, the dish types it asks for,
+// comma-separated, out of DishTypes. Its answers are then held to them by the
+// schema; a version without one leaves the type to the model, as it was before
+// there was one.
+type Prompts struct {
+	versions map[int]promptTemplates
+	latest   int
+}
+
+type promptTemplates struct {
+	template *template.Template
+	hash     string   // of the file, so answers to an edited one aren't taken for its own
+	types    []string // the dish types the version asks for, if it names them
+}
+
+// Prompt is how a restaurant's menus are put to the model, on top of the prompt
+// templates every restaurant shares. The zero value is the latest templates as
+// they are.
+type Prompt struct {
+	Version  int      `yaml:"version"`  // The templates' version, to stay on an older one; 0 for the latest
+	Language string   `yaml:"language"` // The language the menu is in, if not German
+	Hints    []string `yaml:"hints"`    // Added to the instructions, e.g. what the dishes usually are
+}
+
+// promptData is what the templates are executed with.
+type promptData struct {
+	Day      string
+	Language string
+	Hints    []string
+	Icons    []string
+	Types    []string
+	Feedback []string
+	Input    string
+}
+
+// The prompts that ship with the binary.
+//
+//go:embed prompts/*.tmpl
+var defaultPromptFiles embed.FS
+
+var defaultPrompts = sync.OnceValue(func() *Prompts {
+	prompts, err := loadPrompts(defaultPromptFiles, "prompts")
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in prompts: %v", err))
+	}
+	return prompts
+})
+
+// DefaultPrompts are the prompts that ship with the binary.
+func DefaultPrompts() *Prompts {
+	return defaultPrompts()
+}
+
+// LoadPrompts reads the prompt templates in dir, or the shipped ones if dir is
+// empty. A directory replaces the shipped prompts rather than adding to them, so
+// it needs every version a restaurant is on.
+func LoadPrompts(dir string) (*Prompts, error) {
+	if dir == "" {
+		return DefaultPrompts(), nil
+	}
+	prompts, err := loadPrompts(os.DirFS(dir), ".")
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompts in %s: %w", dir, err)
+	}
+	return prompts, nil
+}
+
+func loadPrompts(fsys fs.FS, root string) (*Prompts, error) {
+	files, err := fs.Glob(fsys, path.Join(root, "v*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	prompts := &Prompts{versions: make(map[int]promptTemplates, len(files))}
+	for _, file := range files {
+		name := path.Base(file)
+		version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "v"), ".tmpl"))
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("%s is not named after its version, e.g. v2.tmpl", name)
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the prompts: %w", err)
+		}
+		tmpl, err := template.New(name).Funcs(template.FuncMap{"join": strings.Join}).Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+		for _, prompt := range []string{"day", "pdf"} {
+			if tmpl.Lookup(prompt) == nil {
+				return nil, fmt.Errorf("%s has no %q template", name, prompt)
+			}
+		}
+		types, err := dishTypes(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		prompts.versions[version] = promptTemplates{template: tmpl, hash: replay.Hash(string(data)), types: types}
+		prompts.latest = max(prompts.latest, version)
+	}
+	if len(prompts.versions) == 0 {
+		return nil, fmt.Errorf("no prompts, want v1.tmpl and on")
+	}
+	return prompts, nil
+}
+
+// dishTypes reads the dish types a version's "types" template names, if it has one.
+func dishTypes(tmpl *template.Template) ([]string, error) {
+	if tmpl.Lookup("types") == nil {
+		return nil, nil
+	}
+	var b strings.Builder
+	if err := tmpl.ExecuteTemplate(&b, "types", nil); err != nil {
+		return nil, err
+	}
+	var types []string
+	for _, dishType := range strings.Split(b.String(), ",") {
+		dishType = strings.TrimSpace(dishType)
+		if !slices.Contains(DishTypes, dishType) {
+			return nil, fmt.Errorf("the dish type %q is not one the frontend knows, want %s", dishType, strings.Join(DishTypes, ", "))
+		}
+		types = append(types, dishType)
+	}
+	return types, nil
+}
+
+// Latest is the newest version, the one a restaurant that names none is on.
+func (p *Prompts) Latest() int {
+	return p.latest
+}
+
+// resolve checks a restaurant's prompt against the templates there are, and fills
+// in the version if it names none.
+func (p *Prompts) resolve(prompt Prompt) (Prompt, error) {
+	if prompt.Version == 0 {
+		prompt.Version = p.latest
+	}
+	if _, ok := p.versions[prompt.Version]; !ok {
+		return prompt, fmt.Errorf("there is no prompt version %d, the latest is %d", prompt.Version, p.latest)
+	}
+	return prompt, nil
+}
+
+// render executes one of the templates of prompt's version.
+func (p *Prompts) render(name string, prompt Prompt, data promptData) (string, error) {
+	data.Language, data.Hints, data.Icons, data.Types = prompt.Language, prompt.Hints, IconsList, p.versions[prompt.Version].types
+	var b strings.Builder
+	if err := p.versions[prompt.Version].template.ExecuteTemplate(&b, name, data); err != nil {
+		return "", fmt.Errorf("failed to write the prompt: %w", err)
+	}
+	return b.String(), nil
+}
+
+// schema is what the answers to prompt's templates are held to.
+func (p *Prompts) schema(prompt Prompt, includeLink bool) json.RawMessage {
+	return itemsSchema(includeLink, p.versions[prompt.Version].types)
+}
+
+// key identifies prompt's templates as they are, with what the restaurant adds,
+// and the schemas the answers are held to: the icons and types to choose from are
+// in the code, not in the templates.
+func (p *Prompts) key(prompt Prompt) string {
+	parts := []string{
+		strconv.Itoa(prompt.Version), p.versions[prompt.Version].hash,
+		string(p.schema(prompt, true)), string(p.schema(prompt, false)),
+		prompt.Language,
+	}
+	return replay.Hash(append(parts, prompt.Hints...)...)
+}
@@ -0,0 +1,197 @@
+package ai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// promptedProvider keeps the prompts it is sent and the schemas they come with,
+// and answers them with a day.
+type promptedProvider struct {
+	prompts []string
+	schemas []string
+}
+
+func (p *promptedProvider) Model() string { return "gpt-test" }
+
+func (p *promptedProvider) Complete(_ context.Context, req CompletionRequest) (*Completion, error) {
+	p.prompts = append(p.prompts, req.Prompt)
+	p.schemas = append(p.schemas, string(req.Schema))
+	return &Completion{Content: parsedDay}, nil
+}
+
+// Version 1 is what the prompts were before they were templates, to the byte:
+// going back to it asks what was asked then, and the answers recorded for it
+// still replay.
+func TestPromptVersion1IsThePromptsAsTheyWere(t *testing.T) {
+	icons := strings.Join(IconsList, ", ")
+	dayPrompt := `Parse the following HTML extracted from a restaurant's menu page. The text is in German.
+It contains the dishes for a single day (friday). Return every dish on offer that day.
+A category with no dish (its content is just ".") is closed — skip it, do not invent a dish for it.
+Ignore prices, allergen information and climate labels.
+For each menu item provide:
+- name: dish name
+- description: dish description (remove double commas and other formatting noise but keep the content)
+- type: dish type (vegetarian, meat, etc.)
+- icon: the icon that best fits the dish — use the name first, description second
+- link: link to the dish on the restaurant's website, or an empty string if none
+- category: the heading the dish is listed under ("Pizza Del Giorno", "Chefs Choice"),
+  copied verbatim. We match the restaurant's dish photos on it, so do not translate,
+  reword or tidy it up. Use an empty string if the dish has no heading.
+Icon hints (the parenthetical is a hint, not part of the icon name): ` + icons + `
+`
+	want := []string{
+		dayPrompt + "\nHTML:\n<div>Pizza</div>",
+		dayPrompt + "\nYour previous answer for this day was wrong. Fix these problems:\n- no pizza\n- no pasta\n\nHTML:\n<div>Pizza</div>",
+		`Parse the following extracted text from a restaurant's menu PDF.
+For each menu item provide:
+- name: dish name
+- description: dish description
+- type: dish type (vegetarian, meat, etc.)
+- icon: the icon that best fits the dish — use the name first, description second
+Icon hints (the parenthetical is a hint, not part of the icon name): ` + icons + `
+Only include food, ignore drinks. If not specified otherwise, assume Turbolama are vegan bowls.
+
+Extracted PDF content:
+BOWLS`,
+	}
+
+	provider := &promptedProvider{}
+	parser, err := NewParser(provider, nil).ForRestaurant(Prompt{Version: 1})
+	if err != nil {
+		t.Fatalf("ForRestaurant() error = %v", err)
+	}
+	ctx := context.Background()
+	parser.ParseDayMenu(ctx, "friday", "<div>Pizza</div>")
+	parser.ParseDayMenu(ctx, "friday", "<div>Pizza</div>", "no pizza", "no pasta")
+	parser.ParseRestaurantPdfMenu(ctx, "BOWLS", "Turbolama", "")
+
+	for i := range want {
+		if i >= len(provider.prompts) || provider.prompts[i] != want[i] {
+			t.Errorf("prompt %d differs from version 1:\ngot:  %q\nwant: %q", i, provider.prompts, want[i])
+		}
+	}
+
+	// Version 2 only differs for a restaurant that adds something, or a PDF
+	provider.prompts = nil
+	version2, err := NewParser(provider, nil).ForRestaurant(Prompt{Version: 2})
+	if err != nil {
+		t.Fatalf("ForRestaurant() error = %v", err)
+	}
+	version2.ParseDayMenu(ctx, "friday", "<div>Pizza</div>", "no pizza", "no pasta")
+	if provider.prompts[0] != want[1] {
+		t.Errorf("version 2's day prompt differs from version 1's:\n%s", provider.prompts[0])
+	}
+}
+
+// From version 3 on, a dish's type is one the frontend knows, and the schema holds
+// the model to it. The versions before leave it to the model, as they did.
+func TestPromptVersion3NamesTheDishTypes(t *testing.T) {
+	const enum = `"enum":["vegan","vegetarian","meat"]`
+	ctx := context.Background()
+	for _, version := range []int{1, 2, 3} {
+		provider := &promptedProvider{}
+		parser, err := NewParser(provider, nil).ForRestaurant(Prompt{Version: version})
+		if err != nil {
+			t.Fatalf("ForRestaurant() error = %v", err)
+		}
+		parser.ParseDayMenu(ctx, "friday", "<div>Pizza</div>")
+		parser.ParseRestaurantPdfMenu(ctx, "BOWLS", "Turbolama", "")
+		for i, prompt := range provider.prompts {
+			named := strings.Contains(prompt, "- type: dish type, one of vegan, vegetarian, meat; fish and seafood are meat\n")
+			held := strings.Contains(provider.schemas[i], enum)
+			if want := version >= 3; named != want || held != want {
+				t.Errorf("version %d, prompt %d names the types: %v, schema holds to them: %v, want %v", version, i, named, held, want)
+			}
+		}
+	}
+}
+
+func TestParserForRestaurant(t *testing.T) {
+	provider := &promptedProvider{}
+	parser := NewParser(provider, nil)
+	prompt := Prompt{
+		Language: "French",
+		Hints:    []string{"The menu du jour is always meat."},
+	}
+	espace, err := parser.ForRestaurant(prompt)
+	if err != nil {
+		t.Fatalf("ForRestaurant() error = %v", err)
+	}
+	if espace.PromptVersion() != DefaultPrompts().Latest() || parser.PromptKey() == espace.PromptKey() {
+		t.Errorf("prompt version %d, key %s, want the latest and a key of its own", espace.PromptVersion(), espace.PromptKey())
+	}
+
+	ctx := context.Background()
+	espace.ParseDayMenu(ctx, "friday", "<div>Menu du jour</div>")
+	espace.ParseRestaurantPdfMenu(ctx, "Menu du jour", "Espace", "")
+	parser.ParseDayMenu(ctx, "friday", "<div>Pizza</div>")
+	for i, prompt := range provider.prompts[:2] {
+		if !strings.Contains(prompt, "The text is in French.") || !strings.Contains(prompt, "\nThe menu du jour is always meat.\n") {
+			t.Errorf("prompt %d has neither the restaurant's language nor its hint:\n%s", i, prompt)
+		}
+	}
+	// The parser it came from is left as it was
+	if prompt := provider.prompts[2]; !strings.Contains(prompt, "The text is in German.") || strings.Contains(prompt, "menu du jour") {
+		t.Errorf("the shared parser's prompt has the restaurant's additions:\n%s", prompt)
+	}
+
+	prompt.Version = 99
+	if _, err := parser.ForRestaurant(prompt); err == nil {
+		t.Error("ForRestaurant(a version there is no template for) succeeded, want an error")
+	}
+}
+
+// An answer to the same prompt under another schema, e.g. with an icon more to
+// choose from, is not taken for one under this one.
+func TestPromptKeyHasTheSchema(t *testing.T) {
+	parser := NewParser(&promptedProvider{}, nil)
+	before := parser.PromptKey()
+
+	icons := IconsList
+	IconsList = append(slices.Clip(icons), "dumpling")
+	defer func() { IconsList = icons }()
+	if parser.PromptKey() == before {
+		t.Error("the prompt key is the same with another icon in the schema")
+	}
+}
+
+func TestLoadPrompts(t *testing.T) {
+	write := func(files map[string]string) string {
+		dir := t.TempDir()
+		for name, content := range files {
+			os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		}
+		return dir
+	}
+	both := `{{define "day"}}Day {{.Day}}: {{.Input}}{{end}}{{define "pdf"}}PDF: {{.Input}}{{end}}`
+
+	prompts, err := LoadPrompts(write(map[string]string{"v1.tmpl": both, "v3.tmpl": both}))
+	if err != nil {
+		t.Fatalf("LoadPrompts() error = %v", err)
+	}
+	if prompts.Latest() != 3 {
+		t.Errorf("Latest() = %d, want 3", prompts.Latest())
+	}
+	provider := &promptedProvider{}
+	NewParser(provider, nil).WithPrompts(prompts).ParseDayMenu(context.Background(), "friday", "Pizza")
+	if len(provider.prompts) != 1 || provider.prompts[0] != "Day friday: Pizza" {
+		t.Errorf("prompts = %q, want the directory's", provider.prompts)
+	}
+
+	for name, files := range map[string]map[string]string{
+		"no prompts":           {"notes.txt": "x"},
+		"a file not named v1":  {"vnext.tmpl": both},
+		"no PDF template":      {"v1.tmpl": `{{define "day"}}{{end}}`},
+		"a broken template":    {"v1.tmpl": `{{define "day"}}{{.Day}{{end}}`},
+		"an unknown dish type": {"v1.tmpl": both + `{{define "types"}}vegan, fish{{end}}`},
+	} {
+		if _, err := LoadPrompts(write(files)); err == nil {
+			t.Errorf("LoadPrompts(%s) succeeded, want an error", name)
+		}
+	}
+}
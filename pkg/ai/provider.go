@@ -0,0 +1,135 @@
+package ai
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chlab/lunch-wankdorf/pkg/replay"
+)
+
+// CompletionProvider runs a prompt against a model and returns its answer, which
+// must be JSON following the request's schema. Each backend enforces the schema
+// its own way (structured outputs, a forced tool call), but the contract with the
+// parser is the same.
+type CompletionProvider interface {
+	Complete(ctx context.Context, req CompletionRequest) (*Completion, error)
+	// Model is the model the provider runs, as it is recorded with the menu.
+	Model() string
+}
+
+// CompletionRequest is a single prompt and the JSON schema the answer must follow.
+type CompletionRequest struct {
+	Prompt     string
+	Schema     json.RawMessage
+	SchemaName string
+}
+
+// Completion is a provider's answer.
+type Completion struct {
+	Content string // JSON following the request's schema
+	Usage   Usage
+}
+
+// The backends AI_PROVIDER selects.
+const (
+	ProviderOpenAI    = "openai"    // api.openai.com, or any OpenAI-compatible server via OPENAI_BASE_URL
+	ProviderAzure     = "azure"     // Azure OpenAI
+	ProviderAnthropic = "anthropic" // the Anthropic Messages API
+)
+
+// ProviderFromEnv builds the provider AI_PROVIDER asks for, openai by default.
+//
+//	openai     OPENAI_API_KEY, OPENAI_MODEL, and OPENAI_BASE_URL for an OpenAI-compatible
+//	           server (Ollama, llama.cpp, vLLM), where the key is optional
+//	azure      AZURE_OPENAI_ENDPOINT, AZURE_OPENAI_API_KEY, AZURE_OPENAI_DEPLOYMENT
+//	           (defaults to OPENAI_MODEL), AZURE_OPENAI_API_VERSION
+//	anthropic  ANTHROPIC_API_KEY, ANTHROPIC_MODEL, ANTHROPIC_BASE_URL
+func ProviderFromEnv() (CompletionProvider, error) {
+	return ProviderForModel("")
+}
+
+// ProviderForModel is ProviderFromEnv running model rather than the one the
+// environment names: the deployment on Azure. An empty model is the environment's.
+func ProviderForModel(model string) (CompletionProvider, error) {
+	switch provider := strings.ToLower(os.Getenv("AI_PROVIDER")); provider {
+	case "", ProviderOpenAI:
+		return newOpenAIProvider(
+			os.Getenv("OPENAI_API_KEY"), os.Getenv("OPENAI_BASE_URL"), cmp.Or(model, Model()))
+	case ProviderAzure:
+		return newAzureProvider(
+			os.Getenv("AZURE_OPENAI_API_KEY"), os.Getenv("AZURE_OPENAI_ENDPOINT"),
+			cmp.Or(model, os.Getenv("AZURE_OPENAI_DEPLOYMENT")), os.Getenv("AZURE_OPENAI_API_VERSION"), Model())
+	case ProviderAnthropic:
+		return newAnthropicProvider(
+			os.Getenv("ANTHROPIC_API_KEY"), os.Getenv("ANTHROPIC_BASE_URL"), cmp.Or(model, os.Getenv("ANTHROPIC_MODEL")))
+	default:
+		return nil, fmt.Errorf("unknown AI_PROVIDER %q, want %s, %s or %s",
+			provider, ProviderOpenAI, ProviderAzure, ProviderAnthropic)
+	}
+}
+
+// tapedCompletion is a recorded model answer. The prompt is kept alongside it so a
+// recording can be read without re-running anything.
+type tapedCompletion struct {
+	Model      string `json:"model"`
+	SchemaName string `json:"schemaName"`
+	Prompt     string `json:"prompt"`
+	Content    string `json:"content"`
+	Usage      Usage  `json:"usage,omitzero"`
+}
+
+// TapedProvider records provider's answers to tape, or replays them from there,
+// keyed by the prompt. A replay never calls provider, which may then be nil: the
+// answers come from the tape, and a prompt it has no answer for is an error
+// rather than a call to a live model.
+func TapedProvider(provider CompletionProvider, tape *replay.Tape) CompletionProvider {
+	if tape == nil {
+		return provider
+	}
+	return &tapedProvider{provider: provider, tape: tape}
+}
+
+type tapedProvider struct {
+	provider CompletionProvider
+	tape     *replay.Tape
+}
+
+func (p *tapedProvider) Model() string {
+	if p.provider == nil {
+		return "replay"
+	}
+	return p.provider.Model()
+}
+
+func (p *tapedProvider) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	const kind = "completion"
+	key := p.tape.Next(kind, replay.Hash(req.SchemaName, req.Prompt))
+
+	if p.tape.Replaying() {
+		var recorded tapedCompletion
+		if err := p.tape.Load(kind, key, &recorded); err != nil {
+			return nil, fmt.Errorf("the prompt has changed since it was recorded, or was never sent: %w", err)
+		}
+		return &Completion{Content: recorded.Content, Usage: recorded.Usage}, nil
+	}
+
+	completion, err := p.provider.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	err = p.tape.Save(kind, key, tapedCompletion{
+		Model:      p.provider.Model(),
+		SchemaName: req.SchemaName,
+		Prompt:     req.Prompt,
+		Content:    completion.Content,
+		Usage:      completion.Usage,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return completion, nil
+}
@@ -0,0 +1,191 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chlab/lunch-wankdorf/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const parsedDay = `{"items":[{"name":"Pizza Siciliana","description":"Kapern, Oliven","type":"vegetarian",` +
+	`"icon":"pizza","link":"/menu/pizza/2026-07-17","category":"Pizza Del Giorno"}]}`
+
+// A stand-in for an OpenAI-compatible server (Ollama, llama.cpp, vLLM), which is
+// all the pipeline needs to run offline.
+func TestParseDayMenuAgainstAnOpenAICompatibleServer(t *testing.T) {
+	var request struct {
+		Model          string `json:"model"`
+		ResponseFormat struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Name   string          `json:"name"`
+				Strict bool            `json:"strict"`
+				Schema json.RawMessage `json:"schema"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("request to %s, want /v1/chat/completions", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{
+				{"message": map[string]any{"role": "assistant", "content": parsedDay}},
+			},
+			"usage": map[string]any{"prompt_tokens": 812, "completion_tokens": 64, "total_tokens": 876,
+				"completion_tokens_details": map[string]any{"reasoning_tokens": 24}},
+		})
+	}))
+	defer server.Close()
+
+	// A local server doesn't need a key
+	provider, err := newOpenAIProvider("", server.URL+"/v1", "llama3.1")
+	if err != nil {
+		t.Fatalf("newOpenAIProvider() error = %v", err)
+	}
+
+	items, err := NewParser(provider, nil).ParseDayMenu(context.Background(), "friday", "<div>Pizza</div>")
+	if err != nil {
+		t.Fatalf("ParseDayMenu() error = %v", err)
+	}
+
+	if len(items) != 1 || items[0].Category != "Pizza Del Giorno" || items[0].Icon != "pizza" {
+		t.Errorf("items = %+v, want the one dish the server returned", items)
+	}
+
+	if request.Model != "llama3.1" {
+		t.Errorf("model = %q, want llama3.1", request.Model)
+	}
+	input, output := testutil.ToFloat64(metrics.ModelTokens.WithLabelValues("llama3.1", "input")), testutil.ToFloat64(metrics.ModelTokens.WithLabelValues("llama3.1", "output"))
+	if input != 812 || output != 64 {
+		t.Errorf("counted %v input and %v output tokens, want the server's 812 and 64", input, output)
+	}
+	if reasoning := testutil.ToFloat64(metrics.ModelTokens.WithLabelValues("llama3.1", "reasoning")); reasoning != 24 {
+		t.Errorf("counted %v reasoning tokens, want the server's 24", reasoning)
+	}
+	// The schema contract is the same whichever server answers
+	format := request.ResponseFormat
+	if format.Type != "json_schema" || format.JSONSchema.Name != "restaurant_day_menu" || !format.JSONSchema.Strict {
+		t.Errorf("response_format = %+v, want the strict restaurant_day_menu schema", format)
+	}
+	if string(format.JSONSchema.Schema) != string(DefaultPrompts().schema(Prompt{Version: DefaultPrompts().Latest()}, true)) {
+		t.Errorf("schema = %s, want %s", format.JSONSchema.Schema, DefaultPrompts().schema(Prompt{Version: DefaultPrompts().Latest()}, true))
+	}
+}
+
+func TestAnthropicProviderAnswersThroughTheSchemaTool(t *testing.T) {
+	var request anthropicRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("request to %s, want /v1/messages", r.URL.Path)
+		}
+		if r.Header.Get("X-Api-Key") != "test-key" {
+			t.Errorf("X-Api-Key = %q, want the configured key", r.Header.Get("X-Api-Key"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"content":[{"type":"tool_use","name":"restaurant_day_menu","input":`+parsedDay+`}],`+
+			`"stop_reason":"tool_use","usage":{"input_tokens":1024,"output_tokens":80}}`)
+	}))
+	defer server.Close()
+
+	provider, err := newAnthropicProvider("test-key", server.URL, "test-model")
+	if err != nil {
+		t.Fatalf("newAnthropicProvider() error = %v", err)
+	}
+
+	items, err := NewParser(provider, nil).ParseDayMenu(context.Background(), "friday", "<div>Pizza</div>")
+	if err != nil {
+		t.Fatalf("ParseDayMenu() error = %v", err)
+	}
+	if len(items) != 1 || items[0].Name != "Pizza Siciliana" {
+		t.Errorf("items = %+v, want the one dish the server returned", items)
+	}
+	if input := testutil.ToFloat64(metrics.ModelTokens.WithLabelValues("test-model", "input")); input != 1024 {
+		t.Errorf("counted %v input tokens, want the server's 1024", input)
+	}
+
+	// The model has to answer through the tool, or the answer has no schema
+	if request.ToolChoice.Name != "restaurant_day_menu" || len(request.Tools) != 1 {
+		t.Fatalf("tool_choice = %+v, tools = %d, want the schema tool forced", request.ToolChoice, len(request.Tools))
+	}
+	if string(request.Tools[0].InputSchema) != string(DefaultPrompts().schema(Prompt{Version: DefaultPrompts().Latest()}, true)) {
+		t.Errorf("input_schema = %s, want %s", request.Tools[0].InputSchema, DefaultPrompts().schema(Prompt{Version: DefaultPrompts().Latest()}, true))
+	}
+}
+
+func TestAnthropicProviderReportsAPIErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`)
+	}))
+	defer server.Close()
+
+	provider, err := newAnthropicProvider("test-key", server.URL, "test-model")
+	if err != nil {
+		t.Fatalf("newAnthropicProvider() error = %v", err)
+	}
+	if _, err := NewParser(provider, nil).ParseDayMenu(context.Background(), "friday", "<div>Pizza</div>"); err == nil {
+		t.Error("want the API's error to be returned")
+	}
+}
+
+func TestProviderFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantModel string
+		wantErr   bool
+	}{
+		{"openai without a key", map[string]string{}, "", true},
+		{"openai", map[string]string{"OPENAI_API_KEY": "key"}, DefaultModel, false},
+		{"local server without a key", map[string]string{
+			"OPENAI_BASE_URL": "http://localhost:11434/v1", "OPENAI_MODEL": "llama3.1",
+		}, "llama3.1", false},
+		{"azure", map[string]string{
+			"AI_PROVIDER": "azure", "AZURE_OPENAI_API_KEY": "key",
+			"AZURE_OPENAI_ENDPOINT": "https://lunch.openai.azure.com", "AZURE_OPENAI_DEPLOYMENT": "menus",
+		}, "menus", false},
+		{"anthropic without a model", map[string]string{
+			"AI_PROVIDER": "anthropic", "ANTHROPIC_API_KEY": "key",
+		}, "", true},
+		{"unknown provider", map[string]string{"AI_PROVIDER": "carrier-pigeon"}, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range []string{
+				"AI_PROVIDER", "OPENAI_API_KEY", "OPENAI_BASE_URL", "OPENAI_MODEL",
+				"AZURE_OPENAI_API_KEY", "AZURE_OPENAI_ENDPOINT", "AZURE_OPENAI_DEPLOYMENT",
+				"ANTHROPIC_API_KEY", "ANTHROPIC_MODEL", "ANTHROPIC_BASE_URL",
+			} {
+				t.Setenv(key, test.env[key])
+			}
+
+			provider, err := ProviderFromEnv()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ProviderFromEnv() error = %v, want error: %v", err, test.wantErr)
+			}
+			if err == nil && provider.Model() != test.wantModel {
+				t.Errorf("Model() = %q, want %q", provider.Model(), test.wantModel)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package ai
+
+import (
+	"strings"
+	"unicode"
+)
+
+// iconRules picks a dish's icon from the words in its name or description. The
+// first rule that matches wins, so the specific dishes (a pizza, a burger) come
+// before the ingredients that would match them too (chicken on a pizza), and the
+// catch-all meats come last.
+var iconRules = []struct {
+	icon     string
+	keywords []string
+}{
+	{"pizza", []string{"pizza", "flammkuchen"}},
+	{"hamburger", []string{"burger"}},
+	{"hot-dog", []string{"hot dog", "hotdog"}},
+	{"lasagna-sheets", []string{"lasagne", "lasagna"}},
+	{"dumplings", []string{"ravioli", "gnocchi", "tortellini", "dumpling", "gyoza", "dim sum", "maultasche"}},
+	{"sushi", []string{"sushi"}},
+	{"paella", []string{"paella"}},
+	{"curry", []string{"curry", "dal ", "dhal"}},
+	{"noodles", []string{"ramen", "udon", "pad thai", "mie ", "noodle", "glasnudel", "reisnudel"}},
+	{"miso-soup", []string{"miso", "pho ", "tom kha", "laksa"}},
+	{"porridge", []string{"mac and cheese", "mac n cheese", "älplermagronen"}},
+	{"spaghetti", []string{"pasta", "spaghetti", "penne", "tagliatelle", "linguine", "fusilli", "rigatoni", "orecchiette", "pappardelle", "nudeln", "spätzli"}},
+	{"taco", []string{"taco"}},
+	{"nachos", []string{"nachos"}},
+	{"wrap", []string{"wrap", "burrito", "quesadilla"}},
+	{"sandwich", []string{"sandwich", "panini", "toast", "ciabatta", "bagel"}},
+	{"korean-rice-cake", []string{"frühlingsrolle", "sommerrolle", "spring roll"}},
+	{"bento", []string{"bento"}},
+	{"french-fries", []string{"pommes", "frites", "fries"}},
+	{"sausage", []string{"wurst", "würst", "cervelat", "salsiccia", "chipolata"}},
+	{"fried-chicken", []string{"poulet", "chicken", "hähnchen", "huhn", "hühner", "pouletbrust"}},
+	{"rack-of-lamb", []string{"lamm", "lamb"}},
+	{"seafood", []string{"fisch", "lachs", "crevette", "garnele", "thon", "dorsch", "zander", "egli", "seafood", "shrimp"}},
+	{"steak", []string{"steak", "entrecôte", "grill", "bbq", "spare ribs", "spareribs"}},
+	{"steak-rare", []string{"rind", "kalb", "schwein", "geschnetzeltes", "braten", "schnitzel", "cordon bleu", "hackfleisch", "beef"}},
+	{"rice-bowl", []string{"risotto", "reis", "rice", "bowl"}},
+	{"salad", []string{"salat", "salad"}},
+}
+
+// meatKeywords tell a meat dish apart when the page gives it no diet label.
+var meatKeywords = []string{
+	"fleisch", "poulet", "chicken", "huhn", "rind", "beef", "kalb", "schwein", "speck", "schinken",
+	"lamm", "wurst", "salsiccia", "cervelat", "hackfleisch", "fisch", "lachs", "thon", "crevette",
+	"garnele", "dorsch", "zander", "egli", "seafood", "shrimp",
+}
+
+// Dish is a dish as the page lists it, before anything is made of it. Scrapers
+// that can tell a page's dishes apart list them as these (see scraper.DayMenu).
+type Dish struct {
+	Category    string   `json:"category"`
+	Description string   `json:"description"` // e.g. "PASTA SALSICCA, Tomatensauce"
+	Link        string   `json:"link"`
+	Labels      []string `json:"labels,omitempty"` // diet labels: vegan, vegetarian or meat
+}
+
+// ParseDishes turns the dishes a scraper listed one by one into menu items,
+// without a model: the name is the description's first comma-separated segment,
+// the type comes from the page's diet labels and the icon from a keyword table.
+//
+// It is only as good as the page is regular, which food2050's is. A dish without
+// a diet label is "meat" if its text names one, and has no type otherwise, rather
+// than be shown to vegetarians on a guess.
+func ParseDishes(dishes []Dish) []MenuItem {
+	items := make([]MenuItem, 0, len(dishes))
+	for _, dish := range dishes {
+		name, description, _ := strings.Cut(dish.Description, ",")
+		name = titleCase(strings.TrimSpace(name))
+		description = strings.TrimSpace(description)
+
+		dishType := dietType(dish.Labels)
+		if dishType == "" && containsAny(strings.ToLower(dish.Description), meatKeywords) {
+			dishType = TypeMeat
+		}
+
+		items = append(items, MenuItem{
+			Name:        name,
+			Description: description,
+			Type:        dishType,
+			Icon:        iconFor(name, description, dishType),
+			Link:        dish.Link,
+			Category:    dish.Category,
+		})
+	}
+	return items
+}
+
+// dietType is the type the labels agree on. A vegan dish is often also labelled
+// vegetarian, so the strictest label wins.
+func dietType(labels []string) string {
+	for _, want := range DishTypes {
+		for _, label := range labels {
+			if label == want {
+				return want
+			}
+		}
+	}
+	return ""
+}
+
+// iconFor matches the name first and the description second, as the prompt asks
+// the model to, and falls back to a generic icon for the dish's type.
+func iconFor(name, description, dishType string) string {
+	for _, text := range []string{name, description} {
+		// Padded, so that a keyword with a trailing space ("dal ") matches at the end too
+		text = strings.ToLower(text) + " "
+		for _, rule := range iconRules {
+			if containsAny(text, rule.keywords) {
+				return rule.icon
+			}
+		}
+	}
+
+	if dishType == TypeMeat {
+		return "steak-rare"
+	}
+	return "vegan-food"
+}
+
+func containsAny(text string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// titleCase turns the shouted names on food2050's pages ("PASTA SALSICCIA") into
+// "Pasta Salsiccia". A name that is not all capitals is left as written.
+func titleCase(name string) string {
+	if name != strings.ToUpper(name) {
+		return name
+	}
+
+	words := strings.Fields(strings.ToLower(name))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
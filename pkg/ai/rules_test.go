@@ -0,0 +1,48 @@
+package ai
+
+import "testing"
+
+func TestParseDishes(t *testing.T) {
+	tests := []struct {
+		name string
+		dish Dish
+		want MenuItem
+	}{
+		{
+			"name from the first segment",
+			Dish{Category: "Pizza Del Giorno", Description: "PIZZA SICILIANA, Kapern, Oliven", Link: "/pizza", Labels: []string{"vegetarian"}},
+			MenuItem{Name: "Pizza Siciliana", Description: "Kapern, Oliven", Type: "vegetarian", Icon: "pizza", Link: "/pizza", Category: "Pizza Del Giorno"},
+		},
+		{
+			"the strictest label wins",
+			Dish{Description: "Linsen Dal, Reis", Labels: []string{"vegetarian", "vegan"}},
+			MenuItem{Name: "Linsen Dal", Description: "Reis", Type: "vegan", Icon: "curry"},
+		},
+		{
+			// Salsiccia would be a sausage, but the name says what the dish is
+			"the dish before its ingredients",
+			Dish{Description: "PASTA SALSICCIA, Tomatensauce"},
+			MenuItem{Name: "Pasta Salsiccia", Description: "Tomatensauce", Type: "meat", Icon: "spaghetti"},
+		},
+		{
+			"the description when the name says nothing",
+			Dish{Description: "CHEFS FAVORIT, Pouletbrust, Gemüse", Labels: []string{"meat"}},
+			MenuItem{Name: "Chefs Favorit", Description: "Pouletbrust, Gemüse", Type: "meat", Icon: "fried-chicken"},
+		},
+		{
+			// Better no type than a vegetarian badge on a guess
+			"no label and no meat",
+			Dish{Description: "TAGESHIT"},
+			MenuItem{Name: "Tageshit", Type: "", Icon: "vegan-food"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items := ParseDishes([]Dish{test.dish})
+			if len(items) != 1 || items[0] != test.want {
+				t.Errorf("ParseDishes() = %+v, want %+v", items, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Usage is how many tokens a completion took, as the provider counted them.
+// ReasoningTokens are the part of OutputTokens the model spent thinking, for the
+// providers that say; they are billed as output.
+type Usage struct {
+	InputTokens     int `json:"inputTokens"`
+	OutputTokens    int `json:"outputTokens"`
+	ReasoningTokens int `json:"reasoningTokens,omitempty"`
+}
+
+// Spend adds up the completions of a day, a restaurant or a run: how many there
+// were, their tokens, and what they cost in US dollars. A model without a price
+// (see Prices) costs nothing here.
+type Spend struct {
+	Calls int `json:"calls"`
+	Usage
+	CostUSD float64 `json:"costUsd"`
+}
+
+// Add returns s with other added to it.
+func (s Spend) Add(other Spend) Spend {
+	s.Calls += other.Calls
+	s.InputTokens += other.InputTokens
+	s.OutputTokens += other.OutputTokens
+	s.ReasoningTokens += other.ReasoningTokens
+	s.CostUSD += other.CostUSD
+	return s
+}
+
+// MarshalJSON writes the cost rounded (see roundCost).
+func (s Spend) MarshalJSON() ([]byte, error) {
+	type spend Spend
+	s.CostUSD = roundCost(s.CostUSD)
+	return json.Marshal(spend(s))
+}
+
+// Attrs is the spend as a log record's attributes.
+func (s Spend) Attrs() []any {
+	return []any{"calls", s.Calls, "inputTokens", s.InputTokens, "outputTokens", s.OutputTokens,
+		"reasoningTokens", s.ReasoningTokens, "costUsd", roundCost(s.CostUSD)}
+}
+
+// roundCost keeps a cost to a hundredth of a cent, which is plenty for a log or a
+// report and spares them the float noise.
+func roundCost(usd float64) float64 {
+	return math.Round(usd*10000) / 10000
+}
+
+// Price is what a model charges, in US dollars per million tokens.
+type Price struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// Cost is what usage costs at price.
+func (p Price) Cost(usage Usage) float64 {
+	return (float64(usage.InputTokens)*p.Input + float64(usage.OutputTokens)*p.Output) / 1e6
+}
+
+// Prices are the models' prices, keyed by the model as Model() names it: the
+// model, or the deployment on Azure.
+type Prices map[string]Price
+
+// The prices that ship with the binary. A file passed with -pricesFile replaces
+// them entirely.
+//
+//go:embed prices.yaml
+var defaultPrices []byte
+
+// LoadPrices reads the prices from path, or the shipped ones if path is empty.
+func LoadPrices(path string) (Prices, error) {
+	data := defaultPrices
+	source := "the default prices"
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the prices file: %w", err)
+		}
+		source = path
+	}
+
+	var file struct {
+		Models Prices `yaml:"models"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid prices in %s: %w", source, err)
+	}
+	for model, price := range file.Models {
+		if price.Input < 0 || price.Output < 0 {
+			return nil, fmt.Errorf("invalid prices in %s: %s has a negative price", source, model)
+		}
+	}
+	return file.Models, nil
+}
+
+// ErrBudgetSpent is the error a completion fails with once the Meter's budget is
+// spent.
+var ErrBudgetSpent = errors.New("the model budget is spent")
+
+// Meter prices a parser's completions and holds them to a budget. One meter is
+// shared by everything a run parses, so the budget is the run's: once what it
+// spent reaches the budget, no more completions are sent. A nil Meter prices
+// nothing and has no budget.
+type Meter struct {
+	prices Prices
+	budget float64 // US dollars; 0 is no budget
+
+	mu       sync.Mutex
+	spent    Spend
+	unpriced []string // the models already warned about
+}
+
+// NewMeter returns a meter pricing completions at prices, with a budget in US
+// dollars, or none if it is 0. A budget needs the price of the model it holds.
+func NewMeter(prices Prices, budget float64) *Meter {
+	return &Meter{prices: prices, budget: budget}
+}
+
+// check returns ErrBudgetSpent once the budget is, and an error for a budget on a
+// model it can't price.
+func (m *Meter) check(model string) error {
+	if m == nil || m.budget <= 0 {
+		return nil
+	}
+	if _, ok := m.prices[model]; !ok {
+		return fmt.Errorf("there is no price for %s to hold it to the budget of $%.2f", model, m.budget)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.spent.CostUSD >= m.budget {
+		return fmt.Errorf("%w: $%.4f of $%.2f", ErrBudgetSpent, m.spent.CostUSD, m.budget)
+	}
+	return nil
+}
+
+// record prices a completion of model and adds it to what the meter spent.
+func (m *Meter) record(ctx context.Context, model string, usage Usage) Spend {
+	spend := Spend{Calls: 1, Usage: usage}
+	if m == nil {
+		return spend
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if price, ok := m.prices[model]; ok {
+		spend.CostUSD = price.Cost(usage)
+	} else if !slices.Contains(m.unpriced, model) {
+		m.unpriced = append(m.unpriced, model)
+		slog.WarnContext(ctx, "No price for the model, its completions are counted as free", "model", model)
+	}
+	m.spent = m.spent.Add(spend)
+	return spend
+}
+
+// Tally adds up the completions made with a context, and with the contexts made
+// from it (see WithTally).
+type Tally struct {
+	mu    sync.Mutex
+	spend Spend
+}
+
+func (t *Tally) add(spend Spend) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spend = t.spend.Add(spend)
+}
+
+// Spend is what the tally added up so far.
+func (t *Tally) Spend() Spend {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spend
+}
+
+type talliesKey struct{}
+
+// WithTally returns a copy of ctx whose completions are added to a new tally, as
+// well as to the ones ctx already had: a day's tally and its restaurant's both
+// count the day's completions.
+func WithTally(ctx context.Context) (context.Context, *Tally) {
+	tally := &Tally{}
+	tallies := slices.Clip(talliesFrom(ctx))
+	return context.WithValue(ctx, talliesKey{}, append(tallies, tally)), tally
+}
+
+func talliesFrom(ctx context.Context) []*Tally {
+	tallies, _ := ctx.Value(talliesKey{}).([]*Tally)
+	return tallies
+}
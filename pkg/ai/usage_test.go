@@ -0,0 +1,95 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// meteredProvider answers every prompt with the same day, at the same usage.
+type meteredProvider struct {
+	model string
+	usage Usage
+	calls int
+}
+
+func (p *meteredProvider) Model() string { return p.model }
+
+func (p *meteredProvider) Complete(context.Context, CompletionRequest) (*Completion, error) {
+	p.calls++
+	return &Completion{Content: parsedDay, Usage: p.usage}, nil
+}
+
+func TestMeterHoldsTheRunToItsBudget(t *testing.T) {
+	// $0.012 a call, of which two fit into the budget of $0.02: the second call
+	// is still sent, as the first one left budget, and the third is not
+	provider := &meteredProvider{model: "gpt-test", usage: Usage{InputTokens: 4000, OutputTokens: 1000, ReasoningTokens: 600}}
+	parser := NewParser(provider, NewMeter(Prices{"gpt-test": {Input: 1, Output: 8}}, 0.02))
+
+	ctx, run := WithTally(context.Background())
+	dayCtx, day := WithTally(ctx)
+	for range 2 {
+		if _, err := parser.ParseDayMenu(dayCtx, "friday", "<div>Pizza</div>"); err != nil {
+			t.Fatalf("ParseDayMenu() error = %v, want it within the budget", err)
+		}
+	}
+	if _, err := parser.ParseDayMenu(ctx, "friday", "<div>Pizza</div>"); !errors.Is(err, ErrBudgetSpent) {
+		t.Fatalf("ParseDayMenu() error = %v, want ErrBudgetSpent", err)
+	}
+	if provider.calls != 2 {
+		t.Errorf("the provider was called %d times, want 2", provider.calls)
+	}
+
+	want := Spend{Calls: 2, Usage: Usage{InputTokens: 8000, OutputTokens: 2000, ReasoningTokens: 1200}, CostUSD: 0.024}
+	for name, tally := range map[string]*Tally{"day": day, "run": run} {
+		got := tally.Spend()
+		got.CostUSD = roundCost(got.CostUSD)
+		if got != want {
+			t.Errorf("the %s's tally = %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestMeterNeedsAPriceForABudget(t *testing.T) {
+	provider := &meteredProvider{model: "unpriced"}
+
+	if _, err := NewParser(provider, NewMeter(Prices{}, 0)).ParseDayMenu(context.Background(), "friday", ""); err != nil {
+		t.Errorf("ParseDayMenu() without a budget error = %v, want the model counted as free", err)
+	}
+	if _, err := NewParser(provider, NewMeter(Prices{}, 1)).ParseDayMenu(context.Background(), "friday", ""); err == nil {
+		t.Error("ParseDayMenu() with a budget on a model without a price succeeded, want an error")
+	}
+}
+
+func TestLoadPrices(t *testing.T) {
+	prices, err := LoadPrices("")
+	if err != nil {
+		t.Fatalf("LoadPrices(the default) error = %v", err)
+	}
+	if _, ok := prices[DefaultModel]; !ok {
+		t.Errorf("the default prices have none for the default model, %s", DefaultModel)
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "prices.yaml")
+	os.WriteFile(file, []byte("models:\n  my-deployment: { input: 0.5, output: 2 }\n"), 0o644)
+	prices, err = LoadPrices(file)
+	if err != nil {
+		t.Fatalf("LoadPrices(%s) error = %v", file, err)
+	}
+	if len(prices) != 1 || prices["my-deployment"] != (Price{Input: 0.5, Output: 2}) {
+		t.Errorf("LoadPrices(%s) = %+v, want the file's price only", file, prices)
+	}
+
+	for _, invalid := range []string{
+		"models:\n  gpt-test: { input: 1, ouput: 2 }\n",
+		"models:\n  gpt-test: { input: -1, output: 2 }\n",
+	} {
+		os.WriteFile(file, []byte(invalid), 0o644)
+		if _, err := LoadPrices(file); err == nil {
+			t.Errorf("LoadPrices(%q) succeeded, want an error", invalid)
+		}
+	}
+}
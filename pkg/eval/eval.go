@@ -0,0 +1,338 @@
+// Package eval scores the model's parses against hand-labelled golden menus, so a
+// change to the prompt shows up as a number rather than as a dish with the wrong
+// icon a week later.
+//
+// A golden menu is the input the model is given, a day's HTML as a scraper
+// captured it or a PDF's text, and the dishes a careful reader would make of it:
+// name, type, icon and category. The scorer pairs the model's dishes with them and
+// counts each field it got right, and which icons it mixed up with which. Every
+// format the restaurants come in has goldens of its own, as the prompt can get
+// better for one while it gets worse for another.
+package eval
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"gopkg.in/yaml.v3"
+)
+
+// The formats goldens come in, named after the scrapers that produce them.
+const (
+	FormatFood2050 = "food2050" // a day of a food2050 weekly page (Gira, Luna, Sole)
+	FormatSV       = "sv"       // a day of the SV Gastronomie app (Espace)
+	FormatPDF      = "pdf"      // the text of a week's menu PDF, parsed as a whole
+)
+
+// Golden is a hand-labelled menu.
+type Golden struct {
+	Name       string `yaml:"-"` // the file's, e.g. "gira-friday"
+	Format     string `yaml:"format"`
+	Restaurant string `yaml:"restaurant,omitempty"` // its ID, whose prompt (restaurants.yaml) it is parsed with
+	Day        string `yaml:"day,omitempty"`        // lowercase weekday, for the day formats
+	Input      string `yaml:"input"`
+	Dishes     []Dish `yaml:"dishes"`
+}
+
+// Dish is a golden dish: what the model should make of one on the page. Category
+// is empty for the PDF format, which has none.
+type Dish struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Icon     string `yaml:"icon"`
+	Category string `yaml:"category,omitempty"`
+}
+
+// The goldens that ship with the binary, one YAML file each.
+//
+//go:embed golden/*.yaml
+var defaultGoldens embed.FS
+
+// Load reads the goldens in dir, or the shipped ones if dir is empty, and checks
+// them before anything is sent to a model.
+func Load(dir string) ([]Golden, error) {
+	fsys, root := fs.FS(defaultGoldens), "golden"
+	if dir != "" {
+		fsys, root = os.DirFS(dir), "."
+	}
+	files, err := fs.Glob(fsys, path.Join(root, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no goldens in %s", dir)
+	}
+
+	icons := iconNames()
+	goldens := make([]Golden, 0, len(files))
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the golden: %w", err)
+		}
+		golden := Golden{Name: strings.TrimSuffix(path.Base(file), ".yaml")}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&golden); err != nil {
+			return nil, fmt.Errorf("invalid golden %s: %w", golden.Name, err)
+		}
+		if err := golden.check(icons); err != nil {
+			return nil, fmt.Errorf("invalid golden %s: %w", golden.Name, err)
+		}
+		goldens = append(goldens, golden)
+	}
+	return goldens, nil
+}
+
+func (g Golden) check(icons []string) error {
+	switch g.Format {
+	case FormatFood2050, FormatSV:
+		if g.Day == "" {
+			return fmt.Errorf("a %s golden needs its day", g.Format)
+		}
+	case FormatPDF:
+	default:
+		return fmt.Errorf("unknown format %q, want %s, %s or %s", g.Format, FormatFood2050, FormatSV, FormatPDF)
+	}
+	if strings.TrimSpace(g.Input) == "" || len(g.Dishes) == 0 {
+		return fmt.Errorf("it needs an input and the dishes in it")
+	}
+	for _, dish := range g.Dishes {
+		if !slices.Contains(icons, dish.Icon) {
+			return fmt.Errorf("%s has the icon %q, which the model can't choose", dish.Name, dish.Icon)
+		}
+		if !slices.Contains(ai.DishTypes, dishType(dish.Type)) {
+			return fmt.Errorf("%s has the type %q, want one of %s", dish.Name, dish.Type, strings.Join(ai.DishTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// iconNames are the icons the model chooses from, without the hints.
+func iconNames() []string {
+	names := make([]string, len(ai.IconsList))
+	for i, icon := range ai.IconsList {
+		names[i], _, _ = strings.Cut(icon, " (")
+	}
+	return names
+}
+
+// parser is the parser for the golden's restaurant, if it names one.
+func (g Golden) parser(parser *ai.Parser, prompts map[string]ai.Prompt) (*ai.Parser, error) {
+	if g.Restaurant == "" {
+		return parser, nil
+	}
+	prompt, ok := prompts[g.Restaurant]
+	if !ok {
+		return nil, fmt.Errorf("there is no restaurant %q", g.Restaurant)
+	}
+	return parser.ForRestaurant(prompt)
+}
+
+// parse sends the golden's input to the model the way a run would.
+func (g Golden) parse(ctx context.Context, parser *ai.Parser) ([]ai.MenuItem, error) {
+	if g.Format == FormatPDF {
+		menu, err := parser.ParseRestaurantPdfMenu(ctx, g.Input, g.Name, "")
+		if err != nil {
+			return nil, err
+		}
+		return menu.Menu, nil
+	}
+	return parser.ParseDayMenu(ctx, g.Day, g.Input)
+}
+
+// The fields a dish is scored on.
+const (
+	FieldName     = "name"
+	FieldType     = "type"
+	FieldIcon     = "icon"
+	FieldCategory = "category"
+)
+
+var fields = []string{FieldName, FieldType, FieldIcon, FieldCategory}
+
+// missing is what the icon confusion calls a dish the model didn't return.
+const missing = "(missing)"
+
+// Tally is how many of a field's values were right.
+type Tally struct {
+	Correct int `json:"correct"`
+	Total   int `json:"total"`
+}
+
+// Accuracy is the share that was right, 0 to 1.
+func (t Tally) Accuracy() float64 {
+	if t.Total == 0 {
+		return 0
+	}
+	return float64(t.Correct) / float64(t.Total)
+}
+
+// Score is how a parse compares to its golden, or to several. A golden dish the
+// model didn't return counts as wrong in every field; a dish it made up counts as
+// Extra.
+type Score struct {
+	Dishes int              `json:"dishes"` // golden dishes
+	Found  int              `json:"found"`  // the ones the model returned
+	Extra  int              `json:"extra"`  // dishes the model returned that aren't on the page
+	Fields map[string]Tally `json:"fields"`
+
+	// IconConfusion counts the icons the model chose, by the icon it should have:
+	// IconConfusion["pizza"]["sandwich"] is the pizzas it gave a sandwich.
+	IconConfusion map[string]map[string]int `json:"iconConfusion"`
+}
+
+func newScore() Score {
+	return Score{Fields: make(map[string]Tally, len(fields)), IconConfusion: make(map[string]map[string]int)}
+}
+
+func (s *Score) count(field string, correct bool) {
+	tally := s.Fields[field]
+	tally.Total++
+	if correct {
+		tally.Correct++
+	}
+	s.Fields[field] = tally
+}
+
+func (s *Score) confuse(want, got string) {
+	if s.IconConfusion[want] == nil {
+		s.IconConfusion[want] = make(map[string]int)
+	}
+	s.IconConfusion[want][got]++
+}
+
+// add adds other's counts to s.
+func (s *Score) add(other Score) {
+	s.Dishes += other.Dishes
+	s.Found += other.Found
+	s.Extra += other.Extra
+	for field, tally := range other.Fields {
+		sum := s.Fields[field]
+		sum.Correct += tally.Correct
+		sum.Total += tally.Total
+		s.Fields[field] = sum
+	}
+	for want, got := range other.IconConfusion {
+		if s.IconConfusion[want] == nil {
+			s.IconConfusion[want] = make(map[string]int)
+		}
+		for icon, n := range got {
+			s.IconConfusion[want][icon] += n
+		}
+	}
+}
+
+// ScoreParse compares the model's dishes to the golden ones.
+func ScoreParse(golden Golden, items []ai.MenuItem) Score {
+	score := newScore()
+	score.Dishes = len(golden.Dishes)
+
+	pairs := pairDishes(golden.Dishes, items)
+	for i, want := range golden.Dishes {
+		j, ok := pairs[i]
+		if !ok {
+			for _, field := range fields {
+				if field != FieldCategory || golden.Format != FormatPDF {
+					score.count(field, false)
+				}
+			}
+			score.confuse(want.Icon, missing)
+			continue
+		}
+
+		got := items[j]
+		score.Found++
+		score.count(FieldName, normalize(got.Name) == normalize(want.Name))
+		score.count(FieldType, dishType(got.Type) == dishType(want.Type))
+		score.count(FieldIcon, got.Icon == want.Icon)
+		if golden.Format != FormatPDF {
+			// Copied verbatim, as the photos are matched on it: only the spacing may differ
+			score.count(FieldCategory, strings.Join(strings.Fields(got.Category), " ") == want.Category)
+		}
+		score.confuse(want.Icon, got.Icon)
+	}
+	score.Extra = len(items) - len(pairs)
+	return score
+}
+
+// pairDishes pairs each golden dish with the model's dish most like it, most
+// alike first, and leaves the ones nothing is like alone. It returns the index of
+// the model's dish by the golden one's.
+func pairDishes(golden []Dish, items []ai.MenuItem) map[int]int {
+	type candidate struct {
+		want, got  int
+		similarity float64
+	}
+	var candidates []candidate
+	for i, want := range golden {
+		for j, got := range items {
+			similarity := nameSimilarity(want.Name, got.Name)
+			if want.Category != "" && strings.EqualFold(strings.Join(strings.Fields(got.Category), " "), want.Category) {
+				similarity += 0.5 // two dishes under one heading are told apart by their names
+			}
+			if similarity >= 0.5 {
+				candidates = append(candidates, candidate{i, j, similarity})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].similarity > candidates[b].similarity
+	})
+
+	pairs := make(map[int]int)
+	taken := make(map[int]bool)
+	for _, c := range candidates {
+		if _, paired := pairs[c.want]; paired || taken[c.got] {
+			continue
+		}
+		pairs[c.want] = c.got
+		taken[c.got] = true
+	}
+	return pairs
+}
+
+// nameSimilarity is the share of the two names' words they have in common.
+func nameSimilarity(a, b string) float64 {
+	wordsA, wordsB := strings.Fields(normalize(a)), strings.Fields(normalize(b))
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+	var common int
+	for _, word := range wordsA {
+		if slices.Contains(wordsB, word) {
+			common++
+		}
+	}
+	return float64(common) / float64(max(len(wordsA), len(wordsB)))
+}
+
+// legacyTypes are the types the goldens were labelled with, and the model
+// answered with, before a dish's type was one of ai.DishTypes, by the one they are
+// now. The labels are left as they were, so that scores from before still compare.
+var legacyTypes = map[string]string{
+	"fish":    ai.TypeMeat,
+	"seafood": ai.TypeMeat,
+}
+
+// dishType is a golden's or the model's type as it is compared.
+func dishType(s string) string {
+	s = normalize(s)
+	if current, ok := legacyTypes[s]; ok {
+		return current
+	}
+	return s
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
@@ -0,0 +1,120 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+)
+
+func TestLoadTheShippedGoldens(t *testing.T) {
+	goldens, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	formats := make(map[string]bool)
+	for _, golden := range goldens {
+		formats[golden.Format] = true
+	}
+	for _, format := range []string{FormatFood2050, FormatSV, FormatPDF} {
+		if !formats[format] {
+			t.Errorf("no golden for the %s format", format)
+		}
+	}
+}
+
+func TestLoadChecksTheGoldens(t *testing.T) {
+	for name, golden := range map[string]string{
+		"an icon the model can't choose":   "format: pdf\ninput: x\ndishes:\n  - { name: Toast, type: vegetarian, icon: toast }\n",
+		"no day":                           "format: sv\ninput: x\ndishes:\n  - { name: Toast, type: vegetarian, icon: sandwich }\n",
+		"a misspelled field":               "format: pdf\ninput: x\ndishes:\n  - { name: Toast, tpye: vegetarian, icon: sandwich }\n",
+		"a type the frontend doesn't know": "format: pdf\ninput: x\ndishes:\n  - { name: Tiramisu, type: dessert, icon: porridge }\n",
+	} {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "golden.yaml"), []byte(golden), 0o644)
+		if _, err := Load(dir); err == nil {
+			t.Errorf("Load(a golden with %s) succeeded, want an error", name)
+		}
+	}
+}
+
+var friday = Golden{
+	Name:   "gira-friday",
+	Format: FormatFood2050,
+	Day:    "friday",
+	Dishes: []Dish{
+		{Name: "Pasta Pesto", Type: "vegetarian", Icon: "spaghetti", Category: "Pasta Del Giorno"},
+		{Name: "Pizza Siciliana", Type: "fish", Icon: "pizza", Category: "Pizza Del Giorno"},
+		{Name: "Poulet Tikka Masala", Type: "meat", Icon: "curry", Category: "Chefs Choice"},
+	},
+}
+
+func TestScoreParse(t *testing.T) {
+	items := []ai.MenuItem{
+		// Right, but for the case and the spacing, which don't count
+		{Name: "pasta pesto", Type: "Vegetarian", Icon: "spaghetti", Category: "Pasta  Del Giorno"},
+		// The name shortened and the wrong icon and type
+		{Name: "Poulet Tikka", Type: "vegetarian", Icon: "fried-chicken", Category: "Chefs Choice"},
+		// Not on the page
+		{Name: "Tiramisu", Type: "vegetarian", Icon: "porridge", Category: "Dessert"},
+	}
+
+	score := ScoreParse(friday, items)
+	if score.Dishes != 3 || score.Found != 2 || score.Extra != 1 {
+		t.Errorf("found %d of %d dishes and %d extra, want 2 of 3 and the tiramisu", score.Found, score.Dishes, score.Extra)
+	}
+	want := map[string]Tally{
+		FieldName:     {Correct: 1, Total: 3},
+		FieldType:     {Correct: 1, Total: 3},
+		FieldIcon:     {Correct: 1, Total: 3},
+		FieldCategory: {Correct: 2, Total: 3},
+	}
+	for field, tally := range want {
+		if score.Fields[field] != tally {
+			t.Errorf("%s = %+v, want %+v", field, score.Fields[field], tally)
+		}
+	}
+	if score.IconConfusion["curry"]["fried-chicken"] != 1 || score.IconConfusion["pizza"][missing] != 1 || score.IconConfusion["spaghetti"]["spaghetti"] != 1 {
+		t.Errorf("IconConfusion = %v, want the curry as fried chicken and the pizza missing", score.IconConfusion)
+	}
+}
+
+func TestScoreParseTellsDishesUnderOneHeadingApart(t *testing.T) {
+	golden := Golden{Format: FormatSV, Day: "monday", Dishes: []Dish{
+		{Name: "Gemüse Curry", Type: "vegan", Icon: "curry", Category: "Menu"},
+		{Name: "Rindsgeschnetzeltes", Type: "meat", Icon: "steak", Category: "Menu"},
+	}}
+	items := []ai.MenuItem{
+		{Name: "Rindsgeschnetzeltes", Type: "meat", Icon: "steak", Category: "Menu"},
+		{Name: "Gemüse Curry", Type: "vegan", Icon: "curry", Category: "Menu"},
+	}
+	if score := ScoreParse(golden, items); score.Fields[FieldName].Correct != 2 || score.Fields[FieldIcon].Correct != 2 {
+		t.Errorf("score = %+v, want both dishes paired with their own", score)
+	}
+}
+
+// A golden labelled fish, from before fish was meat, is right with either.
+func TestScoreParseReadsLegacyTypes(t *testing.T) {
+	for _, answer := range []string{"meat", "fish"} {
+		items := []ai.MenuItem{{Name: "Pizza Siciliana", Type: answer, Icon: "pizza", Category: "Pizza Del Giorno"}}
+		if score := ScoreParse(friday, items); score.Fields[FieldType].Correct != 1 {
+			t.Errorf("a fish dish answered as %s: type %+v, want it right", answer, score.Fields[FieldType])
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	before, after := newScore(), newScore()
+	before.add(ScoreParse(friday, nil))
+	after.add(ScoreParse(friday, []ai.MenuItem{{Name: "Pasta Pesto", Type: "vegetarian", Icon: "spaghetti", Category: "Pasta Del Giorno"}}))
+
+	table := Compare(
+		Report{PromptVersion: 1, Model: "gpt-test", Total: before, Formats: map[string]Score{FormatFood2050: before}},
+		Report{PromptVersion: 2, Model: "gpt-test", Total: after, Formats: map[string]Score{FormatFood2050: after}},
+	)
+	if !strings.Contains(table, "| food2050 | icon | 0% | 33% | +33 |") || !strings.Contains(table, "| **all** | name | 0% | 33% | +33 |") {
+		t.Errorf("the comparison has no row for the change:\n%s", table)
+	}
+}
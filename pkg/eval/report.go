@@ -0,0 +1,179 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/logging"
+)
+
+// Result is how the model did on one golden.
+type Result struct {
+	Golden        string `json:"golden"`
+	Format        string `json:"format"`
+	PromptVersion int    `json:"promptVersion,omitempty"` // the restaurant's, if it isn't on the latest
+	Error         string `json:"error,omitempty"`         // the model didn't answer, and every dish is missing
+	Score         Score  `json:"score"`
+}
+
+// Report is an evaluation: the scores of every golden, added up by format and in
+// total. It is written out as JSON, so that the next prompt version's can be
+// compared to it (see Compare). PromptVersion is the version the goldens were
+// parsed with, but for those of a restaurant that stays on another.
+type Report struct {
+	PromptVersion int              `json:"promptVersion"`
+	Model         string           `json:"model"`
+	Evaluated     time.Time        `json:"evaluated"`
+	Total         Score            `json:"total"`
+	Formats       map[string]Score `json:"formats"`
+	Goldens       []Result         `json:"goldens"`
+}
+
+// Run parses every golden with parser, in parallel, and scores the answers. A
+// golden that names its restaurant is parsed with the restaurant's prompt, from
+// prompts by restaurant ID.
+func Run(ctx context.Context, parser *ai.Parser, goldens []Golden, prompts map[string]ai.Prompt) Report {
+	results := make([]Result, len(goldens))
+	var wg sync.WaitGroup
+	for i, golden := range goldens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx := logging.With(ctx, "golden", golden.Name)
+			result := Result{Golden: golden.Name, Format: golden.Format}
+			goldenParser, err := golden.parser(parser, prompts)
+			var items []ai.MenuItem
+			if err == nil {
+				if goldenParser.PromptVersion() != parser.PromptVersion() {
+					result.PromptVersion = goldenParser.PromptVersion()
+				}
+				items, err = golden.parse(ctx, goldenParser)
+			}
+			if err != nil {
+				slog.WarnContext(ctx, "The model failed on the golden", "error", err)
+				result.Error = err.Error()
+				items = nil
+			}
+			result.Score = ScoreParse(golden, items)
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	report := Report{
+		PromptVersion: parser.PromptVersion(),
+		Model:         parser.Model(),
+		Evaluated:     time.Now().UTC().Truncate(time.Second),
+		Total:         newScore(),
+		Formats:       make(map[string]Score),
+		Goldens:       results,
+	}
+	for _, result := range results {
+		format, ok := report.Formats[result.Format]
+		if !ok {
+			format = newScore()
+		}
+		format.add(result.Score)
+		report.Formats[result.Format] = format
+		report.Total.add(result.Score)
+	}
+	return report
+}
+
+// Markdown is the report as tables: the accuracy of each field by format, and the
+// icons the model mixed up, most often first.
+func (r Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Prompt version %d, %s\n\n", r.PromptVersion, r.Model)
+
+	b.WriteString("| Format | Dishes found | Extra | Name | Type | Icon | Category |\n")
+	b.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, format := range slices.Sorted(maps.Keys(r.Formats)) {
+		writeScoreRow(&b, format, r.Formats[format])
+	}
+	writeScoreRow(&b, "**all**", r.Total)
+
+	type confusion struct {
+		want, got string
+		n         int
+	}
+	var confusions []confusion
+	for want, got := range r.Total.IconConfusion {
+		for icon, n := range got {
+			if icon != want {
+				confusions = append(confusions, confusion{want, icon, n})
+			}
+		}
+	}
+	if len(confusions) == 0 {
+		b.WriteString("\nNo icon was mixed up.\n")
+		return b.String()
+	}
+	sort.Slice(confusions, func(i, j int) bool {
+		if confusions[i].n != confusions[j].n {
+			return confusions[i].n > confusions[j].n
+		}
+		return confusions[i].want+confusions[i].got < confusions[j].want+confusions[j].got
+	})
+	b.WriteString("\n| Icon | Chosen instead | Dishes |\n")
+	b.WriteString("|---|---|---|\n")
+	for _, c := range confusions {
+		fmt.Fprintf(&b, "| %s | %s | %d |\n", c.want, c.got, c.n)
+	}
+	return b.String()
+}
+
+func writeScoreRow(b *strings.Builder, name string, score Score) {
+	cells := []string{name, fmt.Sprintf("%d/%d", score.Found, score.Dishes), fmt.Sprint(score.Extra)}
+	for _, field := range fields {
+		tally, ok := score.Fields[field]
+		if !ok {
+			cells = append(cells, "-") // the PDF format has no categories
+			continue
+		}
+		cells = append(cells, formatAccuracy(tally))
+	}
+	b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+}
+
+func formatAccuracy(tally Tally) string {
+	return fmt.Sprintf("%.0f%%", tally.Accuracy()*100)
+}
+
+// Compare is how the accuracy of each field changed from baseline to current, in
+// total and by format, as a table. Only the formats both have are compared.
+func Compare(baseline, current Report) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Prompt version %d, %s against prompt version %d, %s\n\n",
+		current.PromptVersion, current.Model, baseline.PromptVersion, baseline.Model)
+	b.WriteString("| Format | Field | Before | After | Change |\n")
+	b.WriteString("|---|---|---|---|---|\n")
+
+	compare := func(name string, before, after Score) {
+		for _, field := range fields {
+			was, okBefore := before.Fields[field]
+			is, okAfter := after.Fields[field]
+			if !okBefore || !okAfter {
+				continue
+			}
+			change := (is.Accuracy() - was.Accuracy()) * 100
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %+.0f |\n", name, field, formatAccuracy(was), formatAccuracy(is), change)
+		}
+	}
+	for _, format := range slices.Sorted(maps.Keys(current.Formats)) {
+		if before, ok := baseline.Formats[format]; ok {
+			compare(format, before, current.Formats[format])
+		}
+	}
+	compare("**all**", baseline.Total, current.Total)
+	return b.String()
+}
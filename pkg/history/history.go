@@ -0,0 +1,188 @@
+// Package history remembers every dish the restaurants have served, in an SQLite
+// database, so that a menu can tell the dishes that are new from the ones that
+// keep coming back.
+package history
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "modernc.org/sqlite" // the "sqlite" driver, in pure Go
+)
+
+// A dish is what a restaurant serves under a name, or under names close enough
+// to it (see similarity); dish_names has every name it was seen under, normalized.
+// A serving is a dish on a day's menu.
+const schema = `
+CREATE TABLE IF NOT EXISTS dishes (
+	id         INTEGER PRIMARY KEY,
+	restaurant TEXT NOT NULL,
+	name       TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS dish_names (
+	restaurant TEXT NOT NULL,
+	normalized TEXT NOT NULL,
+	dish_id    INTEGER NOT NULL REFERENCES dishes (id),
+	PRIMARY KEY (restaurant, normalized)
+);
+CREATE TABLE IF NOT EXISTS servings (
+	restaurant  TEXT NOT NULL,
+	date        TEXT NOT NULL,
+	name        TEXT NOT NULL,
+	dish_id     INTEGER NOT NULL REFERENCES dishes (id),
+	category    TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	photo       TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (restaurant, date, name)
+);
+CREATE INDEX IF NOT EXISTS servings_by_dish ON servings (dish_id, date);
+`
+
+// DB is a dish history.
+type DB struct {
+	db *sql.DB
+}
+
+// Open opens the history at path, creating it if there is none yet.
+func Open(path string) (*DB, error) {
+	// Runs that share a file, e.g. the restaurants of a batch, wait their turn to
+	// write rather than fail
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(10000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the dish history %s: %w", path, err)
+	}
+	// SQLite writes one at a time anyway
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open the dish history %s: %w", path, err)
+	}
+	return &DB{db: db}, nil
+}
+
+// Close closes the database, after which the file at its path is complete.
+func (h *DB) Close() error {
+	return h.db.Close()
+}
+
+// Serving is a dish on a restaurant's menu on a day.
+type Serving struct {
+	Restaurant  string // the restaurant's ID, e.g. "gira"
+	Date        string // ISO date
+	Name        string
+	Category    string
+	Description string
+	Photo       string
+}
+
+// Record adds the servings, each to the dish its name is. A day that is recorded
+// again, e.g. when a menu is published a second time, replaces what was recorded
+// for it before rather than being counted twice.
+func (h *DB) Record(ctx context.Context, servings []Serving) error {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type day struct{ restaurant, date string }
+	cleared := make(map[day]bool)
+	for _, serving := range servings {
+		if d := (day{serving.Restaurant, serving.Date}); !cleared[d] {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM servings WHERE restaurant = ? AND date = ?`, d.restaurant, d.date); err != nil {
+				return err
+			}
+			cleared[d] = true
+		}
+
+		id, err := dishID(ctx, tx, serving.Restaurant, serving.Name)
+		if err != nil {
+			return fmt.Errorf("failed to look up %q: %w", serving.Name, err)
+		}
+		// A dish that is listed twice on a day is served once
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO servings (restaurant, date, name, dish_id, category, description, photo)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT DO NOTHING`,
+			serving.Restaurant, serving.Date, serving.Name, id, serving.Category, serving.Description, serving.Photo); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// dishID finds the dish the restaurant serves under name: the one that was seen
+// under the same name, normalized, or else under the most similar one, if it is
+// similar enough. A name that is neither is a new dish.
+func dishID(ctx context.Context, tx *sql.Tx, restaurant, name string) (int64, error) {
+	normalized := Normalize(name)
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT dish_id FROM dish_names WHERE restaurant = ? AND normalized = ?`, restaurant, normalized).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT normalized, dish_id FROM dish_names WHERE restaurant = ?`, restaurant)
+	if err != nil {
+		return 0, err
+	}
+	best := matchThreshold
+	for rows.Next() {
+		var known string
+		var knownID int64
+		if err := rows.Scan(&known, &knownID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if score := similarity(normalized, known); score >= best {
+			best, id = score, knownID
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if id == 0 {
+		result, err := tx.ExecContext(ctx, `INSERT INTO dishes (restaurant, name) VALUES (?, ?)`, restaurant, name)
+		if err != nil {
+			return 0, err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return 0, err
+		}
+	}
+	// Next time the name is found straight away
+	_, err = tx.ExecContext(ctx, `INSERT INTO dish_names (restaurant, normalized, dish_id) VALUES (?, ?, ?)`, restaurant, normalized, id)
+	return id, err
+}
+
+// Seen is a dish's history as of a day it is served on.
+type Seen struct {
+	FirstSeen   string // the first day it was served, which is the day itself for a new dish
+	LastSeen    string // the last day before the day itself it was served, empty for a new dish
+	TimesServed int    // on how many days it was served, the day itself included
+}
+
+// Seen looks up the history of the dish served on date under name, as of that
+// day: days after it don't count, so an older week that is published again says
+// the same as it did the first time. A serving that wasn't recorded has none.
+func (h *DB) Seen(ctx context.Context, restaurant, date, name string) (Seen, error) {
+	var first, last sql.NullString
+	var seen Seen
+	err := h.db.QueryRowContext(ctx, `
+		SELECT MIN(s.date), MAX(CASE WHEN s.date < this.date THEN s.date END), COUNT(DISTINCT s.date)
+		FROM servings this JOIN servings s ON s.dish_id = this.dish_id AND s.date <= this.date
+		WHERE this.restaurant = ? AND this.date = ? AND this.name = ?`,
+		restaurant, date, name).Scan(&first, &last, &seen.TimesServed)
+	if err != nil {
+		return Seen{}, err
+	}
+	seen.FirstSeen, seen.LastSeen = first.String, last.String
+	return seen, nil
+}
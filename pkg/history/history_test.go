@@ -0,0 +1,109 @@
+package history
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestSameDish(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"Älplermagronen", "Aelplermagronen", true},
+		{"Chicken Tikka-Masala", "chicken tikka masala", true},
+		{"Poulet Cordon Bleu", "Cordon Bleu Poulet", true},
+		{"Spaghetti Carbonara", "Spagetti Carbonara", true},
+		{"Pizza Margherita", "Pizza Marinara", false},
+		{"Pasta Pesto", "Pasta Pesto Rosso", false},
+		{"Dal", "Dhal", false},
+		{"Poulet Curry", "Poulet Curry Madras", false},
+	}
+	for _, tt := range tests {
+		score := similarity(Normalize(tt.a), Normalize(tt.b))
+		if same := score >= matchThreshold; same != tt.same {
+			t.Errorf("similarity(%q, %q) = %.2f, want the same dish: %v", tt.a, tt.b, score, tt.same)
+		}
+	}
+
+	if got := Normalize("  Älpler-Magronen! "); got != "alpler magronen" {
+		t.Errorf("Normalize() = %q", got)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "history.sqlite")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := func(servings ...Serving) {
+		t.Helper()
+		if err := db.Record(ctx, servings); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	seen := func(restaurant, date, name string) Seen {
+		t.Helper()
+		seen, err := db.Seen(ctx, restaurant, date, name)
+		if err != nil {
+			t.Fatalf("Seen() error = %v", err)
+		}
+		return seen
+	}
+
+	record(
+		Serving{Restaurant: "gira", Date: "2026-07-03", Name: "Pizza Siciliana"},
+		Serving{Restaurant: "gira", Date: "2026-07-03", Name: "Dal"},
+		Serving{Restaurant: "espace", Date: "2026-07-03", Name: "Pizza Siciliana"},
+	)
+	record(
+		Serving{Restaurant: "gira", Date: "2026-07-10", Name: "PIZZA SICILIANA"},
+		Serving{Restaurant: "gira", Date: "2026-07-10", Name: "Pizza Siciliana"}, // listed twice
+	)
+	record(
+		Serving{Restaurant: "gira", Date: "2026-07-17", Name: "Pizza Siziliana"},
+		Serving{Restaurant: "gira", Date: "2026-07-17", Name: "Poulet Cordon Bleu"},
+	)
+
+	if got, want := seen("gira", "2026-07-17", "Pizza Siziliana"), (Seen{FirstSeen: "2026-07-03", LastSeen: "2026-07-10", TimesServed: 3}); got != want {
+		t.Errorf("Seen(Pizza Siciliana) = %+v, want %+v", got, want)
+	}
+	if got, want := seen("gira", "2026-07-17", "Poulet Cordon Bleu"), (Seen{FirstSeen: "2026-07-17", TimesServed: 1}); got != want {
+		t.Errorf("Seen(a new dish) = %+v, want %+v", got, want)
+	}
+	// As of an earlier day, the days after it don't count
+	if got, want := seen("gira", "2026-07-10", "PIZZA SICILIANA"), (Seen{FirstSeen: "2026-07-03", LastSeen: "2026-07-03", TimesServed: 2}); got != want {
+		t.Errorf("Seen(as of 2026-07-10) = %+v, want %+v", got, want)
+	}
+	// Another restaurant's dishes are its own
+	if got, want := seen("espace", "2026-07-03", "Pizza Siciliana"), (Seen{FirstSeen: "2026-07-03", TimesServed: 1}); got != want {
+		t.Errorf("Seen(espace) = %+v, want %+v", got, want)
+	}
+	if got := seen("gira", "2026-07-17", "Dal"); got != (Seen{}) {
+		t.Errorf("Seen(not served) = %+v, want none", got)
+	}
+
+	// A day recorded again replaces what it had
+	record(Serving{Restaurant: "gira", Date: "2026-07-17", Name: "Dal"})
+	if got := seen("gira", "2026-07-17", "Poulet Cordon Bleu"); got != (Seen{}) {
+		t.Errorf("Seen(replaced) = %+v, want none", got)
+	}
+	if got, want := seen("gira", "2026-07-17", "Dal"), (Seen{FirstSeen: "2026-07-03", LastSeen: "2026-07-03", TimesServed: 2}); got != want {
+		t.Errorf("Seen(Dal) = %+v, want %+v", got, want)
+	}
+
+	// And it's all still there when the file is opened again
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := seen("gira", "2026-07-10", "Pizza Siciliana"); got.TimesServed != 2 {
+		t.Errorf("Seen() after reopening = %+v, want served twice", got)
+	}
+}
@@ -0,0 +1,72 @@
+package history
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// matchThreshold is how similar two names have to be to be the same dish. High
+// enough that "Pizza Margherita" and "Pizza Marinara" stay two dishes, low enough
+// that a typo, a hyphen or "Ä" written as "Ae" doesn't make a new one.
+const matchThreshold = 0.85
+
+var stripAccents = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// Normalize reduces a dish name to its words: lower case, without accents or
+// punctuation, e.g. "Älpler-Magronen!" becomes "alpler magronen".
+func Normalize(name string) string {
+	stripped, _, err := transform.String(stripAccents, name)
+	if err != nil {
+		stripped = name
+	}
+	words := strings.FieldsFunc(strings.ToLower(stripped), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// similarity scores two normalized names from 0 to 1 by their edit distance,
+// compared as they are and with their words sorted, so that the order of the
+// words doesn't matter ("Cordon Bleu Poulet" is "Poulet Cordon Bleu").
+func similarity(a, b string) float64 {
+	return max(ratio(a, b), ratio(sortWords(a), sortWords(b)))
+}
+
+func sortWords(name string) string {
+	words := strings.Fields(name)
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// ratio is 1 minus the Levenshtein distance over the longer name's length.
+func ratio(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+
+	// Two rows of the distance matrix are enough
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
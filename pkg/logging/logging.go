@@ -0,0 +1,93 @@
+// Package logging sets up the structured log the runs write, as text for a
+// terminal or as JSON lines for the CI logs, where the matrix jobs' records can be
+// put side by side.
+//
+// What a record is about - the restaurant, the week, the day, the stage of the
+// run - travels with the context rather than being repeated at every call: With
+// adds it, and every record logged with that context (slog.InfoContext and
+// friends) carries it.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// The formats New writes, as LOG_FORMAT names them.
+const (
+	FormatText = "text" // key=value pairs, the default
+	FormatJSON = "json" // one JSON object per line
+)
+
+// New returns a logger writing to w in format, text by default.
+func New(w io.Writer, format string) (*slog.Logger, error) {
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(w, nil)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, nil)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, want text or json", format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+type attrsKey struct{}
+
+// With returns a copy of ctx whose records carry args as well, given the way
+// slog.Info takes them: key-value pairs or slog.Attrs.
+func With(ctx context.Context, args ...any) context.Context {
+	attrs := slices.Clip(attrsFrom(ctx))
+	attrs = append(attrs, slog.Group("", args...).Value.Group()...)
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+func attrsFrom(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// contextHandler adds the attributes With put in the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	record.AddAttrs(attrsFrom(ctx)...)
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// RunID identifies the run in its records and its report. On GitHub Actions it is
+// the workflow run's ID and attempt, which the jobs of a matrix share; elsewhere
+// it is random.
+var RunID = sync.OnceValue(func() string {
+	if id := os.Getenv("GITHUB_RUN_ID"); id != "" {
+		if attempt := os.Getenv("GITHUB_RUN_ATTEMPT"); attempt != "" {
+			return id + "-" + attempt
+		}
+		return id
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+})
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestWith(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := func(ctx context.Context) map[string]any {
+		t.Helper()
+		out.Reset()
+		logger.InfoContext(ctx, "Scraped the day", "dishes", 6)
+		var record map[string]any
+		if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+			t.Fatalf("not a JSON record: %v\n%s", err, out.String())
+		}
+		return record
+	}
+
+	restaurant := With(context.Background(), "restaurant", "espace")
+	monday := With(restaurant, "day", "monday", slog.String("stage", "scrape"))
+	tuesday := With(restaurant, "day", "tuesday")
+
+	got := record(monday)
+	for key, want := range map[string]any{"msg": "Scraped the day", "dishes": 6.0, "restaurant": "espace", "day": "monday", "stage": "scrape"} {
+		if got[key] != want {
+			t.Errorf("%s = %v, want %v", key, got[key], want)
+		}
+	}
+
+	// Siblings don't see each other's attributes, nor parents their children's
+	if got := record(tuesday); got["day"] != "tuesday" || got["stage"] != nil {
+		t.Errorf("tuesday's record = %v, want its own day and no stage", got)
+	}
+	if got := record(restaurant); got["day"] != nil || got["restaurant"] != "espace" {
+		t.Errorf("the restaurant's record = %v, want no day", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.InfoContext(With(context.Background(), "restaurant", "gira"), "Published the menu")
+	if want := `msg="Published the menu" restaurant=gira`; !bytes.Contains(out.Bytes(), []byte(want)) {
+		t.Errorf("text record = %q, want it to contain %q", out.String(), want)
+	}
+
+	if _, err := New(&out, "xml"); err == nil {
+		t.Error("New(xml) succeeded, want an error for the unknown format")
+	}
+}
@@ -0,0 +1,135 @@
+// Package metrics counts what the runs do, for Prometheus: how the parses compare
+// to the pages, how often the model needs a second go, how long it and the
+// scrapes take, and how many dish photos turn up.
+//
+// Everything is on Registry. The API server serves it on /metrics; a fetch run,
+// which is over before anything could scrape it, pushes it to a Pushgateway when
+// it is done (see Push), and when each restaurant last succeeded on its own (see
+// PushSuccess).
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Registry has every metric of the package. The Go runtime's and the process's
+// are not on it: a run pushes what it did, not the state of a process that is
+// about to exit.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// DishesOnPage and DishesParsed are the dishes the page listed for the days the
+	// model parsed, and the dishes it returned for them, after the retries. The
+	// two should go up together; ShortDays counts the days where they didn't.
+	DishesOnPage = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lunch_dishes_on_page_total",
+		Help: "Dishes the scraped pages listed for the days the model parsed.",
+	}, []string{"restaurant"})
+	DishesParsed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lunch_dishes_parsed_total",
+		Help: "Dishes the model returned for those days, after the retries.",
+	}, []string{"restaurant"})
+	ShortDays = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lunch_short_days_total",
+		Help: "Days the model returned fewer dishes for than the page listed, after the retries.",
+	}, []string{"restaurant"})
+	ParseRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lunch_parse_retries_total",
+		Help: "Days sent to the model again because its answer failed validation.",
+	}, []string{"restaurant"})
+
+	ModelRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lunch_model_request_duration_seconds",
+		Help:    "How long the model took to answer, by outcome (ok or error).",
+		Buckets: []float64{1, 2, 5, 10, 20, 30, 60, 120, 180},
+	}, []string{"model", "outcome"})
+	ModelTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lunch_model_tokens_total",
+		Help: "Tokens the model's answers took, by direction (input, output, and the reasoning part of output).",
+	}, []string{"model", "direction"})
+	ModelCost = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lunch_model_cost_usd_total",
+		Help: "What the model's answers cost, in US dollars, for the models with a price.",
+	}, []string{"model"})
+
+	PhotoFetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lunch_photo_fetches_total",
+		Help: "Dish pages looked up for a photo, by result (found, none or error).",
+	}, []string{"result"})
+
+	// ScrapeDayDuration is Espace's, whose days are loaded one by one in Chrome.
+	ScrapeDayDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lunch_scrape_day_duration_seconds",
+		Help:    "How long scraping one day of a menu took, for the scrapers that load the days one by one.",
+		Buckets: []float64{2, 5, 10, 15, 20, 30, 45, 60, 90},
+	}, []string{"day"})
+	StageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lunch_stage_duration_seconds",
+		Help:    "How long each stage of a restaurant's run took: scrape, clean, parse, photos or upload.",
+		Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 240},
+	}, []string{"restaurant", "stage"})
+
+	APIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lunch_api_requests_total",
+		Help: "Requests the API server answered, by route and status code.",
+	}, []string{"route", "code"})
+)
+
+func init() {
+	Registry.MustRegister(
+		DishesOnPage, DishesParsed, ShortDays, ParseRetries,
+		ModelRequestDuration, ModelTokens, ModelCost,
+		PhotoFetches,
+		ScrapeDayDuration, StageDuration,
+		APIRequests,
+	)
+}
+
+// Job is the job the runs push as.
+const Job = "lunch_fetch"
+
+// pushTimeout keeps a Pushgateway that doesn't answer from holding up the end of
+// the run.
+const pushTimeout = 30 * time.Second
+
+// Push replaces the group of the Pushgateway at url that grouping names with
+// what is on Registry now. Each group is kept until it is pushed to again, so a
+// run should push under a grouping that is the same the next time it runs, e.g.
+// the restaurants it fetched, rather than under one of its own.
+func Push(ctx context.Context, url string, grouping map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+
+	pusher := push.New(url, Job).Gatherer(Registry).Client(&http.Client{Timeout: pushTimeout})
+	for name, value := range grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	return pusher.PushContext(ctx)
+}
+
+// PushSuccess adds to the Pushgateway at url that the restaurant's menu was
+// fetched without an error at time at, as lunch_last_success_timestamp_seconds in
+// a group of the restaurant's own. Unlike the run's group (see Push), that group
+// is only ever added to, and only when the restaurant succeeded: a run that fails
+// leaves the last success where it was, for an alert on its age to fire.
+func PushSuccess(ctx context.Context, url, restaurant string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+
+	lastSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "lunch_last_success_timestamp_seconds",
+		Help: "When a restaurant's menu was last fetched without an error.",
+	})
+	lastSuccess.Set(float64(at.Unix()))
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(lastSuccess)
+
+	// The group's restaurant label is the metric's
+	return push.New(url, Job).Gatherer(registry).Client(&http.Client{Timeout: pushTimeout}).
+		Grouping("restaurant", restaurant).AddContext(ctx)
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// A stand-in Pushgateway that keeps the last push.
+func TestPush(t *testing.T) {
+	var method, path string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	StageDuration.WithLabelValues("gira", "scrape").Observe(3.2)
+	if err := Push(context.Background(), server.URL, map[string]string{"restaurants": "gira"}); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	// PUT replaces the group, rather than adding to what the last run left there
+	if method != http.MethodPut || path != "/metrics/job/lunch_fetch/restaurants/gira" {
+		t.Errorf("pushed %s %s, want PUT to the job's group", method, path)
+	}
+	if !bytes.Contains(body, []byte("lunch_stage_duration_seconds")) {
+		t.Errorf("the push has no lunch_stage_duration_seconds")
+	}
+	// Neither the process that is about to exit, nor the last success, which a
+	// failed run's push would otherwise erase
+	for _, metric := range []string{"go_goroutines", "process_", "lunch_last_success"} {
+		if bytes.Contains(body, []byte(metric)) {
+			t.Errorf("the push has %s", metric)
+		}
+	}
+
+	if err := PushSuccess(context.Background(), server.URL, "gira", time.Unix(1784265600, 0)); err != nil {
+		t.Fatalf("PushSuccess() error = %v", err)
+	}
+	// POST adds to the restaurant's own group, which nothing else replaces
+	if method != http.MethodPost || path != "/metrics/job/lunch_fetch/restaurant/gira" {
+		t.Errorf("pushed %s %s, want POST to the restaurant's group", method, path)
+	}
+	if !bytes.Contains(body, []byte("lunch_last_success_timestamp_seconds")) {
+		t.Errorf("the push has no lunch_last_success_timestamp_seconds")
+	}
+}
+
+func TestPushFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no space left", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := Push(context.Background(), server.URL, map[string]string{"restaurants": "gira"}); err == nil {
+		t.Error("Push() succeeded against a Pushgateway that failed it")
+	}
+}
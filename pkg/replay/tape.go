@@ -0,0 +1,205 @@
+// Package replay records what a run fetched from the outside world - scraped
+// menus, model answers, dish pages - and plays it back, so a run can be repeated
+// without the restaurants' sites or a model, and with the same result.
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mode is what a tape does with what passes through it.
+type Mode string
+
+const (
+	Record Mode = "record" // store everything fetched
+	Replay Mode = "replay" // serve what was stored, and fetch nothing
+)
+
+// ErrNotRecorded is returned when replaying something the tape never stored.
+var ErrNotRecorded = errors.New("not recorded")
+
+// Tape is a directory of recordings, one JSON file per entry, grouped by kind
+// (dir/<kind>/<key>.json), so a recording can be read and edited by hand.
+//
+// A nil Tape neither records nor replays, so callers can use one unconditionally.
+type Tape struct {
+	dir  string
+	mode Mode
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// Open opens the tape in dir. Recording creates the directory; replaying needs it
+// to exist already.
+func Open(dir string, mode Mode) (*Tape, error) {
+	switch mode {
+	case Record:
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create the recording directory: %w", err)
+		}
+	case Replay:
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("nothing to replay: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown tape mode %q", mode)
+	}
+	return &Tape{dir: dir, mode: mode, counts: make(map[string]int)}, nil
+}
+
+// Recording reports whether the tape stores what passes through it.
+func (t *Tape) Recording() bool {
+	return t != nil && t.mode == Record
+}
+
+// Replaying reports whether the tape serves stored entries instead of fetching.
+func (t *Tape) Replaying() bool {
+	return t != nil && t.mode == Replay
+}
+
+// Save stores v as JSON under kind and key, replacing an earlier entry.
+func (t *Tape) Save(kind, key string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the %s recording %q: %w", kind, key, err)
+	}
+
+	path := t.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create the recording directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write the %s recording %q: %w", kind, key, err)
+	}
+	return nil
+}
+
+// Load reads the entry stored under kind and key into v.
+func (t *Tape) Load(kind, key string, v any) error {
+	data, err := os.ReadFile(t.path(kind, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s %q: %w", kind, key, ErrNotRecorded)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the %s recording %q: %w", kind, key, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode the %s recording %q: %w", kind, key, err)
+	}
+	return nil
+}
+
+// Next returns the key for the next occurrence of key in this run: key-1, key-2
+// and so on. The same request can legitimately be made twice (a retried day is
+// the same prompt again), and a replay has to give back the second answer the
+// second time, not the first one twice.
+func (t *Tape) Next(kind, key string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.counts[kind+"/"+key]++
+	return fmt.Sprintf("%s-%d", key, t.counts[kind+"/"+key])
+}
+
+var reUnsafe = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+func (t *Tape) path(kind, key string) string {
+	return filepath.Join(t.dir, kind, reUnsafe.ReplaceAllString(strings.ToLower(key), "_")+".json")
+}
+
+// Hash turns a request too long or too odd to be a file name (a prompt, a URL)
+// into a key.
+func Hash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// httpResponse is a recorded HTTP response.
+type httpResponse struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body"`
+}
+
+// Transport records or replays the HTTP requests made through it. A nil tape
+// returns base unchanged; a nil base is http.DefaultTransport.
+func (t *Tape) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t == nil {
+		return base
+	}
+	return &transport{tape: t, base: base}
+}
+
+type transport struct {
+	tape *Tape
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	const kind = "http"
+	key := t.tape.Next(kind, Hash(req.Method, req.URL.String()))
+
+	if t.tape.Replaying() {
+		var recorded httpResponse
+		if err := t.tape.Load(kind, key, &recorded); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL, err)
+		}
+		return &http.Response{
+			Status:        http.StatusText(recorded.Status),
+			StatusCode:    recorded.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {recorded.ContentType}},
+			Body:          io.NopCloser(strings.NewReader(recorded.Body)),
+			ContentLength: int64(len(recorded.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	err = t.tape.Save(kind, key, httpResponse{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(body),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
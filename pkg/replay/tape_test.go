@@ -0,0 +1,48 @@
+package replay
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTapeReplaysWhatWasRecorded(t *testing.T) {
+	dir := t.TempDir()
+
+	recorder, err := Open(dir, Record)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	// The same request twice is two entries, answered in order
+	for _, answer := range []string{"first", "second"} {
+		if err := recorder.Save("completion", recorder.Next("completion", "prompt"), answer); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	player, err := Open(dir, Replay)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for _, want := range []string{"first", "second"} {
+		var got string
+		if err := player.Load("completion", player.Next("completion", "prompt"), &got); err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	// A third time was never recorded, and must not quietly repeat an answer
+	var got string
+	err = player.Load("completion", player.Next("completion", "prompt"), &got)
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("Load() error = %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestReplayNeedsARecording(t *testing.T) {
+	if _, err := Open(t.TempDir()+"/missing", Replay); err == nil {
+		t.Error("want an error when there is nothing to replay")
+	}
+}
@@ -0,0 +1,95 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Browser is a Chrome that several scrapes can share. It is only started the first
+// time a scrape asks for a tab, so a run that never needs Chrome (the food2050
+// restaurants) never pays for one.
+type Browser struct {
+	debug bool
+
+	once     sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+	startErr error
+}
+
+// NewBrowser prepares a browser without starting it. In debug mode Chrome runs
+// visibly and is left open after Close, for inspection.
+func NewBrowser(debug bool) *Browser {
+	return &Browser{debug: debug}
+}
+
+func (b *Browser) start() error {
+	b.once.Do(func() {
+		opts := []chromedp.ExecAllocatorOption{
+			chromedp.NoFirstRun,
+			chromedp.NoDefaultBrowserCheck,
+			chromedp.DisableGPU,
+			chromedp.WindowSize(1280, 800),
+			chromedp.NoSandbox,
+			// Chrome puts its shared memory in /dev/shm, which Docker caps at 64MB. Loading
+			// a day used to hang the renderer outright there - not slowly, but past any
+			// timeout, unresponsive even to an evaluate - which is why this scrape worked
+			// on a laptop and never in CI. Keeping that memory in /tmp lifts the cap.
+			chromedp.Flag("disable-dev-shm-usage", true),
+		}
+
+		// Don't run in headless mode if debug mode is enabled
+		if b.debug {
+			slog.Info("Debug mode enabled: Chrome browser will stay open for inspection")
+			opts = append(opts, chromedp.Flag("headless", false))          // Disable headless mode
+			opts = append(opts, chromedp.Flag("enable-automation", false)) // Hide automation banner
+			slog.Info("Configured Chrome to run in visible mode")
+		} else {
+			opts = append(opts, chromedp.Flag("headless", true)) // Enable headless mode
+		}
+
+		allocCtx, cancelAllocator := chromedp.NewExecAllocator(context.Background(), opts...)
+		ctx, cancel := chromedp.NewContext(allocCtx,
+			chromedp.WithLogf(func(format string, args ...interface{}) {
+				if b.debug {
+					slog.Info("ChromeDP", "message", fmt.Sprintf(format, args...))
+				}
+			}),
+		)
+		b.ctx = ctx
+		b.cancel = func() {
+			cancel()
+			cancelAllocator()
+		}
+
+		// The first run on a context is what launches Chrome, and cancelling that run's
+		// context would close it again. So it runs here, without the deadline the
+		// scrapes put on their tabs.
+		if err := chromedp.Run(ctx); err != nil {
+			b.startErr = fmt.Errorf("failed to start Chrome: %w", err)
+		}
+	})
+	return b.startErr
+}
+
+// newTab opens a tab in the shared browser, starting it if need be. Cancelling the
+// returned context closes the tab and leaves the browser running.
+func (b *Browser) newTab() (context.Context, context.CancelFunc, error) {
+	if err := b.start(); err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := chromedp.NewContext(b.ctx)
+	return ctx, cancel, nil
+}
+
+// Close shuts Chrome down, if it was ever started. A debug browser stays open.
+func (b *Browser) Close() {
+	if b.debug || b.cancel == nil {
+		return
+	}
+	b.cancel()
+}
@@ -8,28 +8,52 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
 )
 
 // DayMenu is a single weekday's menu, split out so it can be parsed on its own.
 // Dishes is what the page offered, which is what the parsed result is checked against.
 type DayMenu struct {
-	Day    string // lowercase weekday, e.g. "monday"
-	Date   string // ISO date, e.g. "2026-07-17"
-	HTML   string
-	Dishes int
+	Day    string `json:"day"`  // lowercase weekday, e.g. "monday"
+	Date   string `json:"date"` // ISO date, e.g. "2026-07-17"
+	HTML   string `json:"html"`
+	Dishes int    `json:"dishes"`
 
 	// Photos maps a category heading ("Chefs Choice") to the restaurant's photo for
 	// that day's dish. Only set by scrapers whose page carries photos (Espace);
 	// food2050's photos live on the dish pages and are fetched from the dish links.
-	Photos map[string]string
+	Photos map[string]string `json:"photos,omitempty"`
 
 	// Links maps a category heading to the dish's page on the restaurant's site, for
 	// scrapers that have to work the link out for themselves (Espace). food2050 puts
 	// the link in the markup, so the model reads it straight off the page.
-	Links map[string]string
+	Links map[string]string `json:"links,omitempty"`
 
 	// URL is the day's own page, used for dishes we could not find a link for.
-	URL string
+	URL string `json:"url,omitempty"`
+
+	// Items lists the dishes one by one, for scrapers that can tell them apart
+	// without a model (food2050). Nil otherwise.
+	Items []ai.Dish `json:"items,omitempty"`
+}
+
+// listedDish is a dish with the link's whole text, labels included, as the model
+// is shown it.
+type listedDish struct {
+	ai.Dish
+	text string
+}
+
+// dietLabels maps the diet labels the pages put on a dish, in German and English,
+// to the type the frontend knows (see ai.DishTypes).
+var dietLabels = map[string]string{
+	"vegan":       ai.TypeVegan,
+	"vegetarisch": ai.TypeVegetarian,
+	"vegetarian":  ai.TypeVegetarian,
+	"fleisch":     ai.TypeMeat,
+	"meat":        ai.TypeMeat,
+	"fisch":       ai.TypeMeat,
+	"fish":        ai.TypeMeat,
 }
 
 // Dish links end in the date the dish is served on, e.g.
@@ -49,13 +73,7 @@ func GroupMenuByDay(htmlContent string) ([]DayMenu, error) {
 		return nil, fmt.Errorf("failed to parse menu HTML: %w", err)
 	}
 
-	type dish struct {
-		category    string
-		description string
-		link        string
-	}
-
-	dishesByDate := make(map[string][]dish)
+	dishesByDate := make(map[string][]listedDish)
 	// The current day is rendered twice (once in the weekly grid, once in the
 	// single-day view below it), so the link doubles as a de-duplication key.
 	seen := make(map[string]bool)
@@ -67,17 +85,22 @@ func GroupMenuByDay(htmlContent string) ([]DayMenu, error) {
 			return
 		}
 
-		description := normalizeSpace(link.Text())
-		if description == "" {
+		text := normalizeSpace(link.Text())
+		if text == "" {
 			return
 		}
 
 		seen[href] = true
 		date := match[1]
-		dishesByDate[date] = append(dishesByDate[date], dish{
-			category:    categoryOf(link),
-			description: description,
-			link:        href,
+		description, labels := splitLabels(link)
+		dishesByDate[date] = append(dishesByDate[date], listedDish{
+			Dish: ai.Dish{
+				Category:    categoryOf(link),
+				Description: description,
+				Link:        href,
+				Labels:      labels,
+			},
+			text: text,
 		})
 	})
 
@@ -95,10 +118,12 @@ func GroupMenuByDay(htmlContent string) ([]DayMenu, error) {
 		}
 
 		var section strings.Builder
+		items := make([]ai.Dish, 0, len(dishesByDate[date]))
 		for _, d := range dishesByDate[date] {
 			fmt.Fprintf(&section,
 				"<div><h3>%s</h3><p>%s</p><a href=\"%s\">Details</a></div>\n",
-				d.category, d.description, d.link)
+				d.Category, d.text, d.Link)
+			items = append(items, d.Dish)
 		}
 
 		days = append(days, DayMenu{
@@ -106,6 +131,7 @@ func GroupMenuByDay(htmlContent string) ([]DayMenu, error) {
 			Date:   date,
 			HTML:   section.String(),
 			Dishes: len(dishesByDate[date]),
+			Items:  items,
 		})
 	}
 
@@ -136,6 +162,38 @@ func categoryOf(link *goquery.Selection) string {
 	return category
 }
 
+// splitLabels separates a dish link's diet labels from its description. A label
+// is either spelled out in an element of its own ("Vegan") or an icon that names
+// itself in its alt text or title.
+func splitLabels(link *goquery.Selection) (string, []string) {
+	var labels []string
+	seen := make(map[string]bool)
+	add := func(text string) bool {
+		label, ok := dietLabels[strings.ToLower(normalizeSpace(text))]
+		if ok && !seen[label] {
+			seen[label] = true
+			labels = append(labels, label)
+		}
+		return ok
+	}
+
+	dish := link.Clone()
+	dish.Find("*").Each(func(_ int, element *goquery.Selection) {
+		for _, attr := range []string{"alt", "title", "aria-label"} {
+			if value, ok := element.Attr(attr); ok {
+				add(value)
+			}
+		}
+		// Only an element holding nothing but the label counts, not a description
+		// that happens to mention it
+		if element.Children().Length() == 0 && add(element.Text()) {
+			element.Remove()
+		}
+	})
+
+	return normalizeSpace(dish.Text()), labels
+}
+
 func normalizeSpace(text string) string {
 	return strings.Join(strings.Fields(text), " ")
 }
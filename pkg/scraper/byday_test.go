@@ -85,3 +85,40 @@ func TestGroupMenuByDayWithoutDatedLinks(t *testing.T) {
 		t.Errorf("got %+v, want no days when the page has no dated dish links", days)
 	}
 }
+
+func TestGroupMenuByDayListsDishesWithTheirDietLabels(t *testing.T) {
+	days, err := GroupMenuByDay(`
+<div>
+  <div>
+    <div><p>Pasta Del Giorno</p></div>
+    <div><a href="https://x/menu,pasta-del-giorno/2026-07-17"><div><p>PASTA PESTO, Basilikum</p> <span>Vegan</span></div></a></div>
+  </div>
+  <div>
+    <div><p>Chefs Choice</p></div>
+    <div><a href="https://x/menu,chefs-choice/2026-07-17"><div><p>POULET CURRY, Reis</p><img src="/meat.svg" alt="Fleisch"></div></a></div>
+  </div>
+</div>`)
+	if err != nil {
+		t.Fatalf("GroupMenuByDay() error = %v", err)
+	}
+	if len(days) != 1 || len(days[0].Items) != 2 {
+		t.Fatalf("got %+v, want one day with two dishes", days)
+	}
+
+	pasta, curry := days[0].Items[0], days[0].Items[1]
+	if pasta.Category != "Pasta Del Giorno" || curry.Category != "Chefs Choice" || pasta.Link != "https://x/menu,pasta-del-giorno/2026-07-17" {
+		t.Errorf("dishes = %+v, want their categories and links", days[0].Items)
+	}
+	// The label is not part of what the dish is called
+	if pasta.Description != "PASTA PESTO, Basilikum" || len(pasta.Labels) != 1 || pasta.Labels[0] != "vegan" {
+		t.Errorf("pasta = %+v, want the description without the spelled-out vegan label", pasta)
+	}
+	if len(curry.Labels) != 1 || curry.Labels[0] != "meat" {
+		t.Errorf("curry.Labels = %v, want meat from the icon's alt text", curry.Labels)
+	}
+
+	// The model still sees the page as it is
+	if !strings.Contains(days[0].HTML, "Basilikum Vegan") {
+		t.Errorf("the day's HTML lost the label:\n%s", days[0].HTML)
+	}
+}
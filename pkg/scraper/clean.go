@@ -2,8 +2,9 @@ package scraper
 
 import (
 	"bytes"
+	"context"
 	gohtml "html"
-	"log"
+	"log/slog"
 	"regexp"
 
 	"github.com/tdewolff/minify/v2"
@@ -34,14 +35,15 @@ var (
 	reTargetSingle = regexp.MustCompile(` target='[^']*'`)
 )
 
-func OptimizeHTML(html string) string {
-	html = minimizeHTML(html)
+// OptimizeHTML shrinks a page to the text and links the model needs.
+func OptimizeHTML(ctx context.Context, html string) string {
+	html = minimizeHTML(ctx, html)
 	html = cleanHTML(html)
 	html = stripTags(html)
 	return html
 }
 
-func minimizeHTML(htmlContent string) string {
+func minimizeHTML(ctx context.Context, htmlContent string) string {
 	// Initialize minifier
 	m := minify.New()
 	m.Add("text/html", &html.Minifier{
@@ -56,14 +58,11 @@ func minimizeHTML(htmlContent string) string {
 	var minifiedContent string
 	err := m.Minify("text/html", output, input)
 	if err != nil {
-		log.Printf("Error minifying HTML: %v, using original content", err)
+		slog.WarnContext(ctx, "Error minifying HTML, using original content", "error", err)
 		minifiedContent = htmlContent
 	} else {
 		minified := output.String()
-		log.Printf("Minified HTML from %d to %d bytes (%.1f%%)",
-			len(htmlContent),
-			len(minified),
-			float64(len(minified))/float64(len(htmlContent))*100)
+		slog.InfoContext(ctx, "Minified HTML", "before", len(htmlContent), "after", len(minified))
 		minifiedContent = minified
 	}
 	return minifiedContent
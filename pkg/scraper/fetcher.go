@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	neturl "net/url"
 	"os"
@@ -13,6 +13,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/chlab/lunch-wankdorf/pkg/logging"
+	"github.com/chlab/lunch-wankdorf/pkg/metrics"
 	"github.com/chromedp/cdproto/browser"
 	"github.com/chromedp/cdproto/runtime"
 	"github.com/chromedp/chromedp"
@@ -37,15 +39,18 @@ const (
 
 // MenuData contains the scraped content
 type MenuData struct {
-	Content string
+	Content string `json:"content"`
 	// Days holds the menu split into one section per weekday, for scrapers that can
 	// do the split themselves. Nil when the content still has to be split (see
 	// GroupMenuByDay).
-	Days []DayMenu
+	Days []DayMenu `json:"days,omitempty"`
+	// PDFURL is set by the pdf scraper, whose Content is then the text of the menu
+	// PDF it found there. A PDF menu covers the week as a whole, not single days.
+	PDFURL string `json:"pdfURL,omitempty"`
 }
 
 // ScrapeMenuContent retrieves only the relevant menu content from the URL
-func ScrapeMenuContent(url string, debugMode ...bool) (*MenuData, error) {
+func ScrapeMenuContent(ctx context.Context, url string) (*MenuData, error) {
 	menuData := &MenuData{}
 	var menuContent strings.Builder
 
@@ -53,13 +58,14 @@ func ScrapeMenuContent(url string, debugMode ...bool) (*MenuData, error) {
 	c := colly.NewCollector(
 		// Adjust user agent to avoid being blocked
 		colly.UserAgent(userAgent),
+		colly.StdlibContext(ctx),
 	)
 
 	// Look for main content divs that might contain the menu
 	c.OnHTML("div", func(e *colly.HTMLElement) {
 		html, err := e.DOM.Html()
 		if err != nil {
-			log.Printf("Error getting HTML: %v", err)
+			slog.WarnContext(ctx, "Error getting HTML", "error", err)
 			return
 		}
 		menuContent.WriteString(html)
@@ -67,7 +73,7 @@ func ScrapeMenuContent(url string, debugMode ...bool) (*MenuData, error) {
 
 	// Error handling
 	c.OnError(func(r *colly.Response, err error) {
-		log.Printf("Request URL: %s failed with response: %v, Error: %v", r.Request.URL, r, err)
+		slog.WarnContext(ctx, "Request failed", "url", r.Request.URL.String(), "status", r.StatusCode, "error", err)
 	})
 
 	// Start scraping
@@ -82,10 +88,11 @@ func ScrapeMenuContent(url string, debugMode ...bool) (*MenuData, error) {
 }
 
 // FetchPDFMenuURL retrieves a PDF menu URL from a website using a CSS selector
-func FetchPDFMenuURL(url string, menuSelector string) (string, error) {
+func FetchPDFMenuURL(ctx context.Context, url string, menuSelector string) (string, error) {
 	// Create a new collector
 	c := colly.NewCollector(
 		colly.UserAgent(userAgent),
+		colly.StdlibContext(ctx),
 	)
 
 	var pdfURL string
@@ -101,14 +108,14 @@ func FetchPDFMenuURL(url string, menuSelector string) (string, error) {
 			if pdfURL != "" {
 				pdfFound = true
 				firstItem = false
-				log.Printf("Found menu PDF URL: %s", pdfURL)
+				slog.InfoContext(ctx, "Found the menu PDF", "url", pdfURL)
 			}
 		}
 	})
 
 	// Handle errors
 	c.OnError(func(r *colly.Response, err error) {
-		log.Printf("Request URL: %s failed with error: %v", r.Request.URL, err)
+		slog.WarnContext(ctx, "Request failed", "url", r.Request.URL.String(), "error", err)
 	})
 
 	// Set timeout for the request
@@ -129,7 +136,7 @@ func FetchPDFMenuURL(url string, menuSelector string) (string, error) {
 }
 
 // DownloadPDF downloads a PDF from the given URL and saves it to the specified file path
-func DownloadPDF(pdfURL, outputPath string) error {
+func DownloadPDF(ctx context.Context, pdfURL, outputPath string) error {
 	// Create output file
 	file, err := os.Create(outputPath)
 	if err != nil {
@@ -138,9 +145,14 @@ func DownloadPDF(pdfURL, outputPath string) error {
 	defer file.Close()
 
 	// Download the PDF
-	log.Printf("Downloading PDF from %s to %s...", pdfURL, outputPath)
+	slog.InfoContext(ctx, "Downloading the PDF...", "url", pdfURL, "file", outputPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pdfURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid PDF URL %q: %w", pdfURL, err)
+	}
+
 	client := &http.Client{Timeout: httpRequestTimeout}
-	resp, err := client.Get(pdfURL)
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("error downloading PDF: %w", err)
 	}
@@ -157,17 +169,10 @@ func DownloadPDF(pdfURL, outputPath string) error {
 		return fmt.Errorf("error saving PDF data: %w", err)
 	}
 
-	log.Printf("Download complete! %d bytes written to %s", bytesWritten, outputPath)
+	slog.InfoContext(ctx, "Downloaded the PDF", "bytes", bytesWritten, "file", outputPath)
 	return nil
 }
 
-// ScrapeEspaceWebsite is a custom scraper for the SV Espace restaurant website.
-// It loads each weekday by its own dated URL and combines the menus into a single
-// HTML document with one labelled section per day.
-func ScrapeEspaceWebsite(pageURL string, debug bool) (*MenuData, error) {
-	return scrapeEspace(pageURL, "", debug)
-}
-
 // ScrapeEspaceDay scrapes a single weekday, given as a YYYY-MM-DD date. The daily
 // photo run only needs the photos of the day being published, and asking for just
 // that day keeps it off the other days' tabs, which it has no use for.
@@ -175,58 +180,34 @@ func ScrapeEspaceWebsite(pageURL string, debug bool) (*MenuData, error) {
 // A date the page has no tab for - a holiday, a day outside the published week -
 // yields no days rather than an error: the caller treats an empty scrape as "nothing
 // published yet", which is exactly what it is.
-func ScrapeEspaceDay(pageURL, date string, debug bool) (*MenuData, error) {
-	return scrapeEspace(pageURL, date, debug)
+func ScrapeEspaceDay(ctx context.Context, chrome *Browser, pageURL, date string, debug bool) (*MenuData, error) {
+	return scrapeEspace(ctx, chrome, pageURL, date, debug)
 }
 
-// scrapeEspace scrapes the whole published week, or a single day when onlyDate is
-// set to a YYYY-MM-DD date.
-func scrapeEspace(pageURL, onlyDate string, debug bool) (*MenuData, error) {
-	opts := []chromedp.ExecAllocatorOption{
-		chromedp.NoFirstRun,
-		chromedp.NoDefaultBrowserCheck,
-		chromedp.DisableGPU,
-		chromedp.WindowSize(1280, 800),
-		chromedp.NoSandbox,
-		// Chrome puts its shared memory in /dev/shm, which Docker caps at 64MB. Loading
-		// a day used to hang the renderer outright there - not slowly, but past any
-		// timeout, unresponsive even to an evaluate - which is why this scrape worked
-		// on a laptop and never in CI. Keeping that memory in /tmp lifts the cap.
-		chromedp.Flag("disable-dev-shm-usage", true),
-	}
-
-	// Don't run in headless mode if debug mode is enabled
-	if debug {
-		log.Println("Debug mode enabled: Chrome browser will stay open for inspection")
-		opts = append(opts, chromedp.Flag("headless", false))          // Disable headless mode
-		opts = append(opts, chromedp.Flag("enable-automation", false)) // Hide automation banner
-		log.Println("Configured Chrome to run in visible mode")
-	} else {
-		opts = append(opts, chromedp.Flag("headless", true)) // Enable headless mode
+// scrapeEspace is the scraper for the SV Espace restaurant website. It loads each
+// weekday by its own dated URL and combines the menus into a single HTML document
+// with one labelled section per day - or scrapes a single day, when onlyDate is set
+// to a YYYY-MM-DD date.
+//
+// It runs in a tab of its own, so other scrapes can share the browser. The tab
+// lives on the browser's context rather than the caller's, so the caller's context
+// only cuts it short.
+func scrapeEspace(parent context.Context, chrome *Browser, pageURL, onlyDate string, debug bool) (*MenuData, error) {
+	tabCtx, closeTab, err := chrome.newTab()
+	if err != nil {
+		return nil, err
 	}
-
-	allocCtx, cancelAllocator := chromedp.NewExecAllocator(context.Background(), opts...)
 	if !debug {
-		defer cancelAllocator()
+		defer closeTab()
 	}
 
-	ctx, cancel := chromedp.NewContext(allocCtx,
-		chromedp.WithLogf(func(format string, args ...interface{}) {
-			if debug {
-				log.Printf("ChromeDP: "+format, args...)
-			}
-		}),
-	)
-
-	ctx, cancelTimeout := context.WithTimeout(ctx, chromeTimeout)
-
-	if !debug {
-		defer cancel()
-	}
+	ctx, cancelTimeout := context.WithTimeout(tabCtx, chromeTimeout)
 	defer cancelTimeout()
+	stop := context.AfterFunc(parent, cancelTimeout)
+	defer stop()
 
 	// Navigate to website and handle initial setup
-	err := chromedp.Run(ctx,
+	err = chromedp.Run(ctx,
 		chromedp.Navigate(pageURL),
 		// Do not grant any permissions to avoid the geolocation prompt
 		browser.GrantPermissions([]browser.PermissionType{}),
@@ -236,7 +217,7 @@ func scrapeEspace(pageURL, onlyDate string, debug bool) (*MenuData, error) {
 	)
 	if err != nil {
 		if debug {
-			log.Printf("Error during initial page setup: %v", err)
+			slog.ErrorContext(parent, "Error during initial page setup", "error", err)
 			waitForInterrupt()
 		}
 		return nil, fmt.Errorf("failed to setup page: %w", err)
@@ -276,6 +257,8 @@ func scrapeEspace(pageURL, onlyDate string, debug bool) (*MenuData, error) {
 			return nil, fmt.Errorf("invalid tab link %q: %w", tab.Href, err)
 		}
 		dayURL := base.ResolveReference(href).String()
+		dayLog := logging.With(parent, "day", day)
+		start := time.Now()
 
 		// Loading each day by its own URL rebuilds the DOM, so we can never capture
 		// the previous day's dishes because the page had not re-rendered yet.
@@ -295,8 +278,7 @@ func scrapeEspace(pageURL, onlyDate string, debug bool) (*MenuData, error) {
 		)
 		if err != nil {
 			cancelDay()
-			log.Printf("Error scraping %s menu: %v\nThe page was showing: %s",
-				day, err, describePage(ctx))
+			slog.ErrorContext(dayLog, "Error scraping the day's menu", "error", err, "page", describePage(ctx))
 			if debug {
 				continue // Try next day in debug mode
 			}
@@ -311,7 +293,7 @@ func scrapeEspace(pageURL, onlyDate string, debug bool) (*MenuData, error) {
 		// losing them is not worth failing a menu over - the dish just gets no link.
 		links := make(map[string]string)
 		if err := chromedp.Run(dayCtx, evaluateAsync(jsDishLinks, &links)); err != nil {
-			log.Printf("Warning: could not read the %s dish links: %v", day, err)
+			slog.WarnContext(dayLog, "Could not read the dish links", "error", err)
 		}
 		cancelDay()
 
@@ -328,14 +310,17 @@ func scrapeEspace(pageURL, onlyDate string, debug bool) (*MenuData, error) {
 		// Kept whole for the debug output; each day is parsed on its own
 		fmt.Fprintf(&allMenus, "<h2>%s (%s)</h2>\n%s\n", day, tab.Date, capture.HTML)
 
-		log.Printf("Scraped %s %s: %d dishes, %d photos, %d links (%d bytes)",
-			day, tab.Date, capture.Dishes, len(capture.Photos), len(links), len(capture.HTML))
+		elapsed := time.Since(start)
+		metrics.ScrapeDayDuration.WithLabelValues(day).Observe(elapsed.Seconds())
+		slog.InfoContext(dayLog, "Scraped the day",
+			"date", tab.Date, "duration", elapsed, "dishes", capture.Dishes,
+			"photos", len(capture.Photos), "links", len(links), "bytes", len(capture.HTML))
 	}
 
 	htmlContent := allMenus.String()
 
 	if debug {
-		log.Printf("Successfully scraped all weekly menus (total: %d bytes)", len(htmlContent))
+		slog.InfoContext(parent, "Successfully scraped all weekly menus", "bytes", len(htmlContent))
 		waitForInterrupt()
 	}
 
@@ -482,7 +467,7 @@ func rejectCookies() chromedp.ActionFunc {
 		defer cancel()
 
 		if err := chromedp.Click(`#cookiescript_reject`, chromedp.ByQuery).Do(clickCtx); err != nil {
-			log.Printf("Cookie banner not found or not clickable, continuing: %v", err)
+			slog.InfoContext(ctx, "Cookie banner not found or not clickable, continuing", "error", err)
 		}
 		return nil
 	}
@@ -544,9 +529,9 @@ func waitForDay(date string) chromedp.ActionFunc {
 // waitForInterrupt blocks until an interrupt signal (Ctrl+C) is received,
 // allowing the debug browser to stay open for inspection.
 func waitForInterrupt() {
-	log.Println("Keeping browser open for inspection. Press Ctrl+C to exit.")
+	slog.Info("Keeping browser open for inspection. Press Ctrl+C to exit.")
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 	<-sig
-	log.Println("Received interrupt, shutting down.")
+	slog.Info("Received interrupt, shutting down.")
 }
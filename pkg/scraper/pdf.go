@@ -1,12 +1,80 @@
 package scraper
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"rsc.io/pdf"
 )
 
+// pdfScraper finds the link to a menu PDF on the restaurant's page, with the
+// restaurant's MenuSelector, and extracts the text of its first page.
+type pdfScraper struct {
+	opts Options
+}
+
+func (pdfScraper) Validate(restaurant RestaurantMenu) error {
+	if restaurant.MenuSelector == "" {
+		return errors.New("menuSelector is required for pdf menus")
+	}
+	return nil
+}
+
+func (s pdfScraper) Scrape(ctx context.Context, restaurant RestaurantMenu) (*MenuData, error) {
+	if err := s.Validate(restaurant); err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Fetching PDF menu", "selector", restaurant.MenuSelector)
+
+	// Fetch the PDF menu URL using the selector
+	pdfURL, err := FetchPDFMenuURL(ctx, restaurant.URL, restaurant.MenuSelector)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching PDF URL: %w", err)
+	}
+
+	var pdfFilePath string
+
+	if s.opts.Debug {
+		// In debug mode, save the PDF to the debug directory
+		if err := os.MkdirAll("debug", 0o755); err != nil {
+			return nil, fmt.Errorf("error creating debug directory: %w", err)
+		}
+		pdfFilePath = filepath.Join("debug", fmt.Sprintf("%s_menu.pdf",
+			strings.ToLower(restaurant.Name)))
+		slog.InfoContext(ctx, "Debug mode: Saving PDF", "file", pdfFilePath)
+	} else {
+		// In production mode, save to a temporary directory
+		tempDir, err := os.MkdirTemp("", "menu-pdf")
+		if err != nil {
+			return nil, fmt.Errorf("error creating temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		pdfFilePath = filepath.Join(tempDir, fmt.Sprintf("%s_menu.pdf",
+			strings.ToLower(restaurant.Name)))
+	}
+
+	// Download the PDF file
+	if err := DownloadPDF(ctx, pdfURL, pdfFilePath); err != nil {
+		return nil, fmt.Errorf("error downloading PDF: %w", err)
+	}
+
+	// Extract text from PDF
+	slog.InfoContext(ctx, "Extracting text from PDF...")
+	pdfText, err := ExtractTextFromPDF(pdfFilePath, 1) // Extract only first page
+	if err != nil {
+		return nil, fmt.Errorf("error extracting text from PDF: %w", err)
+	}
+
+	return &MenuData{Content: pdfText, PDFURL: pdfURL}, nil
+}
+
 // ExtractTextFromPDF extracts text content from a PDF file
 // maxPages: the maximum number of pages to extract (0 for all)
 func ExtractTextFromPDF(pdfPath string, maxPages int) (string, error) {
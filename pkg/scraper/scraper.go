@@ -0,0 +1,198 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chlab/lunch-wankdorf/pkg/ai"
+	"github.com/chlab/lunch-wankdorf/pkg/replay"
+)
+
+// RestaurantMenu defines a restaurant menu source
+type RestaurantMenu struct {
+	ID           string    `yaml:"-"` // The key the restaurant is registered under
+	Name         string    `yaml:"name"`
+	URL          string    `yaml:"url"`
+	BaseURL      string    `yaml:"baseURL"`
+	Scraper      string    `yaml:"scraper"`      // Kind of scraper that reads the site, see Kinds
+	MenuSelector string    `yaml:"menuSelector"` // CSS selector to find the menu link (for PDF menus)
+	Parser       string    `yaml:"parser"`       // How the menu is parsed: model (the default), rules or rules+model
+	Disabled     bool      `yaml:"disabled"`     // Left out of batch runs unless asked for by ID
+	Prompt       ai.Prompt `yaml:"prompt"`       // What the restaurant adds to the model's prompt
+}
+
+// Scraper fetches a restaurant's menu. Each kind of site has its own: the
+// scraper is what knows how the site lays out its week, so everything after it
+// only ever sees days (or, for a PDF, the menu's text).
+type Scraper interface {
+	Scrape(ctx context.Context, restaurant RestaurantMenu) (*MenuData, error)
+}
+
+// Validator is implemented by scrapers that need more of a RestaurantMenu than
+// its URL, so a restaurant can be checked before anything is scraped.
+type Validator interface {
+	Validate(restaurant RestaurantMenu) error
+}
+
+// Options is what a scraper is built with for one run.
+type Options struct {
+	// Browser is shared by the scrapers that need Chrome. It is only started once
+	// one of them asks for a tab.
+	Browser *Browser
+	Debug   bool
+}
+
+// Factory builds a kind's scraper for one run.
+type Factory func(opts Options) Scraper
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a kind of scraper available to restaurants. It panics if the
+// kind is registered twice, which can only be a programming error.
+func Register(kind string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if _, exists := factories[kind]; exists {
+		panic(fmt.Sprintf("scraper: %q registered twice", kind))
+	}
+	factories[kind] = factory
+}
+
+// New builds the scraper for a kind.
+func New(kind string, opts Options) (Scraper, error) {
+	factoriesMu.RLock()
+	factory := factories[kind]
+	factoriesMu.RUnlock()
+
+	if factory == nil {
+		return nil, fmt.Errorf("unknown scraper %q, want one of %v", kind, Kinds())
+	}
+	return factory(opts), nil
+}
+
+// Kinds lists the registered kinds of scraper, sorted.
+func Kinds() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	kinds := make([]string, 0, len(factories))
+	for kind := range factories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Validate checks that a restaurant names a known scraper and gives it what it
+// needs.
+func Validate(restaurant RestaurantMenu) error {
+	s, err := New(restaurant.Scraper, Options{})
+	if err != nil {
+		return err
+	}
+	if v, ok := s.(Validator); ok {
+		return v.Validate(restaurant)
+	}
+	return nil
+}
+
+// Taped records what s scrapes to tape, or replays it from there. A replay never
+// calls s, so it needs neither the site nor Chrome. The recording is s's result -
+// the page content, every captured day, a PDF's text - which is exactly what the
+// rest of the run works from.
+func Taped(s Scraper, tape *replay.Tape) Scraper {
+	if tape == nil {
+		return s
+	}
+	return tapedScraper{scraper: s, tape: tape}
+}
+
+type tapedScraper struct {
+	scraper Scraper
+	tape    *replay.Tape
+}
+
+func (t tapedScraper) Scrape(ctx context.Context, restaurant RestaurantMenu) (*MenuData, error) {
+	const kind = "scrape"
+	key := strings.ToLower(restaurant.Name)
+
+	if t.tape.Replaying() {
+		var menuData MenuData
+		if err := t.tape.Load(kind, key, &menuData); err != nil {
+			return nil, err
+		}
+		return &menuData, nil
+	}
+
+	menuData, err := t.scraper.Scrape(ctx, restaurant)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.tape.Save(kind, key, menuData); err != nil {
+		return nil, err
+	}
+	return menuData, nil
+}
+
+// htmlScraper reads any page whose menu is in the markup, but leaves it in one
+// piece: it cannot know how the site splits the week into days.
+type htmlScraper struct{}
+
+func (htmlScraper) Scrape(ctx context.Context, restaurant RestaurantMenu) (*MenuData, error) {
+	return ScrapeMenuContent(ctx, restaurant.URL)
+}
+
+// food2050Scraper reads the food2050 weekly pages (Gira, Luna, Sole) and splits
+// them by the date in each dish link, see GroupMenuByDay.
+type food2050Scraper struct{}
+
+func (food2050Scraper) Scrape(ctx context.Context, restaurant RestaurantMenu) (*MenuData, error) {
+	menuData, err := ScrapeMenuContent(ctx, restaurant.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	days, err := GroupMenuByDay(OptimizeHTML(ctx, menuData.Content))
+	if err != nil {
+		return nil, fmt.Errorf("error grouping menu by day: %w", err)
+	}
+
+	// Without the dates we can't tell which day a dish belongs to, and neither can
+	// the model - that is the bug the grouping exists to prevent. Better to fail
+	// loudly than to upload a menu with days silently missing.
+	if len(days) == 0 {
+		return nil, fmt.Errorf("found no dated dish links for %s, the page markup has probably changed", restaurant.Name)
+	}
+
+	menuData.Days = days
+	return menuData, nil
+}
+
+// svScraper drives the SV Gastronomie app (Espace) in Chrome, one dated route per
+// day, see scrapeEspace.
+type svScraper struct {
+	opts Options
+}
+
+func (s svScraper) Scrape(ctx context.Context, restaurant RestaurantMenu) (*MenuData, error) {
+	browser := s.opts.Browser
+	if browser == nil {
+		browser = NewBrowser(s.opts.Debug)
+		defer browser.Close()
+	}
+	return scrapeEspace(ctx, browser, restaurant.URL, "", s.opts.Debug)
+}
+
+func init() {
+	Register("html", func(Options) Scraper { return htmlScraper{} })
+	Register("food2050", func(Options) Scraper { return food2050Scraper{} })
+	Register("sv", func(opts Options) Scraper { return svScraper{opts: opts} })
+	Register("pdf", func(opts Options) Scraper { return pdfScraper{opts: opts} })
+}
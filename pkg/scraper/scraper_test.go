@@ -0,0 +1,59 @@
+package scraper
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestKindsAreRegistered(t *testing.T) {
+	for _, kind := range []string{"food2050", "html", "pdf", "sv"} {
+		if !slices.Contains(Kinds(), kind) {
+			t.Errorf("Kinds() = %v, want it to contain %q", Kinds(), kind)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		restaurant RestaurantMenu
+		wantErr    bool
+	}{
+		{"food2050", RestaurantMenu{Scraper: "food2050"}, false},
+		{"pdf with a selector", RestaurantMenu{Scraper: "pdf", MenuSelector: "a.menu"}, false},
+		// Without the selector there is no way to find the PDF on the page
+		{"pdf without a selector", RestaurantMenu{Scraper: "pdf"}, true},
+		{"unknown kind", RestaurantMenu{Scraper: "rss"}, true},
+		{"no kind", RestaurantMenu{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.restaurant)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Validate() error = %v, want error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+type stubScraper struct{ data *MenuData }
+
+func (s stubScraper) Scrape(context.Context, RestaurantMenu) (*MenuData, error) {
+	return s.data, nil
+}
+
+func TestRegisteredKindsCanBeBuilt(t *testing.T) {
+	want := &MenuData{Content: "<p>Pizza</p>"}
+	Register("test-stub", func(Options) Scraper { return stubScraper{data: want} })
+
+	s, err := New("test-stub", Options{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	got, err := s.Scrape(context.Background(), RestaurantMenu{})
+	if err != nil || got != want {
+		t.Errorf("Scrape() = %v, %v, want the stub's data", got, err)
+	}
+}
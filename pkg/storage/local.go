@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Dir keeps the files in a local directory, laid out like the bucket. Served over
+// HTTP, it is a mirror the frontend can read from (VITE_MENU_BASE_URL).
+type Dir struct {
+	path string
+}
+
+// NewDir opens the directory at path, creating it if needed.
+func NewDir(path string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create the storage directory: %w", err)
+	}
+	return &Dir{path: path}, nil
+}
+
+// putIfVersionMu keeps PutIfVersion's check and write together. It only holds
+// within the process: the directory is a mirror for one machine, not something
+// runs elsewhere write to.
+var putIfVersionMu sync.Mutex
+
+func (d *Dir) Get(_ context.Context, name string) ([]byte, error) {
+	path, err := d.file(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s in %s: %w", name, d, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// Put writes the file next to its final name first and renames it into place, so
+// a mirror being served never hands out half a menu.
+func (d *Dir) Put(_ context.Context, name string, data []byte) error {
+	path, err := d.file(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	// CreateTemp's 0600 would keep a web server running as another user out
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func (d *Dir) GetVersion(ctx context.Context, name string) ([]byte, string, error) {
+	data, err := d.Get(ctx, name)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, fileVersion(data), nil
+}
+
+func (d *Dir) GetObject(_ context.Context, name string) ([]byte, Object, error) {
+	path, err := d.file(name)
+	if err != nil {
+		return nil, Object{}, err
+	}
+
+	// The modification time of the file that is read, even if it is replaced
+	// in the meantime
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, Object{}, fmt.Errorf("%s in %s: %w", name, d, ErrNotFound)
+	}
+	if err != nil {
+		return nil, Object{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, Object{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, Object{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, Object{Name: name, Size: int64(len(data)), Modified: info.ModTime()}, nil
+}
+
+func (d *Dir) PutIfVersion(ctx context.Context, name string, data []byte, version string) error {
+	putIfVersionMu.Lock()
+	defer putIfVersionMu.Unlock()
+
+	current, err := d.Get(ctx, name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if (err == nil && fileVersion(current) != version) || (err != nil && version != "") {
+		return fmt.Errorf("%s in %s: %w", name, d, ErrChanged)
+	}
+	return d.Put(ctx, name, data)
+}
+
+// fileVersion is a file's version in a directory, which has no ETags of its own.
+func fileVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (d *Dir) Delete(_ context.Context, name string) error {
+	path, err := d.file(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
+
+func (d *Dir) List(_ context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	err := filepath.WalkDir(d.path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(d.path, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		// Dot files are Put's temporary files, not yet in place
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			// Nothing below a directory the prefix rules out can match it
+			if !strings.HasPrefix(name+"/", prefix) && !strings.HasPrefix(prefix, name+"/") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// Replaced or removed since the directory was read
+			return nil
+		}
+		objects = append(objects, Object{Name: name, Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", d, err)
+	}
+
+	// WalkDir goes directory by directory, a bucket lists by the whole key
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+func (d *Dir) String() string {
+	return "directory " + d.path
+}
+
+// file maps a name to its path, refusing anything that would leave the directory.
+func (d *Dir) file(name string) (string, error) {
+	if !fs.ValidPath(name) || name == "." || strings.Contains(name, `\`) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	return filepath.Join(d.path, filepath.FromSlash(name)), nil
+}
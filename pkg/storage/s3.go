@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// Bucket keeps the files in an S3-compatible bucket: Cloudflare R2, AWS S3, MinIO.
+type Bucket struct {
+	client *s3.Client
+	name   string
+	label  string
+}
+
+// NewBucket uses a bucket through an S3 client the caller has configured.
+func NewBucket(client *s3.Client, name string) *Bucket {
+	return &Bucket{client: client, name: name, label: "bucket " + name}
+}
+
+// r2FromEnv is the bucket the frontend reads the menus from, or the one called
+// bucketName on the same account.
+func r2FromEnv(bucketName string) (*Bucket, error) {
+	accountID := os.Getenv("CLOUDFLARE_ACCOUNT_ID")
+	accessKeyID := os.Getenv("CLOUDFLARE_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("CLOUDFLARE_SECRET_ACCESS_KEY")
+	if bucketName == "" {
+		bucketName = os.Getenv("CLOUDFLARE_BUCKET_NAME")
+	}
+
+	if accountID == "" || accessKeyID == "" || secretAccessKey == "" || bucketName == "" {
+		return nil, fmt.Errorf("missing required Cloudflare R2 credentials in environment variables")
+	}
+
+	endpoint := fmt.Sprintf("https://%s.eu.r2.cloudflarestorage.com", accountID)
+	bucket := newS3Bucket(endpoint, "auto", accessKeyID, secretAccessKey, bucketName)
+	bucket.label = "R2 bucket " + bucketName
+	return bucket, nil
+}
+
+func s3FromEnv(bucketName string) (*Bucket, error) {
+	if bucketName == "" {
+		bucketName = os.Getenv("S3_BUCKET")
+	}
+	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if bucketName == "" || accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("S3_BUCKET, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for S3 storage")
+	}
+
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	return newS3Bucket(os.Getenv("S3_ENDPOINT"), region, accessKeyID, secretAccessKey, bucketName), nil
+}
+
+// newS3Bucket talks to the bucket at endpoint, or AWS itself if endpoint is empty.
+// Buckets elsewhere are addressed by path: MinIO and R2 don't do virtual hosts.
+func newS3Bucket(endpoint, region, accessKeyID, secretAccessKey, bucketName string) *Bucket {
+	options := s3.Options{
+		Region:      region,
+		Credentials: credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, ""),
+	}
+	if endpoint != "" {
+		options.BaseEndpoint = aws.String(endpoint)
+		options.UsePathStyle = true
+	}
+	return NewBucket(s3.New(options), bucketName)
+}
+
+func (b *Bucket) Get(ctx context.Context, name string) ([]byte, error) {
+	data, _, err := b.GetVersion(ctx, name)
+	return data, err
+}
+
+func (b *Bucket) GetVersion(ctx context.Context, name string) ([]byte, string, error) {
+	data, _, version, err := b.get(ctx, name)
+	return data, version, err
+}
+
+func (b *Bucket) GetObject(ctx context.Context, name string) ([]byte, Object, error) {
+	data, object, _, err := b.get(ctx, name)
+	return data, object, err
+}
+
+// get downloads a file, and returns it with what the response says about it and
+// its ETag.
+func (b *Bucket) get(ctx context.Context, name string) ([]byte, Object, string, error) {
+	out, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.name),
+		Key:    aws.String(name),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, Object{}, "", fmt.Errorf("%s in %s: %w", name, b, ErrNotFound)
+	}
+	if err != nil {
+		return nil, Object{}, "", fmt.Errorf("failed to download %s from %s: %w", name, b, err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, Object{}, "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	object := Object{Name: name, Size: int64(len(data)), Modified: aws.ToTime(out.LastModified)}
+	return data, object, aws.ToString(out.ETag), nil
+}
+
+func (b *Bucket) Put(ctx context.Context, name string, data []byte) error {
+	return b.put(ctx, &s3.PutObjectInput{Key: aws.String(name)}, data)
+}
+
+// PutIfVersion has the bucket check the ETag (If-Match), so nothing can be
+// written between the check and the upload.
+func (b *Bucket) PutIfVersion(ctx context.Context, name string, data []byte, version string) error {
+	input := &s3.PutObjectInput{Key: aws.String(name)}
+	if version == "" {
+		input.IfNoneMatch = aws.String("*")
+	} else {
+		input.IfMatch = aws.String(version)
+	}
+	return b.put(ctx, input, data)
+}
+
+func (b *Bucket) put(ctx context.Context, input *s3.PutObjectInput, data []byte) error {
+	name := aws.ToString(input.Key)
+	input.Bucket = aws.String(b.name)
+	input.Body = bytes.NewReader(data)
+	input.ContentType = aws.String(contentType(name))
+	_, err := b.client.PutObject(ctx, input)
+	var apiErr smithy.APIError
+	// S3 answers a conditional write that lost to another with a conflict
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "PreconditionFailed" || apiErr.ErrorCode() == "ConditionalRequestConflict") {
+		return fmt.Errorf("%s in %s: %w", name, b, ErrChanged)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to %s: %w", name, b, err)
+	}
+	return nil
+}
+
+func (b *Bucket) Delete(ctx context.Context, name string) error {
+	_, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.name),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from %s: %w", name, b, err)
+	}
+	return nil
+}
+
+// contentType is what the bucket serves a file as, which browsers, calendar apps
+// and feed readers go by rather than the name.
+func contentType(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".ics"):
+		return "text/calendar; charset=utf-8"
+	case strings.HasSuffix(name, ".atom"):
+		return "application/atom+xml"
+	case strings.HasSuffix(name, ".sqlite"):
+		return "application/vnd.sqlite3"
+	default:
+		return "application/json"
+	}
+}
+
+func (b *Bucket) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	pages := s3.NewListObjectsV2Paginator(b.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.name),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", b, err)
+		}
+		for _, object := range page.Contents {
+			objects = append(objects, Object{
+				Name:     aws.ToString(object.Key),
+				Size:     aws.ToInt64(object.Size),
+				Modified: aws.ToTime(object.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+func (b *Bucket) String() string {
+	return b.label
+}
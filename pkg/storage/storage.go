@@ -0,0 +1,104 @@
+// Package storage is where the published menu files live: the Cloudflare R2
+// bucket the frontend reads from, any other S3-compatible bucket, or a local
+// directory that can stand in for either.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Get for a file the store doesn't have.
+var ErrNotFound = errors.New("not found")
+
+// ErrChanged is returned by PutIfVersion for a file that was written since it
+// was read.
+var ErrChanged = errors.New("changed since it was read")
+
+// Store reads and writes files by name. Names are paths separated by slashes, like
+// the keys of a bucket: the menus the frontend reads are at the top
+// ("gira_29_2026.json"), older ones further down ("archive/2026/29/gira.json").
+type Store interface {
+	Get(ctx context.Context, name string) ([]byte, error)
+	Put(ctx context.Context, name string, data []byte) error
+	// GetVersion is Get, along with the version of the file it read: the bucket's
+	// ETag, or a hash of the file in a directory.
+	GetVersion(ctx context.Context, name string) ([]byte, string, error)
+	// GetObject is Get, along with the file as List would describe it, so that
+	// whoever wants to know since when it is there doesn't have to list it too.
+	GetObject(ctx context.Context, name string) ([]byte, Object, error)
+	// PutIfVersion is Put, but only if the file is still at version or, if version
+	// is empty, only if there is no file yet. It returns ErrChanged otherwise, so
+	// a file that is read, changed and written back doesn't overwrite what another
+	// run wrote in between.
+	PutIfVersion(ctx context.Context, name string, data []byte, version string) error
+	// Delete removes a file. A file that isn't there is not an error.
+	Delete(ctx context.Context, name string) error
+	// List returns the files whose name starts with prefix, sorted by name,
+	// including those further down ("archive/" lists the whole archive).
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// String names the store in log messages, e.g. "R2 bucket menus".
+	String() string
+}
+
+// Object is a stored file, as List describes it.
+type Object struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+// The backends Open knows.
+const (
+	BackendR2    = "r2"    // Cloudflare R2, the published menus
+	BackendS3    = "s3"    // any other S3-compatible bucket
+	BackendLocal = "local" // a directory on disk
+)
+
+// DefaultDir is where the local backend writes unless told otherwise.
+const DefaultDir = "menus"
+
+// Open opens the store backend names, taking its settings from the environment:
+//
+//	r2     CLOUDFLARE_ACCOUNT_ID, CLOUDFLARE_ACCESS_KEY_ID, CLOUDFLARE_SECRET_ACCESS_KEY,
+//	       CLOUDFLARE_BUCKET_NAME
+//	s3     S3_BUCKET, S3_ENDPOINT (empty for AWS itself), S3_REGION, AWS_ACCESS_KEY_ID,
+//	       AWS_SECRET_ACCESS_KEY
+//	local  dir, or DefaultDir if that is empty
+func Open(backend, dir string) (Store, error) {
+	switch strings.ToLower(backend) {
+	case "", BackendR2:
+		return r2FromEnv("")
+	case BackendS3:
+		return s3FromEnv("")
+	case BackendLocal:
+		if dir == "" {
+			dir = DefaultDir
+		}
+		return NewDir(dir)
+	default:
+		return nil, fmt.Errorf("unknown storage %q, want %s, %s or %s", backend, BackendR2, BackendS3, BackendLocal)
+	}
+}
+
+// OpenBucket opens another store of the backend Open would, for files that are
+// not to be published with the menus: the bucket called name, on the account the
+// environment gives, or for local the directory name.
+func OpenBucket(backend, name string) (Store, error) {
+	if name == "" {
+		return nil, errors.New("no bucket name")
+	}
+	switch strings.ToLower(backend) {
+	case "", BackendR2:
+		return r2FromEnv(name)
+	case BackendS3:
+		return s3FromEnv(name)
+	case BackendLocal:
+		return NewDir(name)
+	default:
+		return nil, fmt.Errorf("unknown storage %q, want %s, %s or %s", backend, BackendR2, BackendS3, BackendLocal)
+	}
+}
@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is just enough of the S3 API, path-style, for a Bucket to talk to.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte // "bucket/key"
+	types   map[string]string // their Content-Type
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	fake := &fakeS3{objects: make(map[string][]byte), types: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+		f.list(w, key, r.URL.Query().Get("prefix"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		current, exists := f.objects[key]
+		ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+		if (ifMatch != "" && (!exists || ifMatch != etag(current))) || (ifNoneMatch == "*" && exists) {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			io.WriteString(w, `<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = body
+		f.types[key] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", etag(body))
+	case http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			return
+		}
+		w.Header().Set("ETag", etag(body))
+		w.Header().Set("Last-Modified", "Mon, 13 Jul 2026 04:39:12 GMT")
+		w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// etag is what S3 tags an object that wasn't uploaded in parts with: its MD5, quoted.
+func etag(body []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(body))
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, bucket, prefix string) {
+	var keys []string
+	for key := range f.objects {
+		name, ok := strings.CutPrefix(key, bucket+"/")
+		if ok && strings.HasPrefix(name, prefix) {
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, `<ListBucketResult><Name>%s</Name><KeyCount>%d</KeyCount><IsTruncated>false</IsTruncated>`, bucket, len(keys))
+	for _, key := range keys {
+		fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size><LastModified>2026-07-13T04:39:12.000Z</LastModified></Contents>`,
+			key, len(f.objects[bucket+"/"+key]))
+	}
+	io.WriteString(w, `</ListBucketResult>`)
+}
+
+func testStores(t *testing.T) map[string]Store {
+	dir, err := NewDir(filepath.Join(t.TempDir(), "menus"))
+	if err != nil {
+		t.Fatalf("NewDir() error = %v", err)
+	}
+	_, server := newFakeS3(t)
+	return map[string]Store{
+		"local": dir,
+		"s3":    newS3Bucket(server.URL, "auto", "key", "secret", "menus"),
+	}
+}
+
+func TestStoresRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.Get(ctx, "gira_29_2026.json"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get() of a missing file error = %v, want ErrNotFound", err)
+			}
+
+			if err := store.Put(ctx, "gira_29_2026.json", []byte(`{"type":"daily"}`)); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			// Replaces what was there
+			if err := store.Put(ctx, "gira_29_2026.json", []byte(`{"type":"daily","menu":{}}`)); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+
+			data, err := store.Get(ctx, "gira_29_2026.json")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if string(data) != `{"type":"daily","menu":{}}` {
+				t.Errorf("Get() = %s, want what was put last", data)
+			}
+
+			data, object, err := store.GetObject(ctx, "gira_29_2026.json")
+			if err != nil || string(data) != `{"type":"daily","menu":{}}` {
+				t.Fatalf("GetObject() = %s, %v, want what was put last", data, err)
+			}
+			if object.Name != "gira_29_2026.json" || object.Size != int64(len(data)) || object.Modified.IsZero() {
+				t.Errorf("GetObject() object = %+v, want its name, size and modification time", object)
+			}
+			if _, _, err := store.GetObject(ctx, "luna_29_2026.json"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetObject() of a missing file error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestStoresPutIfVersion(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			const file = "history/gira.sqlite"
+			if err := store.PutIfVersion(ctx, file, []byte("one"), ""); err != nil {
+				t.Fatalf("PutIfVersion() of a new file error = %v", err)
+			}
+			if err := store.PutIfVersion(ctx, file, []byte("two"), ""); !errors.Is(err, ErrChanged) {
+				t.Errorf("PutIfVersion() of a file that is there, as new, error = %v, want ErrChanged", err)
+			}
+
+			data, version, err := store.GetVersion(ctx, file)
+			if err != nil || string(data) != "one" || version == "" {
+				t.Fatalf("GetVersion() = %s, %q, %v, want the file and its version", data, version, err)
+			}
+			// Another run writes in between
+			if err := store.Put(ctx, file, []byte("three")); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.PutIfVersion(ctx, file, []byte("two"), version); !errors.Is(err, ErrChanged) {
+				t.Errorf("PutIfVersion() of a file that changed error = %v, want ErrChanged", err)
+			}
+
+			_, version, _ = store.GetVersion(ctx, file)
+			if err := store.PutIfVersion(ctx, file, []byte("two"), version); err != nil {
+				t.Fatalf("PutIfVersion() error = %v", err)
+			}
+			if data, _ := store.Get(ctx, file); string(data) != "two" {
+				t.Errorf("Get() = %s, want what was put last", data)
+			}
+		})
+	}
+}
+
+func TestBucketServesCalendarsAndFeedsAsSuch(t *testing.T) {
+	fake, server := newFakeS3(t)
+	bucket := newS3Bucket(server.URL, "auto", "key", "secret", "menus")
+	for _, name := range []string{"gira_29_2026.json", "gira.ics", "gira.atom", "history/gira.sqlite"} {
+		if err := bucket.Put(context.Background(), name, []byte("x")); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	if got := fake.types["menus/gira_29_2026.json"]; got != "application/json" {
+		t.Errorf("menu Content-Type = %q, want application/json", got)
+	}
+	if got := fake.types["menus/gira.ics"]; !strings.HasPrefix(got, "text/calendar") {
+		t.Errorf("calendar Content-Type = %q, want text/calendar", got)
+	}
+	if got := fake.types["menus/gira.atom"]; got != "application/atom+xml" {
+		t.Errorf("feed Content-Type = %q, want application/atom+xml", got)
+	}
+	if got := fake.types["menus/history/gira.sqlite"]; got != "application/vnd.sqlite3" {
+		t.Errorf("history Content-Type = %q, want application/vnd.sqlite3", got)
+	}
+}
+
+func TestStoresDelete(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := store.Put(ctx, "archive/2026/29/gira.json", []byte(`{}`)); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if err := store.Delete(ctx, "archive/2026/29/gira.json"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if _, err := store.Get(ctx, "archive/2026/29/gira.json"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+			}
+			if err := store.Delete(ctx, "gira_29_2026.json"); err != nil {
+				t.Errorf("Delete() of a missing file error = %v, want none", err)
+			}
+		})
+	}
+}
+
+func TestStoresList(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, file := range []string{"luna_29_2026.json", "gira_30_2026.json", "gira_29_2026.json"} {
+				if err := store.Put(ctx, file, []byte(`{}`)); err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+			}
+
+			objects, err := store.List(ctx, "gira_")
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if len(objects) != 2 || objects[0].Name != "gira_29_2026.json" || objects[1].Name != "gira_30_2026.json" {
+				t.Fatalf("List() = %+v, want gira's two files in order", objects)
+			}
+			if objects[0].Size != 2 || objects[0].Modified.IsZero() {
+				t.Errorf("objects[0] = %+v, want its size and modification time", objects[0])
+			}
+
+			// Further down, by the whole name
+			for _, file := range []string{"archive/2026/30/gira.json", "archive/2026/29/luna.json", "archive/2025/52/gira.json"} {
+				if err := store.Put(ctx, file, []byte(`{}`)); err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+			}
+			for prefix, want := range map[string][]string{
+				"archive/":       {"archive/2025/52/gira.json", "archive/2026/29/luna.json", "archive/2026/30/gira.json"},
+				"archive/2026/":  {"archive/2026/29/luna.json", "archive/2026/30/gira.json"},
+				"archive/2026/3": {"archive/2026/30/gira.json"},
+				"":               {"archive/2025/52/gira.json", "archive/2026/29/luna.json", "archive/2026/30/gira.json", "gira_29_2026.json", "gira_30_2026.json", "luna_29_2026.json"},
+			} {
+				objects, err := store.List(ctx, prefix)
+				if err != nil {
+					t.Fatalf("List(%q) error = %v", prefix, err)
+				}
+				var got []string
+				for _, object := range objects {
+					got = append(got, object.Name)
+				}
+				if strings.Join(got, " ") != strings.Join(want, " ") {
+					t.Errorf("List(%q) = %v, want %v", prefix, got, want)
+				}
+			}
+		})
+	}
+}
+
+// The local directory is a mirror to serve as is: files by their plain name, and
+// nothing else in it.
+func TestDirIsAServableMirror(t *testing.T) {
+	path := t.TempDir()
+	dir, err := NewDir(path)
+	if err != nil {
+		t.Fatalf("NewDir() error = %v", err)
+	}
+	if err := dir.Put(context.Background(), "gira_29_2026.json", []byte(`{}`)); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	entries, _ := os.ReadDir(path)
+	if len(entries) != 1 || entries[0].Name() != "gira_29_2026.json" {
+		t.Errorf("directory holds %v, want just the menu", entries)
+	}
+	if info, _ := entries[0].Info(); info.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, want it readable by a web server", info.Mode().Perm())
+	}
+
+	for _, name := range []string{"../gira_29_2026.json", "/gira_29_2026.json", "archive/../../x.json", "archive//x.json", `archive\x.json`, ""} {
+		if err := dir.Put(context.Background(), name, []byte(`{}`)); err == nil {
+			t.Errorf("Put(%q) succeeded, want names outside the directory refused", name)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Setenv("CLOUDFLARE_ACCOUNT_ID", "")
+	if _, err := Open(BackendR2, ""); err == nil {
+		t.Error("want an error for R2 without credentials")
+	}
+	if _, err := Open("ftp", ""); err == nil {
+		t.Error("want an error for an unknown backend")
+	}
+
+	store, err := Open(BackendLocal, filepath.Join(t.TempDir(), "mirror"))
+	if err != nil {
+		t.Fatalf("Open(local) error = %v", err)
+	}
+	if _, ok := store.(*Dir); !ok {
+		t.Errorf("Open(local) = %T, want a *Dir", store)
+	}
+}
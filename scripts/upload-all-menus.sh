@@ -6,22 +6,7 @@
 
 set -e
 
-# Turbolama and Freibank are disabled: they kept moving their menu around, so
-# nothing is scraped for them.
-RESTAURANTS=("gira" "luna" "sole" "espace")
-
 cd "$(dirname "$(dirname "$0")")"
 
-echo "Fetching and uploading menus for: ${RESTAURANTS[*]}"
-
-for restaurant in "${RESTAURANTS[@]}"; do
-  echo "========================================"
-  echo "Processing restaurant: $restaurant"
-  echo "========================================"
-
-  go run ./cmd/app -restaurant="$restaurant" -upload
-
-  echo "Completed processing for $restaurant"
-done
-
-echo "All restaurants processed successfully!"
+# Turbolama and Freibank are disabled in the registry, so -all leaves them out.
+go run ./cmd/app -all -upload "$@"
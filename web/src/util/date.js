@@ -45,3 +45,12 @@ export function getDateForDay(dayName, from = new Date()) {
   date.setDate(date.getDate() + (DAYS.indexOf(dayName) - isoDayIndex(from)));
   return date;
 }
+
+/** The Monday of ISO `week` of `year`, as an ISO date ('2026-07-13'). */
+export function getISOWeekMonday(year, week) {
+  // January 4 is always in week 1; UTC, so that no time zone moves the day
+  const jan4 = new Date(Date.UTC(year, 0, 4));
+  const monday = new Date(jan4.valueOf());
+  monday.setUTCDate(jan4.getUTCDate() - ((jan4.getUTCDay() + 6) % 7) + (week - 1) * 7);
+  return monday.toISOString().slice(0, 10);
+}
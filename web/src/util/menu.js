@@ -1,4 +1,4 @@
-import { getISOWeekNumber, getISOWeekYear, WEEKDAYS } from './date';
+import { getISOWeekMonday, getISOWeekNumber, getISOWeekYear, WEEKDAYS } from './date';
 import foodtrucksMenu from '../foodtrucks.json';
 
 /**
@@ -14,6 +14,10 @@ import foodtrucksMenu from '../foodtrucks.json';
  * @property {string} [foodtruck] - name of the truck, foodtruck items only
  * @property {string} [photo] - thumbnail of the dish, '' when the restaurant has none
  * @property {string} [photoLarge] - the same photo for the lightbox, '' when there is none
+ * @property {string} [firstSeen] - ISO date the restaurant first served the dish
+ * @property {string} [lastSeen] - ISO date it was served before the day it is on
+ * @property {number} [timesServed] - on how many days, that day included
+ * @property {boolean} isNew - first served in the week of the menu
  */
 
 // The R2 bucket doesn't allow localhost, so local dev can point at a mirror instead
@@ -51,10 +55,16 @@ const safeLink = (link) => {
   }
 };
 
+// The first day of the file's week, for telling the dishes that are new that week.
+// Files from before schemaVersion 2 don't say which week they are.
+const weekStart = (data) => (data.year && data.week ? getISOWeekMonday(data.year, data.week) : '');
+
 /** @returns {MenuItem} */
-const toMenuItem = (item, restaurant) => ({
+const toMenuItem = (item, restaurant, since = '') => ({
   ...item,
   restaurant,
+  // ISO dates compare as strings
+  isNew: Boolean(since && item.firstSeen && item.firstSeen >= since),
   link: safeLink(item.link ?? ''),
   icon: item.icon ?? '',
   foodtruck: item.foodtruck ?? '',
@@ -67,9 +77,29 @@ const addItems = (combined, day, items) => {
   combined[day] = [...(combined[day] ?? []), ...items];
 };
 
+/**
+ * A restaurant's published menu file. Only `type` and `menu` are needed to show
+ * it; files since schemaVersion 2 also say when and from where they were made.
+ *
+ * @typedef {Object} MenuFile
+ * @property {'daily'|'weekly'} type
+ * @property {Object<string, Object[]>|Object[]} menu - weekday ("Monday") -> items, or a flat list
+ * @property {number} [schemaVersion]
+ * @property {string} [restaurantId]
+ * @property {string} [restaurantName]
+ * @property {number} [year] - ISO week-numbering year
+ * @property {number} [week] - ISO week
+ * @property {string} [generatedAt] - RFC 3339 timestamp
+ * @property {string} [model]
+ * @property {string} [sourceUrl]
+ * @property {Object<string, {date: string, dishesOnPage: number}>} [days]
+ */
+
 /**
  * Fetch one restaurant's menu file for the ISO week `date` falls into.
  * Rejects on network errors and non-2xx responses.
+ *
+ * @returns {Promise<MenuFile>}
  */
 export async function fetchMenu(restaurant, date) {
   const filename = `${restaurant}_${getISOWeekNumber(date)}_${getISOWeekYear(date)}.json`;
@@ -100,12 +130,12 @@ export function combineMenus(menus) {
           addItems(
             combined,
             day.toLowerCase(),
-            items.map((item) => toMenuItem(item, name))
+            items.map((item) => toMenuItem(item, name, weekStart(data)))
           );
         });
         daily.push(name);
       } else if (data.type === 'weekly' && Array.isArray(data.menu)) {
-        const items = data.menu.map((item) => toMenuItem(item, name));
+        const items = data.menu.map((item) => toMenuItem(item, name, weekStart(data)));
         WEEKDAYS.forEach((day) => addItems(combined, day, items));
         weekly.push(name);
       } else {